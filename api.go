@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MaxAPIRequestBytes limits the size of a JSON API request body, including any base64 logo
+	MaxAPIRequestBytes = 10 << 20
+
+	// Response encodings for the JSON API
+	EncodingBinary = "binary" // Raw image bytes with the QR code details in headers
+	EncodingJSON   = "json"   // JSON envelope with the image as base64
+
+	// Error codes returned by the JSON API
+	ErrCodeMethodNotAllowed = "method_not_allowed"
+	ErrCodeInvalidRequest   = "invalid_request"
+	ErrCodeUnknownType      = "unknown_type"
+	ErrCodeInvalidData      = "invalid_data"
+	ErrCodeInvalidOptions   = "invalid_options"
+	ErrCodeLogoTooLarge     = "logo_too_large"
+	ErrCodeUnreadable       = "unreadable"
+	ErrCodeInternal         = "internal_error"
+)
+
+// apiRequest is the body of a JSON API request. Data holds the type specific fields
+// using the same names as the form handlers; style and output hold the shared QR code
+// options, plus the custom logo settings and response encoding.
+type apiRequest struct {
+	Type   string                     `json:"type"`
+	Data   map[string]json.RawMessage `json:"data"`
+	Style  map[string]json.RawMessage `json:"style"`
+	Output map[string]json.RawMessage `json:"output"`
+}
+
+// apiResponse is the JSON envelope returned when the output encoding is "json".
+type apiResponse struct {
+	Format      string      `json:"format"`
+	ContentType string      `json:"contentType"`
+	Data        string      `json:"data"`                  // Base64 encoded image
+	Payload     string      `json:"payload"`               // Text encoded in the QR code
+	Version     int         `json:"version"`               // QR code version, 1 to 40
+	Modules     int         `json:"modules"`               // Width of the symbol in modules, excluding the quiet zone
+	ECC         string      `json:"ecc"`                   // Error correction level actually used
+	Verified    bool        `json:"verified"`              // Whether the image was decoded back to the payload
+	LogoPercent float64     `json:"logoPercent,omitempty"` // Final logo size, after any automatic shrinking
+	Size        int         `json:"size,omitempty"`        // Image width in pixels, absent for PDF output
+	Height      int         `json:"height,omitempty"`      // Image height in pixels, larger than the width with a caption
+	Warnings    []string    `json:"warnings,omitempty"`    // Accepted options that may make the code harder to scan
+	Variants    []qrVariant `json:"variants,omitempty"`    // Version of the code in each format of the type
+}
+
+// apiError is the body of every JSON API error response.
+type apiError struct {
+	Error apiErrorDetail `json:"error"`
+}
+
+type apiErrorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// writeAPIError writes a structured JSON error and logs it under the handler's name.
+func writeAPIError(w http.ResponseWriter, handler string, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(apiError{Error: apiErrorDetail{Code: code, Message: message}}); err != nil {
+		log.Printf("%s: Failed to write error - %v", handler, err)
+	}
+	log.Printf("%s: %s - %s", handler, code, message)
+}
+
+// flattenAPIFields converts a JSON object of scalar values into form-style fields so the
+// JSON API shares its validation with the form handlers.
+func flattenAPIFields(section string, fields map[string]json.RawMessage, values url.Values) error {
+	for name, raw := range fields {
+		var value interface{}
+		decoder := json.NewDecoder(strings.NewReader(string(raw)))
+		decoder.UseNumber()
+		if err := decoder.Decode(&value); err != nil {
+			return fmt.Errorf("Invalid %s.%s: %v", section, name, err)
+		}
+		switch v := value.(type) {
+		case nil:
+			// A null value is treated as absent
+		case string:
+			values.Set(name, v)
+		case json.Number:
+			values.Set(name, v.String())
+		case bool:
+			values.Set(name, strconv.FormatBool(v))
+		default:
+			return fmt.Errorf("Invalid %s.%s: must be a string, number or boolean", section, name)
+		}
+	}
+	return nil
+}
+
+// decodeAPILogo decodes a custom logo given as base64, optionally as a data URI.
+func decodeAPILogo(value string) (image.Image, error) {
+	if i := strings.Index(value, ";base64,"); strings.HasPrefix(value, "data:") && i >= 0 {
+		value = value[i+len(";base64,"):]
+	}
+	raw, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid logo: %v", err)
+	}
+	img, err := decodeImage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid logo: %v", err)
+	}
+	return img, nil
+}
+
+// apiTypeInfo describes a payload type in the GET /api/v1/types response.
+type apiTypeInfo struct {
+	Name   string         `json:"name"`
+	Fields []PayloadField `json:"fields"`
+}
+
+func apiTypesHandler(w http.ResponseWriter, r *http.Request) {
+	// Check if the request method is GET, otherwise return an error
+	if r.Method != http.MethodGet {
+		writeAPIError(w, "apiTypesHandler", http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// List the registered payload types and their fields
+	types := []apiTypeInfo{}
+	for _, name := range payloadTypeNames() {
+		t, _ := lookupPayloadType(name)
+		types = append(types, apiTypeInfo{Name: name, Fields: t.Fields()})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string][]apiTypeInfo{"types": types}); err != nil {
+		log.Printf("apiTypesHandler: Failed to write response - %v", err)
+	}
+}
+
+func apiQRCodeHandler(w http.ResponseWriter, r *http.Request) {
+	// Check if the request method is POST, otherwise return an error
+	if r.Method != http.MethodPost {
+		writeAPIError(w, "apiQRCodeHandler", http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// Decode the JSON request body, rejecting unknown top-level keys
+	var req apiRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxAPIRequestBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeAPIError(w, "apiQRCodeHandler", http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("Invalid JSON request: %v", err))
+		return
+	}
+
+	// Look up the payload type
+	payloadType, ok := lookupPayloadType(strings.ToLower(req.Type))
+	if !ok {
+		writeAPIError(w, "apiQRCodeHandler", http.StatusBadRequest, ErrCodeUnknownType, fmt.Sprintf("Unknown type %q", req.Type))
+		return
+	}
+
+	// Flatten the type specific data, and the style and output sections which share one namespace
+	data := url.Values{}
+	if err := flattenAPIFields("data", req.Data, data); err != nil {
+		writeAPIError(w, "apiQRCodeHandler", http.StatusBadRequest, ErrCodeInvalidData, err.Error())
+		return
+	}
+	options := url.Values{}
+	if err := flattenAPIFields("style", req.Style, options); err != nil {
+		writeAPIError(w, "apiQRCodeHandler", http.StatusBadRequest, ErrCodeInvalidOptions, err.Error())
+		return
+	}
+	if err := flattenAPIFields("output", req.Output, options); err != nil {
+		writeAPIError(w, "apiQRCodeHandler", http.StatusBadRequest, ErrCodeInvalidOptions, err.Error())
+		return
+	}
+
+	// Validate the response encoding
+	encoding := strings.ToLower(options.Get("encoding"))
+	if encoding == "" {
+		encoding = EncodingBinary
+	}
+	if encoding != EncodingBinary && encoding != EncodingJSON {
+		writeAPIError(w, "apiQRCodeHandler", http.StatusBadRequest, ErrCodeInvalidOptions, fmt.Sprintf("Invalid encoding %q: must be binary or json", encoding))
+		return
+	}
+
+	// Decode the custom logo, if any
+	var customLogo image.Image
+	if value := options.Get("logo"); value != "" {
+		img, err := decodeAPILogo(value)
+		if err != nil {
+			writeAPIError(w, "apiQRCodeHandler", http.StatusBadRequest, ErrCodeInvalidOptions, err.Error())
+			return
+		}
+		customLogo = img
+	}
+
+	// Generate the QR code through the shared pipeline
+	result, err := generatePayloadQRCode(payloadType, data.Get, options.Get, customLogo)
+	if err != nil {
+		var genErr *generateError
+		if errors.As(err, &genErr) {
+			writeAPIError(w, "apiQRCodeHandler", genErr.Status, genErr.Code, genErr.Message)
+		} else {
+			writeAPIError(w, "apiQRCodeHandler", http.StatusInternalServerError, ErrCodeInternal, "Failed to generate QR code")
+		}
+		return
+	}
+
+	version := result.Code.VersionNumber
+	modules := 17 + 4*version
+	ecc := eccLevelName(result.Code.Level)
+
+	// Return the image in a JSON envelope
+	if encoding == EncodingJSON {
+		w.Header().Set("Content-Type", "application/json")
+		err := json.NewEncoder(w).Encode(apiResponse{
+			Format:      result.Options.Format,
+			ContentType: result.ContentType,
+			Data:        base64.StdEncoding.EncodeToString(result.Data),
+			Payload:     result.Payload,
+			Version:     version,
+			Modules:     modules,
+			ECC:         ecc,
+			Verified:    result.Verified,
+			Size:        result.Width,
+			Height:      result.Height,
+			Warnings:    result.Warnings,
+			Variants:    result.Variants,
+			LogoPercent: result.LogoPercent,
+		})
+		if err != nil {
+			log.Printf("apiQRCodeHandler: Failed to write response - %v", err)
+		}
+		return
+	}
+
+	// Return the raw image, describing the QR code in headers
+	w.Header().Set("Content-Type", result.ContentType)
+	w.Header().Set("X-QR-Version", strconv.Itoa(version))
+	w.Header().Set("X-QR-Modules", strconv.Itoa(modules))
+	w.Header().Set("X-QR-ECC", ecc)
+	setResultHeaders(w, result)
+	if result.LogoPercent > 0 {
+		w.Header().Set("X-QR-Logo-Percent", strconv.FormatFloat(result.LogoPercent, 'f', -1, 64))
+	}
+	if _, err := w.Write(result.Data); err != nil {
+		log.Printf("apiQRCodeHandler: Failed to write QR code - %v", err)
+	}
+}
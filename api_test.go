@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestFlattenAPIFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		want    url.Values
+		wantErr string
+	}{
+		{"string", `{"url": "https://example.com"}`, url.Values{"url": {"https://example.com"}}, ""},
+		{"number as written", `{"size": 512, "logoWidthPercent": 0.25, "big": 1e3}`,
+			url.Values{"size": {"512"}, "logoWidthPercent": {"0.25"}, "big": {"1e3"}}, ""},
+		{"boolean", `{"verify": true, "hidden": false}`, url.Values{"verify": {"true"}, "hidden": {"false"}}, ""},
+		{"null is absent", `{"ecc": null}`, url.Values{}, ""},
+		{"empty string", `{"note": ""}`, url.Values{"note": {""}}, ""},
+		{"array", `{"phones": ["1", "2"]}`, nil, "Invalid data.phones: must be a string, number or boolean"},
+		{"object", `{"address": {"city": "Bern"}}`, nil, "Invalid data.address: must be a string, number or boolean"},
+	}
+	for _, tt := range tests {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(tt.json), &fields); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		values := url.Values{}
+		err := flattenAPIFields("data", fields, values)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("%s: flattenAPIFields = %v, want %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: flattenAPIFields = %v", tt.name, err)
+			continue
+		}
+		if len(values) != len(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, values, tt.want)
+		}
+		for name, want := range tt.want {
+			if got, ok := values[name]; !ok || got[0] != want[0] {
+				t.Errorf("%s: %s = %q, want %q", tt.name, name, got, want)
+			}
+		}
+	}
+}
+
+func TestWriteAPIError(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	w := httptest.NewRecorder()
+	writeAPIError(w, "apiTypesHandler", http.StatusBadRequest, ErrCodeInvalidData, "Missing URL")
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if got := w.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	var body apiError
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decoding %q: %v", w.Body.String(), err)
+	}
+	if body.Error.Code != ErrCodeInvalidData || body.Error.Message != "Missing URL" {
+		t.Errorf("body = %+v", body)
+	}
+	if want := "apiTypesHandler: " + ErrCodeInvalidData + " - Missing URL\n"; !strings.HasSuffix(logs.String(), want) {
+		t.Errorf("log = %q, want suffix %q", logs.String(), want)
+	}
+}
+
+func TestAPIQRCodeHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		body     string
+		status   int
+		code     string
+		envelope bool
+	}{
+		{"GET", http.MethodGet, "", http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, false},
+		{"malformed JSON", http.MethodPost, `{"type": "url",`, http.StatusBadRequest, ErrCodeInvalidRequest, false},
+		{"unknown key", http.MethodPost, `{"type": "url", "colour": "red"}`, http.StatusBadRequest, ErrCodeInvalidRequest, false},
+		{"unknown type", http.MethodPost, `{"type": "fax", "data": {}}`, http.StatusBadRequest, ErrCodeUnknownType, false},
+		{"missing data", http.MethodPost, `{"type": "url", "data": {}}`, http.StatusBadRequest, ErrCodeInvalidData, false},
+		{"nested data", http.MethodPost, `{"type": "url", "data": {"url": ["a"]}}`, http.StatusBadRequest, ErrCodeInvalidData, false},
+		{"invalid options", http.MethodPost, `{"type": "url", "data": {"url": "https://example.com"}, "style": {"size": "huge"}}`,
+			http.StatusBadRequest, ErrCodeInvalidOptions, false},
+		{"invalid encoding", http.MethodPost, `{"type": "url", "data": {"url": "https://example.com"}, "style": {"size": 256}, "output": {"encoding": "xml"}}`,
+			http.StatusBadRequest, ErrCodeInvalidOptions, false},
+		{"JSON envelope", http.MethodPost, `{"type": "url", "data": {"url": "https://example.com"}, "style": {"size": 256}, "output": {"encoding": "json"}}`,
+			http.StatusOK, "", true},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		apiQRCodeHandler(w, httptest.NewRequest(tt.method, "/api/v1/qr", strings.NewReader(tt.body)))
+		if w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d: %s", tt.name, w.Code, tt.status, w.Body.String())
+			continue
+		}
+		if tt.code != "" {
+			var body apiError
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Error.Code != tt.code {
+				t.Errorf("%s: body = %s, want code %s", tt.name, w.Body.String(), tt.code)
+			}
+		}
+		if tt.envelope {
+			var body apiResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("%s: decoding %q: %v", tt.name, w.Body.String(), err)
+			}
+			if body.Payload != "https://example.com" || body.Version < 1 || body.Modules != 17+4*body.Version || body.ECC == "" || body.Data == "" {
+				t.Errorf("%s: envelope = %+v", tt.name, body)
+			}
+		}
+	}
+}
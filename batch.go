@@ -0,0 +1,283 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	// MaxBatchRows limits the number of codes generated from one CSV file
+	MaxBatchRows = 1000
+
+	// MaxBatchUploadBytes limits the size of a batch upload, CSV and logo included
+	MaxBatchUploadBytes = 32 << 20
+
+	// BatchFilenameColumn is the optional CSV column used to name each generated file
+	BatchFilenameColumn = "filename"
+
+	// BatchManifestName is the name of the manifest inside the ZIP archive
+	BatchManifestName = "manifest.csv"
+)
+
+// batchModified is the modification time of every file in a batch archive, fixed so the
+// same CSV always produces the same archive.
+var batchModified = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// batchSource is a parsed batch CSV: the header and the data rows.
+type batchSource struct {
+	Columns  map[string]int // Column index by header name
+	Rows     [][]string
+	Warnings [][]string // Warnings about the data of each row, such as content removed by an import; may be nil
+}
+
+// readBatchCSV reads a batch CSV and checks its header against the payload type's fields.
+// Every column must be a field of the type or the optional filename column, and every
+// required field must have a column.
+func readBatchCSV(t PayloadType, r io.Reader) (*batchSource, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	// Read and validate the header
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("Empty CSV file")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Invalid CSV file: %v", err)
+	}
+	fields := map[string]bool{}
+	for _, field := range t.Fields() {
+		fields[field.Name] = true
+	}
+	source := &batchSource{Columns: map[string]int{}}
+	for i, name := range header {
+		name = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+		if name != BatchFilenameColumn && !fields[name] {
+			return nil, fmt.Errorf("Unknown CSV column %q for type %s", name, t.Name())
+		}
+		if _, ok := source.Columns[name]; ok {
+			return nil, fmt.Errorf("Duplicate CSV column %q", name)
+		}
+		source.Columns[name] = i
+	}
+	for _, field := range t.Fields() {
+		if _, ok := source.Columns[field.Name]; field.Required && !ok {
+			return nil, fmt.Errorf("Missing CSV column %q", field.Name)
+		}
+	}
+
+	// Read the data rows
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid CSV file: %v", err)
+		}
+		source.Rows = append(source.Rows, record)
+		if len(source.Rows) > MaxBatchRows {
+			return nil, fmt.Errorf("Too many CSV rows: maximum is %d", MaxBatchRows)
+		}
+	}
+	if len(source.Rows) == 0 {
+		return nil, errors.New("CSV file has no data rows")
+	}
+	return source, nil
+}
+
+// get returns a field getter for a data row.
+func (s *batchSource) get(row []string) fieldGetter {
+	return func(name string) string {
+		if i, ok := s.Columns[name]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+}
+
+// batchFileName returns the deterministic name of a row's file: the 1-based row number,
+// followed by the filename column reduced to safe characters, if present.
+func batchFileName(row int, name, format string) string {
+	var slug strings.Builder
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case r <= unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			slug.WriteRune(r)
+		case r == '-' || r == '_' || r == '.' || unicode.IsSpace(r):
+			if slug.Len() > 0 && !strings.HasSuffix(slug.String(), "-") {
+				slug.WriteByte('-')
+			}
+		}
+	}
+	base := fmt.Sprintf("%04d", row)
+	if s := strings.Trim(slug.String(), "-"); s != "" {
+		base += "-" + s
+	}
+	return base + "." + format
+}
+
+// validateBatchOptions checks the shared options once against the payload type, so an
+// invalid style or error correction level fails the whole batch up front instead of
+// every row.
+func validateBatchOptions(t PayloadType, options fieldGetter, customLogo image.Image) error {
+	options, err := applyRequiredECC(t, options)
+	if err != nil {
+		return err
+	}
+	if _, err := parseQROptions(options); err != nil {
+		return err
+	}
+	if customLogo != nil {
+		if _, err := parseLogoOptions(options); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeBatchZip generates a code for every row and streams them to w as a ZIP archive,
+// followed by a manifest.csv with the row number, file name, payload, error and warnings
+// of each row. Rows that fail are recorded in the manifest and skipped. It returns the number
+// of rows that failed.
+func writeBatchZip(w io.Writer, t PayloadType, source *batchSource, options fieldGetter, customLogo image.Image) (int, error) {
+	archive := zip.NewWriter(w)
+
+	var manifest strings.Builder
+	manifestWriter := csv.NewWriter(&manifest)
+	manifestWriter.Write([]string{"row", "file", "payload", "error", "warnings"})
+
+	failed := 0
+	for i, row := range source.Rows {
+		number := i + 1
+		get := source.get(row)
+		if get(EventStampField) == "" {
+			// Events are stamped with the archive's fixed time unless the row sets one, so
+			// the same CSV always produces the same archive
+			get = withField(get, EventStampField, batchModified.Format(time.RFC3339))
+		}
+		var rowWarnings []string
+		if i < len(source.Warnings) {
+			rowWarnings = source.Warnings[i]
+		}
+
+		// Generate the code, recording failures in the manifest
+		result, err := generatePayloadQRCode(t, get, options, customLogo)
+		if err != nil {
+			var genErr *generateError
+			message := err.Error()
+			if errors.As(err, &genErr) {
+				message = genErr.Message
+			}
+			manifestWriter.Write([]string{strconv.Itoa(number), "", "", message, strings.Join(rowWarnings, "; ")})
+			failed++
+			continue
+		}
+
+		// Add the image to the archive. PNG and PDF data is already compressed.
+		name := batchFileName(number, get(BatchFilenameColumn), result.Options.Format)
+		method := zip.Store
+		if result.Options.Format == FormatSVG {
+			method = zip.Deflate
+		}
+		file, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: method, Modified: batchModified})
+		if err != nil {
+			return failed, err
+		}
+		if _, err := file.Write(result.Data); err != nil {
+			return failed, err
+		}
+		warnings := append(result.Warnings, rowWarnings...)
+		manifestWriter.Write([]string{strconv.Itoa(number), name, result.Payload, "", strings.Join(warnings, "; ")})
+	}
+
+	// Add the manifest last, once every row has been processed
+	manifestWriter.Flush()
+	file, err := archive.CreateHeader(&zip.FileHeader{Name: BatchManifestName, Method: zip.Deflate, Modified: batchModified})
+	if err != nil {
+		return failed, err
+	}
+	if _, err := io.WriteString(file, manifest.String()); err != nil {
+		return failed, err
+	}
+	return failed, archive.Close()
+}
+
+func batchQRCodeHandler(w http.ResponseWriter, r *http.Request) {
+	// Check if the request method is POST, otherwise return an error
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		log.Printf("batchQRCodeHandler: Method not allowed")
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, MaxBatchUploadBytes)
+
+	// Look up the payload type
+	payloadType, ok := lookupPayloadType(strings.ToLower(r.FormValue("type")))
+	if !ok {
+		http.Error(w, "Invalid type", http.StatusBadRequest)
+		log.Printf("batchQRCodeHandler: Invalid type %q", r.FormValue("type"))
+		return
+	}
+
+	// Read the uploaded CSV file
+	csvFile, _, err := r.FormFile("csv")
+	if err != nil {
+		http.Error(w, "Missing CSV file", http.StatusBadRequest)
+		log.Printf("batchQRCodeHandler: Missing CSV file - %v", err)
+		return
+	}
+	defer csvFile.Close()
+	source, err := readBatchCSV(payloadType, csvFile)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		log.Printf("batchQRCodeHandler: %v", err)
+		return
+	}
+
+	// Decode the uploaded logo, if any
+	var customLogo image.Image
+	file, _, err := r.FormFile("image")
+	if err != nil && err != http.ErrMissingFile {
+		http.Error(w, "Error reading image", http.StatusBadRequest)
+		log.Printf("batchQRCodeHandler: Error reading image - %v", err)
+		return
+	}
+	if file != nil {
+		defer file.Close()
+		customLogo, err = decodeImage(file)
+		if err != nil {
+			http.Error(w, "Failed to decode image", http.StatusBadRequest)
+			log.Printf("batchQRCodeHandler: Failed to decode image - %v", err)
+			return
+		}
+	}
+
+	// Validate the shared options before streaming the archive
+	if err := validateBatchOptions(payloadType, r.FormValue, customLogo); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		log.Printf("batchQRCodeHandler: %v", err)
+		return
+	}
+
+	// Stream the ZIP archive
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-qr-codes.zip"`, payloadType.Name()))
+	failed, err := writeBatchZip(w, payloadType, source, r.FormValue, customLogo)
+	if err != nil {
+		log.Printf("batchQRCodeHandler: Failed to write ZIP archive - %v", err)
+		return
+	}
+	log.Printf("batchQRCodeHandler: Generated %d of %d %s codes", len(source.Rows)-failed, len(source.Rows), payloadType.Name())
+}
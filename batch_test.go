@@ -0,0 +1,208 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+)
+
+// checkError reports whether err matches want: nil for "", or an error containing want.
+func checkError(err error, want string) bool {
+	if want == "" {
+		return err == nil
+	}
+	return err != nil && strings.Contains(err.Error(), want)
+}
+
+// fields returns a getter over a map of field values.
+func fields(values map[string]string) fieldGetter {
+	return func(name string) string {
+		return values[name]
+	}
+}
+
+func TestReadBatchCSV(t *testing.T) {
+	urlType, _ := lookupPayloadType("url")
+	tests := []struct {
+		name    string
+		csv     string
+		rows    int
+		wantErr string
+	}{
+		{"valid", "url,filename\nhttps://a.example,A\nhttps://b.example,B\n", 2, ""},
+		{"byte order mark", "\ufeffurl\nhttps://a.example\n", 1, ""},
+		{"padded header", " url , filename\nhttps://a.example,A\n", 1, ""},
+		{"short row", "url,filename\nhttps://a.example\n", 1, ""},
+		{"empty", "", 0, "Empty CSV file"},
+		{"header only", "url\n", 0, "CSV file has no data rows"},
+		{"unknown column", "url,colour\nhttps://a.example,red\n", 0, `Unknown CSV column "colour" for type url`},
+		{"duplicate column", "url,url\na,b\n", 0, `Duplicate CSV column "url"`},
+		{"missing required column", "filename\nA\n", 0, `Missing CSV column "url"`},
+		{"bad quoting", "url\n\"https://a.example\n", 0, "Invalid CSV file"},
+		{"too many rows", "url\n" + strings.Repeat("https://a.example\n", MaxBatchRows+1), 0, "Too many CSV rows"},
+	}
+	for _, tt := range tests {
+		source, err := readBatchCSV(urlType, strings.NewReader(tt.csv))
+		if !checkError(err, tt.wantErr) {
+			t.Errorf("%s: readBatchCSV error = %v, want %q", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err == nil && len(source.Rows) != tt.rows {
+			t.Errorf("%s: got %d rows, want %d", tt.name, len(source.Rows), tt.rows)
+		}
+	}
+}
+
+func TestBatchSourceGet(t *testing.T) {
+	urlType, _ := lookupPayloadType("url")
+	source, err := readBatchCSV(urlType, strings.NewReader("filename,url\nA,  https://a.example \nB\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := source.get(source.Rows[0])
+	if got := get("url"); got != "https://a.example" {
+		t.Errorf("url = %q, want trimmed value", got)
+	}
+	if got := get("missing"); got != "" {
+		t.Errorf("missing column = %q, want empty", got)
+	}
+	if got := source.get(source.Rows[1])("url"); got != "" {
+		t.Errorf("short row url = %q, want empty", got)
+	}
+}
+
+func TestBatchFileName(t *testing.T) {
+	tests := []struct {
+		row    int
+		name   string
+		format string
+		want   string
+	}{
+		{1, "", "png", "0001.png"},
+		{12, "Alice", "svg", "0012-alice.svg"},
+		{3, "Jane Doe", "png", "0003-jane-doe.png"},
+		{4, "  a -- b__c. ", "pdf", "0004-a-b-c.pdf"},
+		{5, "../../etc/passwd", "png", "0005-etcpasswd.png"},
+		{6, "Zürich Café", "png", "0006-zrich-caf.png"},
+		{7, "***", "png", "0007.png"},
+		{10000, "x", "png", "10000-x.png"},
+	}
+	for _, tt := range tests {
+		if got := batchFileName(tt.row, tt.name, tt.format); got != tt.want {
+			t.Errorf("batchFileName(%d, %q, %q) = %q, want %q", tt.row, tt.name, tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestWriteBatchZip(t *testing.T) {
+	urlType, _ := lookupPayloadType("url")
+	source, err := readBatchCSV(urlType, strings.NewReader("url,filename\nhttps://a.example,A\n,Empty\nhttps://b.example,\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := fields(map[string]string{"size": "256"})
+
+	// The same CSV produces byte-identical archives
+	var first, second bytes.Buffer
+	failed, err := writeBatchZip(&first, urlType, source, options, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failed != 1 {
+		t.Errorf("failed = %d, want 1", failed)
+	}
+	if _, err := writeBatchZip(&second, urlType, source, options, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first.Bytes(), second.Bytes()) {
+		t.Error("archives differ between runs")
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(first.Bytes()), int64(first.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, file := range archive.File {
+		names = append(names, file.Name)
+	}
+	if want := "0001-a.png,0003.png," + BatchManifestName; strings.Join(names, ",") != want {
+		t.Errorf("files = %v, want %s", names, want)
+	}
+
+	// The manifest records the failed row and skips its file
+	manifestFile, err := archive.Open(BatchManifestName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manifestFile.Close()
+	records, err := csv.NewReader(manifestFile).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("manifest has %d records, want 4", len(records))
+	}
+	if got := records[1]; got[1] != "0001-a.png" || got[2] != "https://a.example" || got[3] != "" {
+		t.Errorf("row 1 = %v", got)
+	}
+	if got := records[2]; got[0] != "2" || got[1] != "" || got[3] != "Missing URL" {
+		t.Errorf("row 2 = %v", got)
+	}
+}
+
+func TestWriteBatchZipEventStamp(t *testing.T) {
+	eventType, _ := lookupPayloadType("event")
+	source, err := readBatchCSV(eventType, strings.NewReader(
+		"eventName,startDateTime,endDateTime,dtstamp\nA,2026-11-02T09:00,2026-11-02T10:00,\nB,2026-11-02T09:00,2026-11-02T10:00,2026-10-16T12:00Z\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var archive bytes.Buffer
+	if _, err := writeBatchZip(&archive, eventType, source, fields(map[string]string{"size": "256", "verify": "false"}), nil); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := zip.NewReader(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifestFile, err := reader.Open(BatchManifestName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manifestFile.Close()
+	records, err := csv.NewReader(manifestFile).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rows without a stamp get the archive's fixed time, the others keep their own
+	for i, want := range []string{"DTSTAMP:19800101T000000Z", "DTSTAMP:20261016T120000Z"} {
+		if payload := records[i+1][2]; !strings.Contains(payload, want) {
+			t.Errorf("row %d payload = %q, want %s", i+1, payload, want)
+		}
+	}
+}
+
+func TestValidateBatchOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		t       string
+		options map[string]string
+		wantErr string
+	}{
+		{"valid", "url", map[string]string{"size": "256"}, ""},
+		{"missing size", "url", map[string]string{}, "Missing size"},
+		{"invalid size", "url", map[string]string{"size": "7"}, "Invalid size"},
+		{"required level", "sepa", map[string]string{"size": "256", "ecc": "m"}, ""},
+		{"other level", "sepa", map[string]string{"size": "256", "ecc": "H"}, `Invalid ecc level "H": sepa codes require level M`},
+	}
+	for _, tt := range tests {
+		payloadType, _ := lookupPayloadType(tt.t)
+		if err := validateBatchOptions(payloadType, fields(tt.options), nil); !checkError(err, tt.wantErr) {
+			t.Errorf("%s: validateBatchOptions = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// cliOption is a shared QR code option exposed as a command-line flag.
+type cliOption struct {
+	Name    string
+	Default string
+	Usage   string
+}
+
+// cliOptions lists the styling and output options accepted by "qr generate", using
+// the same names as the form fields.
+var cliOptions = []cliOption{
+	{"size", strconv.Itoa(QRLarge), fmt.Sprintf("Image size in pixels (%d to %d)", MinQRCodeSize, MaxQRCodeSize)},
+	{"moduleSize", "", "Pixels per module, replacing --size for perfectly aligned modules"},
+	{"margin", "", fmt.Sprintf("Quiet zone width in modules (default %d)", QuietZone)},
+	{"ecc", "", "Error correction level: L, M, Q or H"},
+	{"format", FormatPNG, "Output format: png, svg or pdf"},
+	{"foreground", "", "Module colour"},
+	{"background", "", "Background colour"},
+	{"moduleShape", "", "Module shape: square, dot, rounded or liquid"},
+	{"eyeOuterShape", "", "Outer eye shape: square, rounded or circle"},
+	{"eyeInnerShape", "", "Inner eye shape: square, rounded or circle"},
+	{"eyeOuterColor", "", "Outer eye colour"},
+	{"eyeInnerColor", "", "Inner eye colour"},
+	{"frame", "", "Frame template: none, box, banner or bubble"},
+	{"caption", "", "Caption text, such as \"Scan me\""},
+	{"captionPosition", "", "Caption position: below or above"},
+	{"frameColor", "", "Frame colour (default the module colour)"},
+	{"captionColor", "", "Caption colour"},
+	{"fontSize", "", "Caption font size in pixels, or points for PDF output"},
+	{"sizeMM", "", "PDF code size in millimetres"},
+	{"dpi", "", "PDF logo resolution"},
+	{"bleedMM", "", "PDF bleed in millimetres"},
+	{"cropMarks", "", "Draw PDF crop marks (true or false)"},
+	{"logoWidthPercent", "", "Width of the --logo image relative to the code, 0 to 1"},
+	{"logoOpacity", "", "Opacity of the --logo image, 0 to 1"},
+	{"verify", "true", "Decode the generated image and fail if it does not scan"},
+	{"autoShrinkLogo", "", "Shrink the logo until the code scans (true or false)"},
+}
+
+// runCLI runs a subcommand and returns the process exit code. Without a subcommand
+// the web server is started, as before the command-line mode existed.
+func runCLI(args []string, stdout, stderr io.Writer) int {
+	command := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	switch command {
+	case "serve":
+		return runServe(args, stderr)
+	case "generate":
+		return runGenerate(args, stdout, stderr)
+	case "batch":
+		return runBatch(args, stderr)
+	case "decode":
+		return runDecode(args, stdout, stderr)
+	case "types":
+		return runTypes(stdout)
+	case "help":
+		printUsage(stdout)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "qr: unknown command %q\n", command)
+		printUsage(stderr)
+		return 2
+	}
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage:")
+	fmt.Fprintln(w, "  qr serve [--addr :5555]                          Start the web server")
+	fmt.Fprintln(w, "  qr generate --type <type> [fields] --out <file>  Generate a QR code")
+	fmt.Fprintln(w, "  qr batch --type <type> --csv <file> --out <zip>  Generate a ZIP of codes from a CSV file")
+	fmt.Fprintln(w, "  qr decode [--json] <image>...                    Print the contents of the QR codes in images")
+	fmt.Fprintln(w, "  qr types                                         List the QR code types and their fields")
+	fmt.Fprintln(w, "Run \"qr generate --type <type> --help\" for the fields and options of a type.")
+}
+
+// runServe starts the web server.
+func runServe(args []string, stderr io.Writer) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	addr := fs.String("addr", ":5555", "Address to listen on")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if err := serve(*addr); err != nil {
+		fmt.Fprintf(stderr, "qr: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// runTypes lists the registered payload types and their fields.
+func runTypes(stdout io.Writer) int {
+	for _, name := range payloadTypeNames() {
+		t, _ := lookupPayloadType(name)
+		fields := make([]string, 0, len(t.Fields()))
+		for _, field := range t.Fields() {
+			if field.Required {
+				fields = append(fields, "--"+field.Name+"*")
+			} else {
+				fields = append(fields, "--"+field.Name)
+			}
+		}
+		fmt.Fprintf(stdout, "%-10s %s\n", name, strings.Join(fields, " "))
+	}
+	fmt.Fprintln(stdout, "Fields marked * are required.")
+	return 0
+}
+
+// runGenerate generates a single QR code through the shared pipeline and writes it to a file.
+func runGenerate(args []string, stdout, stderr io.Writer) int {
+	// The fields depend on the type, so find it before defining the flags
+	typeName := cliFlagValue(args, "type")
+
+	fs := flag.NewFlagSet("generate", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	out := fs.String("out", "", "Output file, or - for standard output")
+	logoPath := addCLIOptionFlags(fs)
+
+	// Look up the type
+	payloadType, ok := lookupCLIType(typeName, stderr)
+	if !ok {
+		return 2
+	}
+
+	// Add the type's fields, skipping names already taken by the shared options
+	for _, field := range payloadType.Fields() {
+		if fs.Lookup(field.Name) != nil {
+			continue
+		}
+		usage := field.Label
+		if field.Required {
+			usage += " (required)"
+		}
+		fs.String(field.Name, "", usage)
+	}
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	// Validate the output file
+	if *out == "" {
+		fmt.Fprintln(stderr, "qr: Missing --out")
+		return 2
+	}
+
+	// Read the flags through the same field getter as the form handlers
+	get := cliFlagGetter(fs)
+
+	// Load the custom logo, if any
+	customLogo, err := loadCLILogo(*logoPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "qr: %v\n", err)
+		return 1
+	}
+
+	// Generate the QR code
+	result, err := generatePayloadQRCode(payloadType, get, get, customLogo)
+	if err != nil {
+		fmt.Fprintf(stderr, "qr: %v\n", err)
+		return 1
+	}
+
+	// Report options that may make the code harder to scan
+	for _, warning := range result.Warnings {
+		fmt.Fprintf(stderr, "qr: warning: %s\n", warning)
+	}
+
+	// Write the image to the output file or standard output
+	if *out == "-" {
+		_, err = stdout.Write(result.Data)
+	} else {
+		err = os.WriteFile(*out, result.Data, 0o644)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "qr: Failed to write QR code - %v\n", err)
+		return 1
+	}
+	if *out != "-" {
+		size := ""
+		if result.Width > 0 && result.Height != result.Width {
+			size = fmt.Sprintf(", %dx%dpx", result.Width, result.Height)
+		} else if result.Width > 0 {
+			size = fmt.Sprintf(", %dpx", result.Width)
+		}
+		fmt.Fprintf(stderr, "Wrote %s (version %d, ECC %s%s, verified %t)\n", *out, result.Code.VersionNumber, eccLevelName(result.Code.Level), size, result.Verified)
+		for _, variant := range result.Variants {
+			fmt.Fprintf(stderr, "  as %s: version %d, %d bytes\n", variant.Format, variant.Version, variant.Length)
+		}
+	}
+	return 0
+}
+
+// runBatch generates a ZIP archive of codes from a CSV file, one code per row.
+func runBatch(args []string, stderr io.Writer) int {
+	fs := flag.NewFlagSet("batch", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	csvPath := fs.String("csv", "", "CSV file with a header row of field names and one code per row")
+	out := fs.String("out", "", "Output ZIP file")
+	logoPath := addCLIOptionFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	// Validate the type, CSV file and output file
+	payloadType, ok := lookupCLIType(cliFlagGetter(fs)("type"), stderr)
+	if !ok {
+		return 2
+	}
+	if *csvPath == "" || *out == "" {
+		fmt.Fprintln(stderr, "qr: Missing --csv or --out")
+		return 2
+	}
+
+	// Read the CSV file
+	csvFile, err := os.Open(*csvPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "qr: %v\n", err)
+		return 1
+	}
+	source, err := readBatchCSV(payloadType, csvFile)
+	csvFile.Close()
+	if err != nil {
+		fmt.Fprintf(stderr, "qr: %v\n", err)
+		return 1
+	}
+
+	// Load the custom logo and validate the shared options
+	customLogo, err := loadCLILogo(*logoPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "qr: %v\n", err)
+		return 1
+	}
+	options := cliFlagGetter(fs)
+	if err := validateBatchOptions(payloadType, options, customLogo); err != nil {
+		fmt.Fprintf(stderr, "qr: %v\n", err)
+		return 1
+	}
+
+	// Write the ZIP archive
+	zipFile, err := os.Create(*out)
+	if err != nil {
+		fmt.Fprintf(stderr, "qr: %v\n", err)
+		return 1
+	}
+	failed, err := writeBatchZip(zipFile, payloadType, source, options, customLogo)
+	if closeErr := zipFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "qr: Failed to write ZIP archive - %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(stderr, "Wrote %s (%d of %d codes, see %s for errors)\n", *out, len(source.Rows)-failed, len(source.Rows), BatchManifestName)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// runDecode prints the payload of every QR code found in the given images, or the same
+// JSON as the decode endpoint with --json.
+func runDecode(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("decode", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	asJSON := fs.Bool("json", false, "Print the codes, their details and interpreted fields as JSON")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintln(stderr, "qr: Missing image file")
+		return 2
+	}
+
+	status := 0
+	for _, path := range fs.Args() {
+		// Read and decode the image, moving on to the next file on failure
+		img, err := loadCLIImage(path)
+		if err == nil {
+			var response *decodeResponse
+			if response, err = decodeQRImage(img); err == nil {
+				if *asJSON {
+					encoder := json.NewEncoder(stdout)
+					encoder.SetIndent("", "  ")
+					err = encoder.Encode(response)
+				} else {
+					for _, code := range response.Codes {
+						fmt.Fprintln(stdout, code.Payload)
+					}
+				}
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "qr: %s: %v\n", path, err)
+			status = 1
+		}
+	}
+	return status
+}
+
+// addCLIOptionFlags defines the --type and --logo flags and the shared options on a
+// flag set, returning the logo path.
+func addCLIOptionFlags(fs *flag.FlagSet) *string {
+	fs.String("type", "", "QR code type: "+strings.Join(payloadTypeNames(), ", "))
+	logoPath := fs.String("logo", "", "Logo image file replacing the type's default logo")
+	for _, option := range cliOptions {
+		fs.String(option.Name, option.Default, option.Usage)
+	}
+	return logoPath
+}
+
+// lookupCLIType finds the payload type named by --type, reporting a missing or unknown type.
+func lookupCLIType(name string, stderr io.Writer) (PayloadType, bool) {
+	payloadType, ok := lookupPayloadType(strings.ToLower(name))
+	if !ok {
+		if name == "" {
+			fmt.Fprintln(stderr, "qr: Missing --type")
+		} else {
+			fmt.Fprintf(stderr, "qr: Unknown type %q\n", name)
+		}
+		fmt.Fprintf(stderr, "Types: %s\n", strings.Join(payloadTypeNames(), ", "))
+	}
+	return payloadType, ok
+}
+
+// cliFlagGetter reads flags through a field getter, so the CLI shares the form validation.
+func cliFlagGetter(fs *flag.FlagSet) fieldGetter {
+	return func(name string) string {
+		if f := fs.Lookup(name); f != nil {
+			return f.Value.String()
+		}
+		return ""
+	}
+}
+
+// loadCLILogo decodes a logo file, returning nil when no path is given.
+func loadCLILogo(path string) (image.Image, error) {
+	if path == "" {
+		return nil, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	img, err := decodeImage(file)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode logo - %v", err)
+	}
+	return img, nil
+}
+
+// loadCLIImage reads and decodes an image file.
+func loadCLIImage(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return decodeImage(file)
+}
+
+// cliFlagValue returns the value of a string flag given as -name value, --name value,
+// -name=value or --name=value, or "" when it is absent.
+func cliFlagValue(args []string, name string) string {
+	for i, arg := range args {
+		trimmed := strings.TrimLeft(arg, "-")
+		if trimmed == arg || len(arg)-len(trimmed) > 2 {
+			continue
+		}
+		if trimmed == name && i+1 < len(args) {
+			return args[i+1]
+		}
+		if strings.HasPrefix(trimmed, name+"=") {
+			return trimmed[len(name)+1:]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// MinContrastRatio is the lowest luminance contrast between the foreground and background
+// colours accepted for a QR code, matching the WCAG AA threshold for text.
+const MinContrastRatio = 4.5
+
+var (
+	// Default QR code colours
+	defaultForeground = color.NRGBA{0, 0, 0, 0xff}
+	defaultBackground = color.NRGBA{0xff, 0xff, 0xff, 0xff}
+)
+
+// parseColor parses a colour given as hex (#RGB, #RGBA, #RRGGBB or #RRGGBBAA, the # being
+// optional), as rgb(r, g, b) or rgba(r, g, b, a) with alpha between 0 and 1, or as "transparent".
+func parseColor(value string) (color.NRGBA, error) {
+	v := strings.ToLower(strings.TrimSpace(value))
+	if v == "transparent" {
+		return color.NRGBA{}, nil
+	}
+
+	// Functional rgb() and rgba() notation
+	if strings.HasPrefix(v, "rgb") {
+		open := strings.IndexByte(v, '(')
+		if open < 0 || !strings.HasSuffix(v, ")") {
+			return color.NRGBA{}, fmt.Errorf("invalid colour %q", value)
+		}
+		fn := v[:open]
+		parts := strings.Split(v[open+1:len(v)-1], ",")
+		if (fn != "rgb" || len(parts) != 3) && (fn != "rgba" || len(parts) != 4) {
+			return color.NRGBA{}, fmt.Errorf("invalid colour %q", value)
+		}
+		var channels [3]uint8
+		for i := range channels {
+			n, err := strconv.Atoi(strings.TrimSpace(parts[i]))
+			if err != nil || n < 0 || n > 255 {
+				return color.NRGBA{}, fmt.Errorf("invalid colour %q", value)
+			}
+			channels[i] = uint8(n)
+		}
+		alpha := 1.0
+		if len(parts) == 4 {
+			a, err := strconv.ParseFloat(strings.TrimSpace(parts[3]), 64)
+			if err != nil || a < 0 || a > 1 {
+				return color.NRGBA{}, fmt.Errorf("invalid colour %q", value)
+			}
+			alpha = a
+		}
+		return color.NRGBA{channels[0], channels[1], channels[2], uint8(math.Round(alpha * 255))}, nil
+	}
+
+	// Hex notation, expanding the short forms
+	hex := strings.TrimPrefix(v, "#")
+	if len(hex) == 3 || len(hex) == 4 {
+		var long strings.Builder
+		for _, c := range hex {
+			long.WriteRune(c)
+			long.WriteRune(c)
+		}
+		hex = long.String()
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	if len(hex) != 8 {
+		return color.NRGBA{}, fmt.Errorf("invalid colour %q", value)
+	}
+	n, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("invalid colour %q", value)
+	}
+	return color.NRGBA{uint8(n >> 24), uint8(n >> 16), uint8(n >> 8), uint8(n)}, nil
+}
+
+// contrastRatio returns the WCAG contrast ratio between a foreground and background colour.
+// Translucent colours are composited first: the background over white, as a transparent
+// code is usually shown on a light surface, and the foreground over the result.
+func contrastRatio(fg, bg color.NRGBA) float64 {
+	white := color.NRGBA{0xff, 0xff, 0xff, 0xff}
+	bg = compositeOver(bg, white)
+	fg = compositeOver(fg, bg)
+
+	l1, l2 := relativeLuminance(fg), relativeLuminance(bg)
+	if l1 < l2 {
+		l1, l2 = l2, l1
+	}
+	return (l1 + 0.05) / (l2 + 0.05)
+}
+
+// compositeOver blends a translucent colour over an opaque one.
+func compositeOver(top, bottom color.NRGBA) color.NRGBA {
+	a := float64(top.A) / 255
+	blend := func(t, b uint8) uint8 {
+		return uint8(math.Round(float64(t)*a + float64(b)*(1-a)))
+	}
+	return color.NRGBA{blend(top.R, bottom.R), blend(top.G, bottom.G), blend(top.B, bottom.B), 0xff}
+}
+
+// relativeLuminance computes the WCAG relative luminance of an opaque sRGB colour.
+func relativeLuminance(c color.NRGBA) float64 {
+	linear := func(v uint8) float64 {
+		s := float64(v) / 255
+		if s <= 0.03928 {
+			return s / 12.92
+		}
+		return math.Pow((s+0.055)/1.055, 2.4)
+	}
+	return 0.2126*linear(c.R) + 0.7152*linear(c.G) + 0.0722*linear(c.B)
+}
+
+// hexColor formats the RGB channels of a colour as #rrggbb.
+func hexColor(c color.NRGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// colorAlpha returns the opacity of a colour between 0 and 1.
+func colorAlpha(c color.NRGBA) float64 {
+	return float64(c.A) / 255
+}
@@ -0,0 +1,552 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxDecodeUploadBytes limits the size of an image uploaded for decoding
+const MaxDecodeUploadBytes = 16 << 20
+
+// errNoQRCodeInImage reports an image in which no QR code could be decoded.
+var errNoQRCodeInImage = errors.New("No QR code found in the image")
+
+// decodeResponse is the JSON body returned by the decode endpoint.
+type decodeResponse struct {
+	Codes []decodedCode `json:"codes"`
+}
+
+// decodedCode describes one QR code found in an image. Type and Fields interpret the
+// payload with the field names of the matching generator, when it is recognised.
+type decodedCode struct {
+	Payload   string            `json:"payload"`
+	Version   int               `json:"version"`   // QR code version, 1 to 40
+	ECC       string            `json:"ecc"`       // Error correction level of the symbol
+	Corrected int               `json:"corrected"` // Codewords repaired by error correction
+	Bounds    decodedBounds     `json:"bounds"`    // Position of the symbol in the image, in pixels
+	Type      string            `json:"type,omitempty"`
+	Fields    map[string]string `json:"fields,omitempty"`
+}
+
+type decodedBounds struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// decodeQRImage decodes every QR code in an image and interprets their payloads.
+func decodeQRImage(img image.Image) (*decodeResponse, error) {
+	codes, err := decodeQRCodes(img)
+	if err != nil || len(codes) == 0 {
+		return nil, errNoQRCodeInImage
+	}
+	response := &decodeResponse{Codes: make([]decodedCode, 0, len(codes))}
+	for _, code := range codes {
+		decoded := decodedCode{
+			Payload:   code.Payload,
+			Version:   code.Version,
+			ECC:       code.ECC,
+			Corrected: code.Corrected,
+			Bounds: decodedBounds{
+				X:      code.Bounds.Min.X,
+				Y:      code.Bounds.Min.Y,
+				Width:  code.Bounds.Dx(),
+				Height: code.Bounds.Dy(),
+			},
+		}
+		decoded.Type, decoded.Fields = interpretPayload(code.Payload)
+		response.Codes = append(response.Codes, decoded)
+	}
+	return response, nil
+}
+
+// interpretPayload recognises the payload formats produced by the generators and
+// returns the payload type name with its fields, or "" for plain text.
+func interpretPayload(payload string) (string, map[string]string) {
+	upper := strings.ToUpper(payload)
+	switch {
+	case strings.HasPrefix(upper, "WIFI:"):
+		return "wifi", parseWiFiPayload(payload[len("WIFI:"):])
+	case strings.HasPrefix(upper, "BEGIN:VCARD"):
+		return "vcard", parseVCardPayload(payload)
+	case strings.HasPrefix(upper, "BCD\n") || strings.HasPrefix(upper, "BCD\r\n"):
+		if fields := parseEPCPayload(payload); fields != nil {
+			return "sepa", fields
+		}
+	case strings.HasPrefix(upper, "SPC\n") || strings.HasPrefix(upper, "SPC\r\n"):
+		if fields := parseSwissQRPayload(payload); fields != nil {
+			return "swissqr", fields
+		}
+	case strings.HasPrefix(payload, emvPayloadFormat+"0201"):
+		if name, fields := parseEMVPayload(payload); fields != nil {
+			return name, fields
+		}
+	case strings.HasPrefix(upper, "UPI://PAY?"):
+		return "upi", parseUPIPayload(payload)
+	case strings.HasPrefix(upper, "MECARD:"):
+		return "vcard", parseMeCardPayload(payload[len("MECARD:"):])
+	case strings.HasPrefix(upper, "GEO:"):
+		if fields := parseGeoPayload(payload[len("geo:"):]); fields != nil {
+			return "map", fields
+		}
+	case strings.HasPrefix(upper, "HTTP://") || strings.HasPrefix(upper, "HTTPS://"):
+		if u, err := url.Parse(payload); err == nil && u.Host != "" {
+			return "url", map[string]string{"url": payload}
+		}
+	}
+	return "", nil
+}
+
+// parseWiFiPayload splits the body of a WIFI: payload into its fields, honouring
+// backslash escapes of the special characters. The T value is mapped back to the
+// security type of the wifi generator.
+func parseWiFiPayload(body string) map[string]string {
+	fields := map[string]string{}
+	keys := map[string]string{
+		"T": "security", "S": "ssid", "P": "password", "H": "hidden",
+		"E": "eapMethod", "I": "identity", "A": "anonymousIdentity", "PH2": "phase2",
+	}
+	for _, part := range splitEscaped(body, ';') {
+		key, value, ok := strings.Cut(part, ":")
+		if name, known := keys[strings.ToUpper(key)]; ok && known {
+			fields[name] = unescapeBackslashes(value, false)
+		}
+	}
+	if strings.EqualFold(fields["security"], "SAE") {
+		fields["security"] = WiFiWPA3
+	}
+	return fields
+}
+
+// parseVCardPayload reads the properties written by vCard.String from a vCard 3.0 or
+// 4.0, mapping them back to the fields of the vcard generator.
+func parseVCardPayload(payload string) map[string]string {
+	fields := map[string]string{}
+
+	// Unfold continuation lines, which start with a space or a tab
+	payload = strings.ReplaceAll(payload, "\r\n", "\n")
+	payload = strings.ReplaceAll(payload, "\n ", "")
+	payload = strings.ReplaceAll(payload, "\n\t", "")
+
+	var phones, emails []string
+	for _, line := range strings.Split(payload, "\n") {
+		property, value, ok := strings.Cut(line, ":")
+		if !ok || value == "" {
+			continue
+		}
+		params := strings.Split(strings.ToUpper(property), ";")
+		switch params[0] {
+		case "N":
+			names := splitEscaped(value, ';')
+			fields["lastName"] = unescapeBackslashes(names[0], true)
+			if len(names) > 1 {
+				fields["firstName"] = unescapeBackslashes(names[1], true)
+			}
+		case "FN":
+			// Only used when the card has no structured name or company
+			if _, ok := fields["lastName"]; !ok {
+				fields["firstName"] = unescapeBackslashes(value, true)
+			}
+		case "TEL":
+			// The first cell and work numbers fill mobile and phone, the rest are listed
+			typ := vCardParamType(params, vCardPhoneTypes)
+			switch {
+			case typ == "cell" && fields["mobile"] == "":
+				fields["mobile"] = unescapeBackslashes(value, true)
+			case (typ == "" || typ == "work" || typ == "voice") && fields["phone"] == "":
+				fields["phone"] = unescapeBackslashes(value, true)
+			default:
+				phones = append(phones, vCardListEntry(typ, unescapeBackslashes(value, true)))
+			}
+		case "EMAIL":
+			if fields["email"] == "" {
+				fields["email"] = unescapeBackslashes(value, true)
+			} else {
+				emails = append(emails, vCardListEntry(vCardParamType(params, vCardEmailTypes), unescapeBackslashes(value, true)))
+			}
+		case "ADR":
+			// Read the street, city, region, postal code and country components
+			parts := splitEscaped(value, ';')
+			for i, name := range []string{"", "", "street", "city", "region", "postalCode", "country"} {
+				if name != "" && i < len(parts) && parts[i] != "" {
+					fields[name] = unescapeBackslashes(parts[i], true)
+				}
+			}
+		case "ORG":
+			fields["company"] = unescapeBackslashes(splitEscaped(value, ';')[0], true)
+		case "BDAY":
+			fields["birthday"] = vCardExtendedDate(value)
+		case "GEO":
+			// 3.0 writes latitude;longitude, 4.0 a geo: URI
+			fields["geo"] = strings.Replace(strings.TrimPrefix(value, "geo:"), ";", ",", 1)
+		case "TITLE", "URL", "ROLE", "LANG", "NOTE":
+			fields[strings.ToLower(params[0])] = unescapeBackslashes(value, true)
+		}
+	}
+	if fields["company"] != "" && fields["firstName"] == fields["company"] && fields["lastName"] == "" {
+		// The formatted name of an organisation's card is its company name
+		delete(fields, "firstName")
+	}
+	if len(phones) > 0 {
+		fields["phones"] = strings.Join(phones, ", ")
+	}
+	if len(emails) > 0 {
+		fields["emails"] = strings.Join(emails, ", ")
+	}
+	return fields
+}
+
+// parseEPCPayload reads the elements of an EPC069-12 SEPA credit transfer payload,
+// mapping them back to the fields of the sepa generator. It returns nil for other
+// identification codes, such as instant transfers.
+func parseEPCPayload(payload string) map[string]string {
+	lines := strings.Split(strings.ReplaceAll(payload, "\r\n", "\n"), "\n")
+	if len(lines) < 7 || lines[3] != "SCT" {
+		return nil
+	}
+	fields := map[string]string{}
+	for i, name := range []string{"", "", "", "", "bic", "name", "iban", "amount", "purpose", "reference", "remittanceText", "info"} {
+		if name != "" && i < len(lines) && lines[i] != "" {
+			fields[name] = lines[i]
+		}
+	}
+	if amount, ok := fields["amount"]; ok {
+		fields["amount"] = strings.TrimPrefix(amount, "EUR")
+	}
+	return fields
+}
+
+// parseSwissQRPayload reads the elements of a Swiss QR-bill payload with structured
+// addresses, mapping them back to the fields of the swissqr generator. It returns nil
+// for payloads with fewer elements than the version 0200 format has.
+func parseSwissQRPayload(payload string) map[string]string {
+	lines := strings.Split(strings.ReplaceAll(payload, "\r\n", "\n"), "\n")
+	if len(lines) < 31 || lines[30] != "EPD" {
+		return nil
+	}
+	names := map[int]string{
+		3: "iban", 5: "creditorName", 6: "creditorStreet", 7: "creditorBuildingNumber", 8: "creditorPostalCode",
+		9: "creditorTown", 10: "creditorCountry", 18: "amount", 19: "currency", 21: "debtorName", 22: "debtorStreet",
+		23: "debtorBuildingNumber", 24: "debtorPostalCode", 25: "debtorTown", 26: "debtorCountry",
+		28: "reference", 29: "message", 31: "billingInfo",
+	}
+	fields := map[string]string{}
+	for i, name := range names {
+		if i < len(lines) && lines[i] != "" {
+			fields[name] = lines[i]
+		}
+	}
+	return fields
+}
+
+// parseEMVPayload reads an EMVCo merchant-presented payload with a valid CRC, mapping
+// PIX and PayNow accounts to the fields of their generators and others to the fields of
+// the emvco generator. It returns nil for malformed payloads.
+func parseEMVPayload(payload string) (string, map[string]string) {
+	if len(payload) < 8 || payload[len(payload)-8:len(payload)-4] != emvCRC+"04" ||
+		fmt.Sprintf("%04X", crc16CCITT(payload[:len(payload)-4])) != strings.ToUpper(payload[len(payload)-4:]) {
+		return "", nil
+	}
+	objects := parseEMVTLV(payload)
+	if objects == nil {
+		return "", nil
+	}
+	additional := parseEMVTLV(objects[emvAdditionalData])
+	set := func(fields map[string]string, name, value string) {
+		if value != "" {
+			fields[name] = value
+		}
+	}
+
+	// Find the merchant account information, a primitive value or a template
+	var tag string
+	for id := range objects {
+		if id >= "02" && id <= "51" && (tag == "" || id < tag) {
+			tag = id
+		}
+	}
+	account := parseEMVTLV(objects[tag])
+	amount := objects[emvAmount]
+
+	switch {
+	case tag >= "26" && strings.EqualFold(account["00"], PIXGUID):
+		fields := map[string]string{}
+		set(fields, "key", account["01"])
+		set(fields, "description", account["02"])
+		set(fields, "merchantName", objects[emvName])
+		set(fields, "merchantCity", objects[emvCity])
+		set(fields, "amount", amount)
+		if txid := additional[emvReferenceLabel]; txid != "***" {
+			set(fields, "txid", txid)
+		}
+		return "pix", fields
+	case tag >= "26" && strings.EqualFold(account["00"], PayNowGUID):
+		fields := map[string]string{}
+		if account["01"] == "2" {
+			set(fields, "uen", account["02"])
+		} else {
+			set(fields, "mobile", account["02"])
+		}
+		set(fields, "merchantName", objects[emvName])
+		set(fields, "amount", amount)
+		if amount != "" && account["03"] == "0" {
+			fields["editable"] = "false"
+		}
+		if expiry, err := time.Parse("20060102", account["04"]); err == nil {
+			fields["expiry"] = expiry.Format("2006-01-02")
+		}
+		set(fields, "reference", additional[emvBillNumber])
+		return "paynow", fields
+	}
+
+	fields := map[string]string{}
+	set(fields, "merchantAccountTag", tag)
+	if tag >= "26" {
+		set(fields, "merchantAccountGUID", account["00"])
+		set(fields, "merchantAccountID", account["01"])
+	} else {
+		set(fields, "merchantAccountID", objects[tag])
+	}
+	set(fields, "merchantCategoryCode", objects[emvCategory])
+	set(fields, "currency", objects[emvCurrency])
+	set(fields, "amount", amount)
+	set(fields, "countryCode", objects[emvCountry])
+	set(fields, "merchantName", objects[emvName])
+	set(fields, "merchantCity", objects[emvCity])
+	set(fields, "postalCode", objects[emvPostalCode])
+	set(fields, "billNumber", additional[emvBillNumber])
+	set(fields, "referenceLabel", additional[emvReferenceLabel])
+	if objects[emvInitiation] == emvDynamicInitiation {
+		fields["initiation"] = "dynamic"
+	}
+	return "emvco", fields
+}
+
+// parseEMVTLV splits EMVCo data objects into their values by ID, returning nil when a
+// length is not two digits or the lengths do not add up.
+func parseEMVTLV(data string) map[string]string {
+	objects := map[string]string{}
+	for len(data) > 0 {
+		// strconv.Atoi alone would accept a sign, such as "-1"
+		if len(data) < 4 || !isDigits(data[2:4]) {
+			return nil
+		}
+		length, _ := strconv.Atoi(data[2:4])
+		if len(data) < 4+length {
+			return nil
+		}
+		objects[data[:2]] = data[4 : 4+length]
+		data = data[4+length:]
+	}
+	return objects
+}
+
+// parseUPIPayload reads the parameters of a upi://pay link, mapping them back to the
+// fields of the upi generator.
+func parseUPIPayload(payload string) map[string]string {
+	fields := map[string]string{}
+	_, query, _ := strings.Cut(payload, "?")
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return fields
+	}
+	for key, name := range map[string]string{"pa": "payeeAddress", "pn": "payeeName", "am": "amount", "tn": "note", "tr": "reference", "mc": "merchantCode"} {
+		if value := values.Get(key); value != "" {
+			fields[name] = value
+		}
+	}
+	return fields
+}
+
+// parseMeCardPayload reads the properties written by vCard.MeCard from the body of a
+// MECARD: payload, mapping them back to the fields of the vcard generator.
+func parseMeCardPayload(body string) map[string]string {
+	fields := map[string]string{"contactFormat": ContactMeCard}
+	var phones, emails []string
+	for _, part := range splitEscaped(body, ';') {
+		property, value, ok := strings.Cut(part, ":")
+		if !ok || value == "" {
+			continue
+		}
+		switch strings.ToUpper(property) {
+		case "N":
+			names := splitEscaped(value, ',')
+			fields["lastName"] = unescapeBackslashes(names[0], false)
+			if len(names) > 1 {
+				fields["firstName"] = unescapeBackslashes(names[1], false)
+			}
+		case "TEL":
+			if fields["phone"] == "" {
+				fields["phone"] = unescapeBackslashes(value, false)
+			} else {
+				phones = append(phones, unescapeBackslashes(value, false))
+			}
+		case "EMAIL":
+			if fields["email"] == "" {
+				fields["email"] = unescapeBackslashes(value, false)
+			} else {
+				emails = append(emails, unescapeBackslashes(value, false))
+			}
+		case "ADR":
+			// Structured addresses have seven components, others are read as the street
+			parts := splitEscaped(value, ',')
+			if len(parts) != 7 {
+				fields["street"] = unescapeBackslashes(value, false)
+				continue
+			}
+			for i, name := range []string{"", "", "street", "city", "region", "postalCode", "country"} {
+				if name != "" && parts[i] != "" {
+					fields[name] = unescapeBackslashes(parts[i], false)
+				}
+			}
+		case "ORG":
+			fields["company"] = unescapeBackslashes(value, false)
+		case "BDAY":
+			fields["birthday"] = vCardExtendedDate(value)
+		case "URL", "NOTE":
+			fields[strings.ToLower(property)] = unescapeBackslashes(value, false)
+		}
+	}
+	if len(phones) > 0 {
+		fields["phones"] = strings.Join(phones, ", ")
+	}
+	if len(emails) > 0 {
+		fields["emails"] = strings.Join(emails, ", ")
+	}
+	return fields
+}
+
+// vCardParamType returns the first known type among the TYPE parameters of a property,
+// in lower case, or "" when there is none.
+func vCardParamType(params []string, types map[string]bool) string {
+	for _, param := range params[1:] {
+		// 3.0 also allows types as bare parameters, such as TEL;CELL
+		param = strings.TrimPrefix(param, "TYPE=")
+		for _, typ := range strings.Split(param, ",") {
+			if typ = strings.ToLower(strings.Trim(typ, `"`)); types[typ] {
+				return typ
+			}
+		}
+	}
+	return ""
+}
+
+// vCardListEntry formats a phone number or email address for the phones and emails fields.
+func vCardListEntry(typ, value string) string {
+	if typ == "" {
+		return value
+	}
+	return typ + ":" + value
+}
+
+// vCardExtendedDate converts a 4.0 basic format date, YYYYMMDD or --MMDD, to the extended
+// format used by the birthday field, leaving other values unchanged.
+func vCardExtendedDate(value string) string {
+	switch {
+	case len(value) == 8 && !strings.Contains(value, "-"):
+		return value[:4] + "-" + value[4:6] + "-" + value[6:]
+	case len(value) == 6 && strings.HasPrefix(value, "--"):
+		return value[:4] + "-" + value[4:]
+	}
+	return value
+}
+
+// parseGeoPayload reads the latitude and longitude of a geo: URI, ignoring any altitude
+// and parameters. It returns nil when the coordinates are invalid.
+func parseGeoPayload(body string) map[string]string {
+	body, _, _ = strings.Cut(body, "?")
+	body, _, _ = strings.Cut(body, ";")
+	coords := strings.Split(body, ",")
+	if len(coords) < 2 {
+		return nil
+	}
+	fields := map[string]string{"latitude": strings.TrimSpace(coords[0]), "longitude": strings.TrimSpace(coords[1])}
+	if checkMapFields(func(name string) string { return fields[name] }) != nil {
+		return nil
+	}
+	return fields
+}
+
+// splitEscaped splits s at every sep that is not preceded by a backslash, keeping the
+// escapes in the parts.
+func splitEscaped(s string, sep byte) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// unescapeBackslashes removes backslash escapes. With newlines set, \n is a newline as
+// in vCard values.
+func unescapeBackslashes(s string, newlines bool) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			if newlines && (s[i] == 'n' || s[i] == 'N') {
+				sb.WriteByte('\n')
+				continue
+			}
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+func decodeHandler(w http.ResponseWriter, r *http.Request) {
+	// Check if the request method is POST, otherwise return an error
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		log.Printf("decodeHandler: Method not allowed")
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, MaxDecodeUploadBytes)
+
+	// Read and decode the uploaded image
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		http.Error(w, "Missing image", http.StatusBadRequest)
+		log.Printf("decodeHandler: Missing image - %v", err)
+		return
+	}
+	defer file.Close()
+	img, err := decodeImage(file)
+	if err != nil {
+		http.Error(w, "Failed to decode image", http.StatusBadRequest)
+		log.Printf("decodeHandler: Failed to decode image - %v", err)
+		return
+	}
+
+	// Find and decode the QR codes
+	response, err := decodeQRImage(img)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		log.Printf("decodeHandler: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("decodeHandler: Failed to write response - %v", err)
+	}
+}
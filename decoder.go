@@ -0,0 +1,1062 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// maxFinderCandidates limits how many finder pattern candidates are combined into symbols
+	maxFinderCandidates = 30
+
+	// formatInfoMask and versionInfoGenerator are the BCH code parameters of the format
+	// and version information.
+	formatInfoMask       = 0x5412
+	formatInfoGenerator  = 0x537
+	versionInfoGenerator = 0x1f25
+)
+
+var (
+	errNoQRCode = errors.New("no QR code found")
+
+	// eccBlocks lists, for each version and error correction level (L, M, Q, H), the error
+	// correction codewords per block, then the number of blocks and data codewords per block
+	// of the first and second block groups.
+	eccBlocks = [40][4][5]int{
+		{{7, 1, 19, 0, 0}, {10, 1, 16, 0, 0}, {13, 1, 13, 0, 0}, {17, 1, 9, 0, 0}},                // 1
+		{{10, 1, 34, 0, 0}, {16, 1, 28, 0, 0}, {22, 1, 22, 0, 0}, {28, 1, 16, 0, 0}},              // 2
+		{{15, 1, 55, 0, 0}, {26, 1, 44, 0, 0}, {18, 2, 17, 0, 0}, {22, 2, 13, 0, 0}},              // 3
+		{{20, 1, 80, 0, 0}, {18, 2, 32, 0, 0}, {26, 2, 24, 0, 0}, {16, 4, 9, 0, 0}},               // 4
+		{{26, 1, 108, 0, 0}, {24, 2, 43, 0, 0}, {18, 2, 15, 2, 16}, {22, 2, 11, 2, 12}},           // 5
+		{{18, 2, 68, 0, 0}, {16, 4, 27, 0, 0}, {24, 4, 19, 0, 0}, {28, 4, 15, 0, 0}},              // 6
+		{{20, 2, 78, 0, 0}, {18, 4, 31, 0, 0}, {18, 2, 14, 4, 15}, {26, 4, 13, 1, 14}},            // 7
+		{{24, 2, 97, 0, 0}, {22, 2, 38, 2, 39}, {22, 4, 18, 2, 19}, {26, 4, 14, 2, 15}},           // 8
+		{{30, 2, 116, 0, 0}, {22, 3, 36, 2, 37}, {20, 4, 16, 4, 17}, {24, 4, 12, 4, 13}},          // 9
+		{{18, 2, 68, 2, 69}, {26, 4, 43, 1, 44}, {24, 6, 19, 2, 20}, {28, 6, 15, 2, 16}},          // 10
+		{{20, 4, 81, 0, 0}, {30, 1, 50, 4, 51}, {28, 4, 22, 4, 23}, {24, 3, 12, 8, 13}},           // 11
+		{{24, 2, 92, 2, 93}, {22, 6, 36, 2, 37}, {26, 4, 20, 6, 21}, {28, 7, 14, 4, 15}},          // 12
+		{{26, 4, 107, 0, 0}, {22, 8, 37, 1, 38}, {24, 8, 20, 4, 21}, {22, 12, 11, 4, 12}},         // 13
+		{{30, 3, 115, 1, 116}, {24, 4, 40, 5, 41}, {20, 11, 16, 5, 17}, {24, 11, 12, 5, 13}},      // 14
+		{{22, 5, 87, 1, 88}, {24, 5, 41, 5, 42}, {30, 5, 24, 7, 25}, {24, 11, 12, 7, 13}},         // 15
+		{{24, 5, 98, 1, 99}, {28, 7, 45, 3, 46}, {24, 15, 19, 2, 20}, {30, 3, 15, 13, 16}},        // 16
+		{{28, 1, 107, 5, 108}, {28, 10, 46, 1, 47}, {28, 1, 22, 15, 23}, {28, 2, 14, 17, 15}},     // 17
+		{{30, 5, 120, 1, 121}, {26, 9, 43, 4, 44}, {28, 17, 22, 1, 23}, {28, 2, 14, 19, 15}},      // 18
+		{{28, 3, 113, 4, 114}, {26, 3, 44, 11, 45}, {26, 17, 21, 4, 22}, {26, 9, 13, 16, 14}},     // 19
+		{{28, 3, 107, 5, 108}, {26, 3, 41, 13, 42}, {30, 15, 24, 5, 25}, {28, 15, 15, 10, 16}},    // 20
+		{{28, 4, 116, 4, 117}, {26, 17, 42, 0, 0}, {28, 17, 22, 6, 23}, {30, 19, 16, 6, 17}},      // 21
+		{{28, 2, 111, 7, 112}, {28, 17, 46, 0, 0}, {30, 7, 24, 16, 25}, {24, 34, 13, 0, 0}},       // 22
+		{{30, 4, 121, 5, 122}, {28, 4, 47, 14, 48}, {30, 11, 24, 14, 25}, {30, 16, 15, 14, 16}},   // 23
+		{{30, 6, 117, 4, 118}, {28, 6, 45, 14, 46}, {30, 11, 24, 16, 25}, {30, 30, 16, 2, 17}},    // 24
+		{{26, 8, 106, 4, 107}, {28, 8, 47, 13, 48}, {30, 7, 24, 22, 25}, {30, 22, 15, 13, 16}},    // 25
+		{{28, 10, 114, 2, 115}, {28, 19, 46, 4, 47}, {28, 28, 22, 6, 23}, {30, 33, 16, 4, 17}},    // 26
+		{{30, 8, 122, 4, 123}, {28, 22, 45, 3, 46}, {30, 8, 23, 26, 24}, {30, 12, 15, 28, 16}},    // 27
+		{{30, 3, 117, 10, 118}, {28, 3, 45, 23, 46}, {30, 4, 24, 31, 25}, {30, 11, 15, 31, 16}},   // 28
+		{{30, 7, 116, 7, 117}, {28, 21, 45, 7, 46}, {30, 1, 23, 37, 24}, {30, 19, 15, 26, 16}},    // 29
+		{{30, 5, 115, 10, 116}, {28, 19, 47, 10, 48}, {30, 15, 24, 25, 25}, {30, 23, 15, 25, 16}}, // 30
+		{{30, 13, 115, 3, 116}, {28, 2, 46, 29, 47}, {30, 42, 24, 1, 25}, {30, 23, 15, 28, 16}},   // 31
+		{{30, 17, 115, 0, 0}, {28, 10, 46, 23, 47}, {30, 10, 24, 35, 25}, {30, 19, 15, 35, 16}},   // 32
+		{{30, 17, 115, 1, 116}, {28, 14, 46, 21, 47}, {30, 29, 24, 19, 25}, {30, 11, 15, 46, 16}}, // 33
+		{{30, 13, 115, 6, 116}, {28, 14, 46, 23, 47}, {30, 44, 24, 7, 25}, {30, 59, 16, 1, 17}},   // 34
+		{{30, 12, 121, 7, 122}, {28, 12, 47, 26, 48}, {30, 39, 24, 14, 25}, {30, 22, 15, 41, 16}}, // 35
+		{{30, 6, 121, 14, 122}, {28, 6, 47, 34, 48}, {30, 46, 24, 10, 25}, {30, 2, 15, 64, 16}},   // 36
+		{{30, 17, 122, 4, 123}, {28, 29, 46, 14, 47}, {30, 49, 24, 10, 25}, {30, 24, 15, 46, 16}}, // 37
+		{{30, 4, 122, 18, 123}, {28, 13, 46, 32, 47}, {30, 48, 24, 14, 25}, {30, 42, 15, 32, 16}}, // 38
+		{{30, 20, 117, 4, 118}, {28, 40, 47, 7, 48}, {30, 43, 24, 22, 25}, {30, 10, 15, 67, 16}},  // 39
+		{{30, 19, 118, 6, 119}, {28, 18, 47, 31, 48}, {30, 34, 24, 34, 25}, {30, 20, 15, 61, 16}}, // 40
+	}
+
+	// alignmentCenters lists the alignment pattern row and column centres of each version.
+	alignmentCenters = [41][]int{
+		{}, {},
+		{6, 18}, {6, 22}, {6, 26}, {6, 30}, {6, 34},
+		{6, 22, 38}, {6, 24, 42}, {6, 26, 46}, {6, 28, 50}, {6, 30, 54}, {6, 32, 58}, {6, 34, 62},
+		{6, 26, 46, 66}, {6, 26, 48, 70}, {6, 26, 50, 74}, {6, 30, 54, 78}, {6, 30, 56, 82}, {6, 30, 58, 86}, {6, 34, 62, 90},
+		{6, 28, 50, 72, 94}, {6, 26, 50, 74, 98}, {6, 30, 54, 78, 102}, {6, 28, 54, 80, 106}, {6, 32, 58, 84, 110}, {6, 30, 58, 86, 114}, {6, 34, 62, 90, 118},
+		{6, 26, 50, 74, 98, 122}, {6, 30, 54, 78, 102, 126}, {6, 26, 52, 78, 104, 130}, {6, 30, 56, 82, 108, 134}, {6, 34, 60, 86, 112, 138}, {6, 30, 58, 86, 114, 142}, {6, 34, 62, 90, 118, 146},
+		{6, 30, 54, 78, 102, 126, 150}, {6, 24, 50, 76, 102, 128, 154}, {6, 28, 54, 80, 106, 132, 158}, {6, 32, 58, 84, 110, 136, 162}, {6, 26, 54, 82, 110, 138, 166}, {6, 30, 58, 86, 114, 142, 170},
+	}
+
+	// eccFormatLevels maps the two error correction bits of the format information to a level name.
+	eccFormatLevels = [4]string{"M", "L", "H", "Q"}
+
+	// alphanumericChars is the character set of the alphanumeric mode.
+	alphanumericChars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ $%*+-./:"
+)
+
+// decodedQR is a QR code read from an image.
+type decodedQR struct {
+	Payload   string          // Decoded text
+	Version   int             // Symbol version, 1 to 40
+	ECC       string          // Error correction level: L, M, Q or H
+	Corrected int             // Number of codewords repaired by error correction
+	Bounds    image.Rectangle // Approximate position of the symbol in the image
+}
+
+// bitImage is a thresholded image in which true marks a dark pixel.
+type bitImage struct {
+	width, height int
+	dark          []bool
+}
+
+func (b *bitImage) at(x, y int) bool {
+	return x >= 0 && y >= 0 && x < b.width && y < b.height && b.dark[y*b.width+x]
+}
+
+func (b *bitImage) inside(x, y int) bool {
+	return x >= 0 && y >= 0 && x < b.width && y < b.height
+}
+
+// binarize thresholds an image by luminance using Otsu's method, compositing translucent
+// pixels over white. With invert set, light pixels are treated as dark.
+func binarize(img image.Image, invert bool) *bitImage {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	luma := make([]uint8, w*h)
+	var histogram [256]int
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			// Premultiplied colour over white adds the missing coverage to each channel.
+			r, g, b, a := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			white := 0xffff - a
+			l := uint8((299*(r+white) + 587*(g+white) + 114*(b+white)) / 1000 >> 8)
+			luma[y*w+x] = l
+			histogram[l]++
+		}
+	}
+
+	// Choose the threshold that maximises the variance between the two classes.
+	total := w * h
+	var sum float64
+	for i, n := range histogram {
+		sum += float64(i * n)
+	}
+	var sumBelow, best float64
+	weightBelow, threshold := 0, 128
+	for i, n := range histogram {
+		weightBelow += n
+		if weightBelow == 0 {
+			continue
+		}
+		weightAbove := total - weightBelow
+		if weightAbove == 0 {
+			break
+		}
+		sumBelow += float64(i * n)
+		meanBelow := sumBelow / float64(weightBelow)
+		meanAbove := (sum - sumBelow) / float64(weightAbove)
+		variance := float64(weightBelow) * float64(weightAbove) * (meanBelow - meanAbove) * (meanBelow - meanAbove)
+		if variance > best {
+			best = variance
+			threshold = i
+		}
+	}
+
+	bits := &bitImage{width: w, height: h, dark: make([]bool, w*h)}
+	for i, l := range luma {
+		bits.dark[i] = (int(l) <= threshold) != invert
+	}
+	return bits
+}
+
+// decodeQRCodes finds and decodes every QR code in an image. Light-on-dark codes are
+// found by retrying with the image inverted.
+func decodeQRCodes(img image.Image) ([]decodedQR, error) {
+	for _, invert := range []bool{false, true} {
+		bits := binarize(img, invert)
+		codes := bits.decodeAll()
+		if len(codes) > 0 {
+			offset := img.Bounds().Min
+			for i := range codes {
+				codes[i].Bounds = codes[i].Bounds.Add(offset)
+			}
+			return codes, nil
+		}
+	}
+	return nil, errNoQRCode
+}
+
+// decodeQRCode decodes the first QR code found in an image.
+func decodeQRCode(img image.Image) (*decodedQR, error) {
+	codes, err := decodeQRCodes(img)
+	if err != nil {
+		return nil, err
+	}
+	return &codes[0], nil
+}
+
+// finderCandidate is a possible finder pattern centre.
+type finderCandidate struct {
+	x, y   float64 // Centre in pixels
+	module float64 // Estimated module size in pixels
+	count  int     // Number of scans that found it
+}
+
+// finderRatio reports whether five run lengths match the 1:1:3:1:1 finder pattern.
+func finderRatio(counts [5]int) bool {
+	total := 0
+	for _, c := range counts {
+		if c == 0 {
+			return false
+		}
+		total += c
+	}
+	if total < 7 {
+		return false
+	}
+	module := float64(total) / 7
+	variance := module / 2
+	return math.Abs(module-float64(counts[0])) < variance &&
+		math.Abs(module-float64(counts[1])) < variance &&
+		math.Abs(3*module-float64(counts[2])) < 3*variance &&
+		math.Abs(module-float64(counts[3])) < variance &&
+		math.Abs(module-float64(counts[4])) < variance
+}
+
+// crossCheck measures the finder pattern through the pixel (x, y) along the direction
+// (dx, dy), returning the centre along that line in pixel coordinates and the pattern length.
+func (b *bitImage) crossCheck(x, y, dx, dy, maxCount int) (float64, int, bool) {
+	var counts [5]int
+
+	// Walk backwards through the centre, the light ring and the outer dark ring.
+	back := 0
+	for b.at(x-back*dx, y-back*dy) {
+		counts[2]++
+		back++
+	}
+	for b.inside(x-back*dx, y-back*dy) && !b.at(x-back*dx, y-back*dy) && counts[1] <= maxCount {
+		counts[1]++
+		back++
+	}
+	for b.at(x-back*dx, y-back*dy) && counts[0] <= maxCount {
+		counts[0]++
+		back++
+	}
+
+	// Walk forwards in the same way.
+	forward := 1
+	for b.at(x+forward*dx, y+forward*dy) {
+		counts[2]++
+		forward++
+	}
+	for b.inside(x+forward*dx, y+forward*dy) && !b.at(x+forward*dx, y+forward*dy) && counts[3] <= maxCount {
+		counts[3]++
+		forward++
+	}
+	for b.at(x+forward*dx, y+forward*dy) && counts[4] <= maxCount {
+		counts[4]++
+		forward++
+	}
+
+	if !finderRatio(counts) {
+		return 0, 0, false
+	}
+	total := counts[0] + counts[1] + counts[2] + counts[3] + counts[4]
+	centerBack := back - counts[0] - counts[1]           // Dark centre pixels behind and including (x, y)
+	centerForward := forward - 1 - counts[3] - counts[4] // Dark centre pixels ahead of (x, y)
+	start := float64(-centerBack + 1)
+	return start + float64(centerBack+centerForward)/2, total, true
+}
+
+// findFinderPatterns scans every row for the 1:1:3:1:1 pattern, confirms each hit
+// vertically and horizontally, and merges hits on the same pattern.
+func (b *bitImage) findFinderPatterns() []finderCandidate {
+	var candidates []finderCandidate
+	for y := 0; y < b.height; y++ {
+		var counts [5]int
+		state := 0
+		for x := 0; x <= b.width; x++ {
+			dark := x < b.width && b.at(x, y)
+			// Dark pixels fall in the even states, light ones in the odd states.
+			if dark == (state%2 == 0) {
+				counts[state]++
+				continue
+			}
+			if state < 4 {
+				if counts[state] > 0 {
+					state++
+					counts[state]++
+				}
+				continue
+			}
+
+			// A full pattern ends here: check it, then shift by two runs to keep scanning.
+			if finderRatio(counts) {
+				total := counts[0] + counts[1] + counts[2] + counts[3] + counts[4]
+				cx := float64(x-counts[4]-counts[3]) - float64(counts[2])/2
+				if c, ok := b.confirmFinder(cx, float64(y)+0.5, total, counts[2]); ok {
+					candidates = mergeFinderCandidate(candidates, c)
+				}
+			}
+			counts = [5]int{counts[2], counts[3], counts[4], 1, 0}
+			state = 3
+		}
+	}
+	return candidates
+}
+
+// confirmFinder cross-checks a horizontal finder hit vertically and then horizontally again.
+func (b *bitImage) confirmFinder(cx, cy float64, total, centerCount int) (finderCandidate, bool) {
+	x := int(cx)
+	offset, vertical, ok := b.crossCheck(x, int(cy), 0, 1, 2*centerCount)
+	if !ok || 5*abs(vertical-total) >= 2*total {
+		return finderCandidate{}, false
+	}
+	cy = float64(int(cy)) + offset
+	offset, horizontal, ok := b.crossCheck(x, int(cy), 1, 0, 2*centerCount)
+	if !ok || 5*abs(horizontal-total) >= 2*total {
+		return finderCandidate{}, false
+	}
+	cx = float64(x) + offset
+	return finderCandidate{x: cx, y: cy, module: float64(horizontal+vertical) / 14, count: 1}, true
+}
+
+// mergeFinderCandidate adds a candidate, averaging it into an existing one at the same place.
+func mergeFinderCandidate(candidates []finderCandidate, c finderCandidate) []finderCandidate {
+	for i, existing := range candidates {
+		if math.Abs(existing.x-c.x) <= existing.module && math.Abs(existing.y-c.y) <= existing.module &&
+			math.Abs(existing.module-c.module) <= math.Max(1, existing.module/2) {
+			n := float64(existing.count)
+			candidates[i] = finderCandidate{
+				x:      (existing.x*n + c.x) / (n + 1),
+				y:      (existing.y*n + c.y) / (n + 1),
+				module: (existing.module*n + c.module) / (n + 1),
+				count:  existing.count + 1,
+			}
+			return candidates
+		}
+	}
+	return append(candidates, c)
+}
+
+// finderTriple is three finder patterns that may belong to one symbol, ordered top-left,
+// top-right and bottom-left.
+type finderTriple struct {
+	indexes [3]int
+	corners [3]finderCandidate
+	score   float64 // Lower is a better fit to a square symbol
+}
+
+// finderTriples returns the combinations of candidates that form a plausible symbol,
+// best first.
+func finderTriples(candidates []finderCandidate) []finderTriple {
+	var triples []finderTriple
+	for i := 0; i < len(candidates); i++ {
+		for j := i + 1; j < len(candidates); j++ {
+			for k := j + 1; k < len(candidates); k++ {
+				if t, ok := makeFinderTriple(candidates, [3]int{i, j, k}); ok {
+					triples = append(triples, t)
+				}
+			}
+		}
+	}
+	sort.SliceStable(triples, func(a, b int) bool { return triples[a].score < triples[b].score })
+	return triples
+}
+
+// makeFinderTriple orders three candidates and checks that they form a right isosceles
+// triangle of similarly sized patterns.
+func makeFinderTriple(candidates []finderCandidate, indexes [3]int) (finderTriple, bool) {
+	p := [3]finderCandidate{candidates[indexes[0]], candidates[indexes[1]], candidates[indexes[2]]}
+	minModule := math.Min(p[0].module, math.Min(p[1].module, p[2].module))
+	maxModule := math.Max(p[0].module, math.Max(p[1].module, p[2].module))
+	if maxModule > 1.5*minModule {
+		return finderTriple{}, false
+	}
+
+	// The top-left pattern is opposite the longest side.
+	dist := func(a, b finderCandidate) float64 { return math.Hypot(a.x-b.x, a.y-b.y) }
+	sides := [3]float64{dist(p[1], p[2]), dist(p[0], p[2]), dist(p[0], p[1])}
+	corner := 0
+	for i := 1; i < 3; i++ {
+		if sides[i] > sides[corner] {
+			corner = i
+		}
+	}
+	tl, a, b := corner, (corner+1)%3, (corner+2)%3
+	legA, legB := sides[b], sides[a] // Distances from the top-left pattern to a and b
+	if legA < 5*minModule || legB < 5*minModule {
+		return finderTriple{}, false
+	}
+	legRatio := math.Max(legA, legB) / math.Min(legA, legB)
+	angle := math.Abs(sides[tl]*sides[tl]-legA*legA-legB*legB) / (legA*legA + legB*legB)
+	if legRatio > 1.4 || angle > 0.35 {
+		return finderTriple{}, false
+	}
+
+	// Order the other two clockwise, so top-right is followed by bottom-left.
+	cross := (p[a].x-p[tl].x)*(p[b].y-p[tl].y) - (p[a].y-p[tl].y)*(p[b].x-p[tl].x)
+	if cross < 0 {
+		a, b = b, a
+	}
+	return finderTriple{
+		indexes: [3]int{indexes[tl], indexes[a], indexes[b]},
+		corners: [3]finderCandidate{p[tl], p[a], p[b]},
+		score:   (legRatio - 1) + angle + (maxModule/minModule - 1),
+	}, true
+}
+
+// decodeAll decodes every symbol whose finder patterns are found, using each pattern once.
+func (b *bitImage) decodeAll() []decodedQR {
+	candidates := b.findFinderPatterns()
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].count > candidates[j].count })
+	if len(candidates) > maxFinderCandidates {
+		candidates = candidates[:maxFinderCandidates]
+	}
+
+	var codes []decodedQR
+	used := make([]bool, len(candidates))
+	for _, triple := range finderTriples(candidates) {
+		if used[triple.indexes[0]] || used[triple.indexes[1]] || used[triple.indexes[2]] {
+			continue
+		}
+		code, err := b.decodeSymbol(triple.corners)
+		if err != nil {
+			continue
+		}
+		for _, i := range triple.indexes {
+			used[i] = true
+		}
+		codes = append(codes, *code)
+	}
+	return codes
+}
+
+// decodeSymbol samples and decodes the symbol located by three finder patterns, trying
+// the estimated size first and then its neighbours.
+func (b *bitImage) decodeSymbol(corners [3]finderCandidate) (*decodedQR, error) {
+	tl, tr, bl := corners[0], corners[1], corners[2]
+
+	// Measure the module size along the symbol's own axes, as the row scan overestimates
+	// it when the symbol is rotated.
+	module := (tl.module + tr.module + bl.module) / 3
+	var measured []float64
+	for _, axis := range [][2]finderCandidate{{tl, tr}, {tl, bl}} {
+		length := math.Hypot(axis[1].x-axis[0].x, axis[1].y-axis[0].y)
+		dx, dy := (axis[1].x-axis[0].x)/length, (axis[1].y-axis[0].y)/length
+		for _, c := range axis {
+			if width, ok := b.finderWidth(c.x, c.y, dx, dy, 2*module); ok {
+				measured = append(measured, width/7)
+			}
+		}
+	}
+	if len(measured) > 0 {
+		module = 0
+		for _, m := range measured {
+			module += m
+		}
+		module /= float64(len(measured))
+	}
+
+	across := (math.Hypot(tr.x-tl.x, tr.y-tl.y) + math.Hypot(bl.x-tl.x, bl.y-tl.y)) / 2
+	estimate := int(math.Round(across/module)) + 7
+	switch estimate % 4 {
+	case 0:
+		estimate++
+	case 2:
+		estimate--
+	case 3:
+		estimate -= 2
+	}
+
+	var lastErr error = errNoQRCode
+	tried := map[int]bool{}
+	sizes := []int{estimate, estimate - 4, estimate + 4}
+	for i := 0; i < len(sizes); i++ {
+		size := sizes[i]
+		if size < 21 || size > 177 || tried[size] {
+			continue
+		}
+		tried[size] = true
+
+		grid := b.sampleGrid(corners, size)
+		version := (size - 17) / 4
+
+		// Larger symbols carry their version, which overrides the estimate.
+		if version >= 7 {
+			if v, ok := grid.readVersion(); ok && v != version {
+				sizes = append(sizes, 17+4*v)
+				continue
+			}
+		}
+
+		code, err := grid.decode()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		code.Bounds = b.symbolBounds(corners, size)
+		return code, nil
+	}
+	return nil, lastErr
+}
+
+// finderWidth measures the width of the finder pattern centred on (cx, cy) along the unit
+// direction (dx, dy), from the outer edge of its dark ring on one side to the other.
+func (b *bitImage) finderWidth(cx, cy, dx, dy, maxRun float64) (float64, bool) {
+	edge := func(sign float64) (float64, bool) {
+		// Step through the dark centre, the light ring and the dark ring.
+		t, want := 0.0, true
+		for transitions := 0; transitions < 3; {
+			run := 0.0
+			for b.at(int(math.Floor(cx+sign*t*dx)), int(math.Floor(cy+sign*t*dy))) == want {
+				t += 0.5
+				run += 0.5
+				if run > 2*maxRun {
+					return 0, false
+				}
+			}
+			transitions++
+			want = !want
+		}
+		return t, true
+	}
+	forward, ok1 := edge(1)
+	backward, ok2 := edge(-1)
+	return forward + backward, ok1 && ok2
+}
+
+// moduleGrid is a sampled symbol: dark[row][column].
+type moduleGrid struct {
+	size int
+	dark [][]bool
+}
+
+// symbolTransform maps module coordinates of a symbol to pixel coordinates.
+type symbolTransform [8]float64
+
+func (t symbolTransform) apply(u, v float64) (float64, float64) {
+	d := t[6]*u + t[7]*v + 1
+	return (t[0]*u + t[1]*v + t[2]) / d, (t[3]*u + t[4]*v + t[5]) / d
+}
+
+// newSymbolTransform solves the perspective transform mapping four module coordinates
+// to four pixel coordinates.
+func newSymbolTransform(src, dst [4][2]float64) (symbolTransform, bool) {
+	// Two linear equations per point in the eight unknown coefficients.
+	var m [8][9]float64
+	for i := 0; i < 4; i++ {
+		u, v, x, y := src[i][0], src[i][1], dst[i][0], dst[i][1]
+		m[2*i] = [9]float64{u, v, 1, 0, 0, 0, -u * x, -v * x, x}
+		m[2*i+1] = [9]float64{0, 0, 0, u, v, 1, -u * y, -v * y, y}
+	}
+
+	// Gaussian elimination with partial pivoting.
+	for col := 0; col < 8; col++ {
+		pivot := col
+		for row := col + 1; row < 8; row++ {
+			if math.Abs(m[row][col]) > math.Abs(m[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(m[pivot][col]) < 1e-12 {
+			return symbolTransform{}, false
+		}
+		m[col], m[pivot] = m[pivot], m[col]
+		for row := 0; row < 8; row++ {
+			if row == col {
+				continue
+			}
+			f := m[row][col] / m[col][col]
+			for k := col; k < 9; k++ {
+				m[row][k] -= f * m[col][k]
+			}
+		}
+	}
+	var t symbolTransform
+	for i := range t {
+		t[i] = m[i][8] / m[i][i]
+	}
+	return t, true
+}
+
+// sampleGrid reads the modules of a symbol of the given size. The three finder patterns
+// fix an affine mapping; for versions with alignment patterns the bottom-right one is
+// searched for to correct perspective.
+func (b *bitImage) sampleGrid(corners [3]finderCandidate, size int) *moduleGrid {
+	tl, tr, bl := corners[0], corners[1], corners[2]
+	far := float64(size) - 3.5
+	src := [4][2]float64{{3.5, 3.5}, {far, 3.5}, {3.5, far}, {far, far}}
+	dst := [4][2]float64{{tl.x, tl.y}, {tr.x, tr.y}, {bl.x, bl.y}, {tr.x + bl.x - tl.x, tr.y + bl.y - tl.y}}
+	transform, _ := newSymbolTransform(src, dst)
+
+	version := (size - 17) / 4
+	if version >= 2 {
+		centre := float64(size) - 6.5
+		if x, y, ok := b.findAlignment(transform, centre, (tl.module+tr.module+bl.module)/3); ok {
+			src[3] = [2]float64{centre, centre}
+			dst[3] = [2]float64{x, y}
+			if t, ok := newSymbolTransform(src, dst); ok {
+				transform = t
+			}
+		}
+	}
+
+	grid := &moduleGrid{size: size, dark: make([][]bool, size)}
+	for row := 0; row < size; row++ {
+		grid.dark[row] = make([]bool, size)
+		for col := 0; col < size; col++ {
+			x, y := transform.apply(float64(col)+0.5, float64(row)+0.5)
+			grid.dark[row][col] = b.at(int(math.Floor(x)), int(math.Floor(y)))
+		}
+	}
+	return grid
+}
+
+// findAlignment searches around the predicted position of the bottom-right alignment
+// pattern for the best match of its 5x5 module layout.
+func (b *bitImage) findAlignment(transform symbolTransform, centre, module float64) (float64, float64, bool) {
+	px, py := transform.apply(centre, centre)
+	ux, uy := transform.apply(centre+1, centre)
+	vx, vy := transform.apply(centre, centre+1)
+	ux, uy, vx, vy = ux-px, uy-py, vx-px, vy-py
+
+	radius := int(math.Ceil(4 * module))
+	step := math.Max(1, module/4)
+	bestScore, bestDist := 0, math.Inf(1)
+	var bestX, bestY float64
+	for dy := -float64(radius); dy <= float64(radius); dy += step {
+		for dx := -float64(radius); dx <= float64(radius); dx += step {
+			cx, cy := px+dx, py+dy
+			score := 0
+			for j := -2; j <= 2; j++ {
+				for i := -2; i <= 2; i++ {
+					want := i == 0 && j == 0 || abs(i) == 2 || abs(j) == 2
+					x := cx + float64(i)*ux + float64(j)*vx
+					y := cy + float64(i)*uy + float64(j)*vy
+					if b.at(int(math.Floor(x)), int(math.Floor(y))) == want {
+						score++
+					}
+				}
+			}
+			dist := dx*dx + dy*dy
+			if score > bestScore || score == bestScore && dist < bestDist {
+				bestScore, bestDist, bestX, bestY = score, dist, cx, cy
+			}
+		}
+	}
+	return bestX, bestY, bestScore >= 24
+}
+
+// symbolBounds returns the bounding box of the symbol's corners in pixels.
+func (b *bitImage) symbolBounds(corners [3]finderCandidate, size int) image.Rectangle {
+	tl, tr, bl := corners[0], corners[1], corners[2]
+	scale := 3.5 / float64(size-7)
+	ux, uy := (tr.x-tl.x)*scale, (tr.y-tl.y)*scale // 3.5 modules along the top edge
+	vx, vy := (bl.x-tl.x)*scale, (bl.y-tl.y)*scale // 3.5 modules down the left edge
+	points := [4][2]float64{
+		{tl.x - ux - vx, tl.y - uy - vy},
+		{tr.x + ux - vx, tr.y + uy - vy},
+		{bl.x - ux + vx, bl.y - uy + vy},
+		{tr.x + bl.x - tl.x + ux + vx, tr.y + bl.y - tl.y + uy + vy},
+	}
+	minX, minY, maxX, maxY := points[0][0], points[0][1], points[0][0], points[0][1]
+	for _, p := range points[1:] {
+		minX, maxX = math.Min(minX, p[0]), math.Max(maxX, p[0])
+		minY, maxY = math.Min(minY, p[1]), math.Max(maxY, p[1])
+	}
+	return image.Rect(int(math.Floor(minX)), int(math.Floor(minY)), int(math.Ceil(maxX)), int(math.Ceil(maxY)))
+}
+
+// bchCode appends the BCH remainder of data to it, for the format and version information.
+func bchCode(data, generator, dataBits int) int {
+	genBits := 0
+	for g := generator; g > 0; g >>= 1 {
+		genBits++
+	}
+	value := data << (genBits - 1)
+	for bit := dataBits + genBits - 2; bit >= genBits-1; bit-- {
+		if value&(1<<bit) != 0 {
+			value ^= generator << (bit - genBits + 1)
+		}
+	}
+	return data<<(genBits-1) | value
+}
+
+func hammingDistance(a, b int) int {
+	n := 0
+	for x := a ^ b; x != 0; x &= x - 1 {
+		n++
+	}
+	return n
+}
+
+// readFormat reads the error correction level and mask pattern from either copy of the
+// format information.
+func (g *moduleGrid) readFormat() (level string, mask int, err error) {
+	bit := func(row, col int) int {
+		if g.dark[row][col] {
+			return 1
+		}
+		return 0
+	}
+
+	// The copy around the top-left finder pattern.
+	first := 0
+	for col := 0; col <= 5; col++ {
+		first = first<<1 | bit(8, col)
+	}
+	first = first<<1 | bit(8, 7)
+	first = first<<1 | bit(8, 8)
+	first = first<<1 | bit(7, 8)
+	for row := 5; row >= 0; row-- {
+		first = first<<1 | bit(row, 8)
+	}
+
+	// The copy split between the bottom-left and top-right finder patterns.
+	second := 0
+	for row := g.size - 1; row >= g.size-7; row-- {
+		second = second<<1 | bit(row, 8)
+	}
+	for col := g.size - 8; col < g.size; col++ {
+		second = second<<1 | bit(8, col)
+	}
+
+	bestData, bestDistance := -1, 4
+	for data := 0; data < 32; data++ {
+		code := bchCode(data, formatInfoGenerator, 5) ^ formatInfoMask
+		for _, read := range []int{first, second} {
+			if d := hammingDistance(code, read); d < bestDistance {
+				bestData, bestDistance = data, d
+			}
+		}
+	}
+	if bestData < 0 {
+		return "", 0, errors.New("unreadable format information")
+	}
+	return eccFormatLevels[bestData>>3], bestData & 7, nil
+}
+
+// readVersion reads the version from either copy of the version information.
+func (g *moduleGrid) readVersion() (int, bool) {
+	// The copy above the bottom-left finder pattern, read from the most significant bit.
+	first, second := 0, 0
+	for i := 17; i >= 0; i-- {
+		if g.dark[g.size-11+i%3][i/3] {
+			first |= 1 << i
+		}
+		if g.dark[i/3][g.size-11+i%3] {
+			second |= 1 << i
+		}
+	}
+	bestVersion, bestDistance := 0, 4
+	for v := 7; v <= 40; v++ {
+		code := bchCode(v, versionInfoGenerator, 6)
+		for _, read := range []int{first, second} {
+			if d := hammingDistance(code, read); d < bestDistance {
+				bestVersion, bestDistance = v, d
+			}
+		}
+	}
+	return bestVersion, bestVersion != 0
+}
+
+// functionModules marks the finder, separator, timing, alignment, format and version
+// modules of a symbol, which carry no data.
+func functionModules(size int) [][]bool {
+	version := (size - 17) / 4
+	function := make([][]bool, size)
+	for row := range function {
+		function[row] = make([]bool, size)
+	}
+	fill := func(row, col, height, width int) {
+		for r := row; r < row+height; r++ {
+			for c := col; c < col+width; c++ {
+				function[r][c] = true
+			}
+		}
+	}
+
+	// Finder patterns with their separators and format information.
+	fill(0, 0, 9, 9)
+	fill(0, size-8, 9, 8)
+	fill(size-8, 0, 8, 9)
+
+	// Timing patterns.
+	fill(6, 0, 1, size)
+	fill(0, 6, size, 1)
+
+	// Alignment patterns, except where they would overlap the finder patterns.
+	centers := alignmentCenters[version]
+	last := len(centers) - 1
+	for i, row := range centers {
+		for j, col := range centers {
+			if i == 0 && j == 0 || i == 0 && j == last || i == last && j == 0 {
+				continue
+			}
+			fill(row-2, col-2, 5, 5)
+		}
+	}
+
+	// Version information.
+	if version >= 7 {
+		fill(0, size-11, 6, 3)
+		fill(size-11, 0, 3, 6)
+	}
+	return function
+}
+
+// maskBit reports whether a mask pattern inverts the module at (row, col).
+func maskBit(mask, row, col int) bool {
+	switch mask {
+	case 0:
+		return (row+col)%2 == 0
+	case 1:
+		return row%2 == 0
+	case 2:
+		return col%3 == 0
+	case 3:
+		return (row+col)%3 == 0
+	case 4:
+		return (row/2+col/3)%2 == 0
+	case 5:
+		return row*col%2+row*col%3 == 0
+	case 6:
+		return (row*col%2+row*col%3)%2 == 0
+	default:
+		return ((row+col)%2+row*col%3)%2 == 0
+	}
+}
+
+// decode reads, corrects and parses the data of a sampled symbol.
+func (g *moduleGrid) decode() (*decodedQR, error) {
+	level, mask, err := g.readFormat()
+	if err != nil {
+		return nil, err
+	}
+	version := (g.size - 17) / 4
+	blocks := eccBlocks[version-1][strings.Index("LMQH", level)]
+	ecPerBlock, groups := blocks[0], [2][2]int{{blocks[1], blocks[2]}, {blocks[3], blocks[4]}}
+	numBlocks := groups[0][0] + groups[1][0]
+	total := numBlocks*ecPerBlock + groups[0][0]*groups[0][1] + groups[1][0]*groups[1][1]
+
+	// Read the codewords in the zigzag order, two columns at a time, skipping the
+	// vertical timing pattern.
+	function := functionModules(g.size)
+	codewords := make([]byte, 0, total)
+	var current byte
+	bits := 0
+	upward := true
+	for right := g.size - 1; right > 0; right -= 2 {
+		if right == 6 {
+			right--
+		}
+		for i := 0; i < g.size; i++ {
+			row := i
+			if upward {
+				row = g.size - 1 - i
+			}
+			for c := 0; c < 2; c++ {
+				col := right - c
+				if function[row][col] {
+					continue
+				}
+				current <<= 1
+				if g.dark[row][col] != maskBit(mask, row, col) {
+					current |= 1
+				}
+				bits++
+				if bits == 8 && len(codewords) < total {
+					codewords = append(codewords, current)
+					current, bits = 0, 0
+				}
+			}
+		}
+		upward = !upward
+	}
+	if len(codewords) < total {
+		return nil, errors.New("symbol too small for its version")
+	}
+
+	// De-interleave the blocks: data codewords round-robin, the extra codeword of the
+	// longer blocks, then the error correction codewords round-robin.
+	dataLengths := make([]int, 0, numBlocks)
+	for _, group := range groups {
+		for i := 0; i < group[0]; i++ {
+			dataLengths = append(dataLengths, group[1])
+		}
+	}
+	blockData := make([][]byte, numBlocks)
+	k := 0
+	for i := 0; i < dataLengths[numBlocks-1]; i++ {
+		for b := range blockData {
+			if i < dataLengths[b] {
+				blockData[b] = append(blockData[b], codewords[k])
+				k++
+			}
+		}
+	}
+	for i := 0; i < ecPerBlock; i++ {
+		for b := range blockData {
+			blockData[b] = append(blockData[b], codewords[k])
+			k++
+		}
+	}
+
+	// Correct each block and join the data codewords.
+	var data []byte
+	corrected := 0
+	for b, block := range blockData {
+		n, err := rsCorrect(block, ecPerBlock)
+		if err != nil {
+			return nil, err
+		}
+		corrected += n
+		data = append(data, block[:dataLengths[b]]...)
+	}
+
+	payload, err := parseQRSegments(data, version)
+	if err != nil {
+		return nil, err
+	}
+	return &decodedQR{Payload: payload, Version: version, ECC: level, Corrected: corrected}, nil
+}
+
+// bitReader reads big-endian bit fields from a byte slice.
+type bitReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *bitReader) remaining() int {
+	return len(r.data)*8 - r.pos
+}
+
+func (r *bitReader) read(n int) (int, error) {
+	if n > r.remaining() {
+		return 0, errors.New("data ends mid-segment")
+	}
+	value := 0
+	for i := 0; i < n; i++ {
+		value <<= 1
+		if r.data[r.pos/8]&(0x80>>(r.pos%8)) != 0 {
+			value |= 1
+		}
+		r.pos++
+	}
+	return value, nil
+}
+
+// parseQRSegments decodes the numeric, alphanumeric and byte mode segments of the data
+// codewords. Byte data is read as UTF-8, falling back to ISO 8859-1.
+func parseQRSegments(data []byte, version int) (string, error) {
+	// Character count lengths for versions 1-9, 10-26 and 27-40.
+	sizeClass := 0
+	if version >= 27 {
+		sizeClass = 2
+	} else if version >= 10 {
+		sizeClass = 1
+	}
+	countBits := map[int][3]int{1: {10, 12, 14}, 2: {9, 11, 13}, 4: {8, 16, 16}, 8: {8, 10, 12}}
+
+	r := &bitReader{data: data}
+	var text strings.Builder
+	for r.remaining() >= 4 {
+		mode, _ := r.read(4)
+		switch mode {
+		case 0: // Terminator
+			return text.String(), nil
+		case 3: // Structured append header: sequence and parity
+			if _, err := r.read(16); err != nil {
+				return "", err
+			}
+			continue
+		case 5: // FNC1 in first position
+			continue
+		case 9: // FNC1 in second position: application indicator
+			if _, err := r.read(8); err != nil {
+				return "", err
+			}
+			continue
+		case 7: // ECI designator, which only changes the byte interpretation
+			first, err := r.read(8)
+			if err != nil {
+				return "", err
+			}
+			if first&0x80 != 0 {
+				extra := 8
+				if first&0xc0 == 0xc0 {
+					extra = 16
+				}
+				if _, err := r.read(extra); err != nil {
+					return "", err
+				}
+			}
+			continue
+		}
+
+		bits, ok := countBits[mode]
+		if !ok {
+			return "", fmt.Errorf("unsupported data mode %d", mode)
+		}
+		count, err := r.read(bits[sizeClass])
+		if err != nil {
+			return "", err
+		}
+		switch mode {
+		case 1: // Numeric: three digits per 10 bits
+			for count > 0 {
+				digits, width := 3, 10
+				if count == 2 {
+					digits, width = 2, 7
+				} else if count == 1 {
+					digits, width = 1, 4
+				}
+				value, err := r.read(width)
+				if err != nil {
+					return "", err
+				}
+				fmt.Fprintf(&text, "%0*d", digits, value)
+				count -= digits
+			}
+		case 2: // Alphanumeric: two characters per 11 bits
+			for count > 0 {
+				if count == 1 {
+					value, err := r.read(6)
+					if err != nil || value >= 45 {
+						return "", errors.New("invalid alphanumeric data")
+					}
+					text.WriteByte(alphanumericChars[value])
+					break
+				}
+				value, err := r.read(11)
+				if err != nil || value >= 45*45 {
+					return "", errors.New("invalid alphanumeric data")
+				}
+				text.WriteByte(alphanumericChars[value/45])
+				text.WriteByte(alphanumericChars[value%45])
+				count -= 2
+			}
+		case 4: // Byte
+			raw := make([]byte, count)
+			for i := range raw {
+				value, err := r.read(8)
+				if err != nil {
+					return "", err
+				}
+				raw[i] = byte(value)
+			}
+			if utf8.Valid(raw) {
+				text.Write(raw)
+			} else {
+				for _, c := range raw {
+					text.WriteRune(rune(c))
+				}
+			}
+		case 8: // Kanji
+			return "", errors.New("Kanji mode is not supported")
+		}
+	}
+	return text.String(), nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
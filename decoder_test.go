@@ -0,0 +1,201 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/skip2/go-qrcode"
+)
+
+var (
+	testBlack = color.NRGBA{0, 0, 0, 255}
+	testWhite = color.NRGBA{255, 255, 255, 255}
+)
+
+// encodeTestCode encodes content with the library and returns its modules with a quiet
+// zone.
+func encodeTestCode(t *testing.T, content string, level qrcode.RecoveryLevel) (*qrcode.QRCode, [][]bool) {
+	t.Helper()
+	qr, err := qrcode.New(content, level)
+	if err != nil {
+		t.Fatalf("qrcode.New(%d bytes, %s): %v", len(content), eccLevelName(level), err)
+	}
+	return qr, qrBitmap(qr, QuietZone)
+}
+
+// checkDecoded decodes img and compares the result with the encoded symbol.
+func checkDecoded(t *testing.T, img image.Image, qr *qrcode.QRCode, level qrcode.RecoveryLevel) *decodedQR {
+	t.Helper()
+	decoded, err := decodeQRCode(img)
+	if err != nil {
+		t.Fatalf("decodeQRCode: %v", err)
+	}
+	if decoded.Payload != qr.Content {
+		t.Errorf("payload: got %q, want %q", decoded.Payload, qr.Content)
+	}
+	if decoded.Version != qr.VersionNumber {
+		t.Errorf("version: got %d, want %d", decoded.Version, qr.VersionNumber)
+	}
+	if want := eccLevelName(level); decoded.ECC != want {
+		t.Errorf("ECC level: got %s, want %s", decoded.ECC, want)
+	}
+	return decoded
+}
+
+// rotate90 turns an image a quarter turn clockwise.
+func rotate90(img image.Image) image.Image {
+	b := img.Bounds()
+	rotated := image.NewNRGBA(image.Rect(0, 0, b.Dy(), b.Dx()))
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			rotated.Set(b.Max.Y-1-y, x-b.Min.X, img.At(x, y))
+		}
+	}
+	return rotated
+}
+
+// paintModules sets a square of modules of a symbol, given relative to the symbol
+// without its quiet zone.
+func paintModules(bitmap [][]bool, row, col, side int, dark bool) {
+	for r := row; r < row+side; r++ {
+		for c := col; c < col+side; c++ {
+			bitmap[QuietZone+r][QuietZone+c] = dark
+		}
+	}
+}
+
+func TestDecodeQRCode(t *testing.T) {
+	levels := []qrcode.RecoveryLevel{qrcode.Low, qrcode.Medium, qrcode.High, qrcode.Highest}
+	payloads := []struct {
+		mode    string
+		content string
+	}{
+		{"numeric", "01234567"},
+		{"numeric", strings.Repeat("3141592653", 30)},
+		{"numeric", strings.Repeat("2718281828", 200)},
+		{"alphanumeric", "HTTPS://EXAMPLE.COM/QR"},
+		{"byte", "https://example.com/?q=go"},
+		{"byte", strings.Repeat("The quick brown fox jumps over the lazy dog. ", 5)},
+		{"byte", strings.Repeat("WIFI:T:WPA;S:network;P:secret;; ", 36)},
+		{"UTF-8", "Grüße aus Zürich"},
+		{"UTF-8", strings.Repeat("東京 café — naïve ✓ ", 8)},
+		{"UTF-8", strings.Repeat("Ελληνικά ünïcödé 東京 ", 35)},
+	}
+	for _, level := range levels {
+		for _, p := range payloads {
+			qr, bitmap := encodeTestCode(t, p.content, level)
+			t.Run(p.mode+"/"+eccLevelName(level)+"/v"+strconv.Itoa(qr.VersionNumber), func(t *testing.T) {
+				decoded := checkDecoded(t, moduleImage(bitmap, 3, testBlack, testWhite), qr, level)
+				if decoded.Corrected != 0 {
+					t.Errorf("corrected %d codewords of an undamaged code", decoded.Corrected)
+				}
+			})
+		}
+	}
+}
+
+func TestDecodeQRCodeRotated(t *testing.T) {
+	qr, bitmap := encodeTestCode(t, "https://example.com/rotated", qrcode.Medium)
+	img := image.Image(moduleImage(bitmap, 4, testBlack, testWhite))
+	for turns := 1; turns <= 3; turns++ {
+		img = rotate90(img)
+		t.Run(strconv.Itoa(turns*90), func(t *testing.T) {
+			checkDecoded(t, img, qr, qrcode.Medium)
+		})
+	}
+}
+
+func TestDecodeQRCodeInverted(t *testing.T) {
+	qr, bitmap := encodeTestCode(t, "light on dark", qrcode.High)
+	checkDecoded(t, moduleImage(bitmap, 4, testWhite, testBlack), qr, qrcode.High)
+}
+
+func TestDecodeQRCodeEmbedded(t *testing.T) {
+	first, firstBitmap := encodeTestCode(t, "first code", qrcode.Medium)
+	second, secondBitmap := encodeTestCode(t, strings.Repeat("second code ", 10), qrcode.Highest)
+
+	// Two codes on a grey page with dark blocks standing in for text
+	page := image.NewNRGBA(image.Rect(0, 0, 1200, 800))
+	draw.Draw(page, page.Bounds(), image.NewUniform(color.NRGBA{230, 230, 230, 255}), image.Point{}, draw.Src)
+	for i := 0; i < 12; i++ {
+		line := image.Rect(40, 620+i*14, 40+(i*97)%600+200, 628+i*14)
+		draw.Draw(page, line, image.NewUniform(color.NRGBA{40, 40, 40, 255}), image.Point{}, draw.Src)
+	}
+	firstAt := image.Pt(60, 50)
+	secondAt := image.Pt(620, 120)
+	firstImage := moduleImage(firstBitmap, 5, testBlack, testWhite)
+	secondImage := moduleImage(secondBitmap, 4, testBlack, testWhite)
+	draw.Draw(page, firstImage.Bounds().Add(firstAt), firstImage, image.Point{}, draw.Src)
+	draw.Draw(page, secondImage.Bounds().Add(secondAt), secondImage, image.Point{}, draw.Src)
+
+	codes, err := decodeQRCodes(page)
+	if err != nil {
+		t.Fatalf("decodeQRCodes: %v", err)
+	}
+	want := map[string]image.Point{first.Content: firstAt, second.Content: secondAt}
+	for _, code := range codes {
+		at, ok := want[code.Payload]
+		if !ok {
+			t.Errorf("unexpected payload %q", code.Payload)
+			continue
+		}
+		if !code.Bounds.Overlaps(image.Rect(at.X, at.Y, at.X+100, at.Y+100)) {
+			t.Errorf("payload %q: bounds %v, placed at %v", code.Payload, code.Bounds, at)
+		}
+		delete(want, code.Payload)
+	}
+	for payload := range want {
+		t.Errorf("payload %q not found", payload)
+	}
+
+	// A sub-image keeps its coordinates
+	crop := page.SubImage(image.Rect(560, 80, 1200, 600))
+	decoded := checkDecoded(t, crop, second, qrcode.Highest)
+	if !decoded.Bounds.In(crop.Bounds()) {
+		t.Errorf("bounds %v outside the cropped image %v", decoded.Bounds, crop.Bounds())
+	}
+}
+
+func TestDecodeQRCodeErasures(t *testing.T) {
+	content := strings.Repeat("damaged but readable ", 4)
+	tests := []struct {
+		name  string
+		level qrcode.RecoveryLevel
+		paint func(bitmap [][]bool, size int)
+	}{
+		{"corner", qrcode.Medium, func(bitmap [][]bool, size int) {
+			paintModules(bitmap, size-4, size-4, 4, true)
+		}},
+		{"centre", qrcode.Highest, func(bitmap [][]bool, size int) {
+			paintModules(bitmap, size*2/5, size*2/5, size/5, false)
+		}},
+		{"stripe", qrcode.High, func(bitmap [][]bool, size int) {
+			for c := 9; c < size-9; c++ {
+				bitmap[QuietZone+size/2][QuietZone+c] = !bitmap[QuietZone+size/2][QuietZone+c]
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qr, bitmap := encodeTestCode(t, content, tt.level)
+			tt.paint(bitmap, len(bitmap)-2*QuietZone)
+			decoded := checkDecoded(t, moduleImage(bitmap, 4, testBlack, testWhite), qr, tt.level)
+			if decoded.Corrected == 0 {
+				t.Error("no codewords corrected in a damaged code")
+			}
+		})
+	}
+
+	t.Run("beyond capacity", func(t *testing.T) {
+		_, bitmap := encodeTestCode(t, content, qrcode.Low)
+		size := len(bitmap) - 2*QuietZone
+		paintModules(bitmap, size/4, size/4, size/2, false)
+		if decoded, err := decodeQRCode(moduleImage(bitmap, 4, testBlack, testWhite)); err == nil {
+			t.Errorf("decoded %q from a code with half of it erased", decoded.Payload)
+		}
+	})
+}
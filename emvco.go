@@ -0,0 +1,472 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxEMVPayloadChars is the largest merchant-presented payload the EMVCo
+	// specification allows
+	MaxEMVPayloadChars = 512
+
+	// Data objects of the EMVCo merchant-presented mode payload
+	emvPayloadFormat     = "00"
+	emvInitiation        = "01"
+	emvCategory          = "52"
+	emvCurrency          = "53"
+	emvAmount            = "54"
+	emvCountry           = "58"
+	emvName              = "59"
+	emvCity              = "60"
+	emvPostalCode        = "61"
+	emvAdditionalData    = "62"
+	emvCRC               = "63"
+	emvBillNumber        = "01"
+	emvReferenceLabel    = "05"
+	emvStaticInitiation  = "11"
+	emvDynamicInitiation = "12"
+
+	// PIXGUID and PayNowGUID identify the merchant account templates of the schemes
+	PIXGUID    = "br.gov.bcb.pix"
+	PayNowGUID = "SG.PAYNOW"
+)
+
+var (
+	emvTagPattern      = regexp.MustCompile(`^[0-9]{2}$`)
+	emvCategoryPattern = regexp.MustCompile(`^[0-9]{4}$`)
+	emvCurrencyPattern = regexp.MustCompile(`^[0-9]{3}$`)
+	pixTxIDPattern     = regexp.MustCompile(`^([A-Za-z0-9]{1,25}|\*\*\*)$`)
+	pixPhonePattern    = regexp.MustCompile(`^\+55[0-9]{10,11}$`)
+	pixEmailPattern    = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+	pixEVPPattern      = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+	payNowMobile       = regexp.MustCompile(`^\+65[3689][0-9]{7}$`)
+	payNowUEN          = regexp.MustCompile(`^([0-9]{8}[A-Z]|[0-9]{9}[A-Z]|[RST][0-9]{2}[A-Z]{2}[0-9]{4}[A-Z])$`)
+
+	// emvCurrencies maps common ISO 4217 alphabetic codes to the numeric codes EMVCo uses.
+	emvCurrencies = map[string]string{
+		"AUD": "036", "BRL": "986", "CHF": "756", "CNY": "156", "EUR": "978", "GBP": "826", "HKD": "344",
+		"IDR": "360", "INR": "356", "JPY": "392", "MXN": "484", "MYR": "458", "PHP": "608", "SGD": "702",
+		"THB": "764", "USD": "840", "VND": "704",
+	}
+)
+
+// emvField is a data object of an EMVCo payload: a 2-digit ID and its value.
+type emvField struct {
+	ID    string
+	Value string
+}
+
+// emvTLV encodes data objects as ID, 2-digit length and value, leaving out empty values.
+func emvTLV(fields ...emvField) string {
+	var b strings.Builder
+	for _, field := range fields {
+		if field.Value != "" {
+			fmt.Fprintf(&b, "%s%02d%s", field.ID, len(field.Value), field.Value)
+		}
+	}
+	return b.String()
+}
+
+// emvMerchant is the content of an EMVCo merchant-presented QR code.
+type emvMerchant struct {
+	Initiation string     // "11" for static codes, "12" for dynamic ones, or "" to leave out
+	Account    emvField   // Merchant account information, a template already encoded for IDs 26 to 51
+	Category   string     // Merchant category code
+	Currency   string     // ISO 4217 numeric code
+	Amount     string     // Transaction amount, or "" for the payer to enter
+	Country    string     // ISO 3166 alpha-2 code
+	Name       string     // Merchant name
+	City       string     // Merchant city
+	PostalCode string     // Postal code, may be ""
+	Additional []emvField // Additional data field template, may be nil
+}
+
+// String encodes the merchant data as an EMVCo merchant-presented payload, ending with
+// its CRC.
+func (m *emvMerchant) String() string {
+	payload := emvTLV(
+		emvField{emvPayloadFormat, "01"}, emvField{emvInitiation, m.Initiation}, m.Account,
+		emvField{emvCategory, m.Category}, emvField{emvCurrency, m.Currency}, emvField{emvAmount, m.Amount},
+		emvField{emvCountry, m.Country}, emvField{emvName, m.Name}, emvField{emvCity, m.City},
+		emvField{emvPostalCode, m.PostalCode}, emvField{emvAdditionalData, emvTLV(m.Additional...)},
+	)
+	payload += emvCRC + "04"
+	return payload + fmt.Sprintf("%04X", crc16CCITT(payload))
+}
+
+// check validates the lengths and character set of the merchant data, which every
+// scheme shares.
+func (m *emvMerchant) check() error {
+	type limit struct {
+		name  string
+		value string
+		max   int
+	}
+	limits := []limit{
+		{"merchant account information", m.Account.Value, 99}, {"merchantName", m.Name, 25},
+		{"merchantCity", m.City, 15}, {"postalCode", m.PostalCode, 10}, {"amount", m.Amount, 13},
+		{"additional data", emvTLV(m.Additional...), 99},
+	}
+	for _, field := range m.Additional {
+		limits = append(limits, limit{"additional data", field.Value, 25})
+	}
+	for _, v := range limits {
+		if len(v.value) > v.max {
+			return fmt.Errorf("Invalid %s: must be at most %d characters", v.name, v.max)
+		}
+		if !isPrintableASCII(v.value) {
+			return fmt.Errorf("Invalid %s: must be printable ASCII; leave out accents", v.name)
+		}
+	}
+	if n := len(m.String()); n > MaxEMVPayloadChars {
+		return fmt.Errorf("Payment payload is %d characters, more than the %d allowed; shorten the text fields", n, MaxEMVPayloadChars)
+	}
+	return nil
+}
+
+// crc16CCITT computes the CRC-16/CCITT-FALSE checksum (polynomial 0x1021, initial value
+// 0xFFFF) that ends EMVCo payloads.
+func crc16CCITT(data string) uint16 {
+	crc := uint16(0xffff)
+	for i := 0; i < len(data); i++ {
+		crc ^= uint16(data[i]) << 8
+		for bit := 0; bit < 8; bit++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// isPrintableASCII reports whether s only holds the printable ASCII characters EMVCo
+// text fields allow.
+func isPrintableASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 || s[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// emvAmountValue formats an amount for the transaction amount data object, or returns
+// "" when it is not set or invalid.
+func emvAmountValue(amount string) string {
+	cents, err := parseAmount(amount)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%d.%02d", cents/100, cents%100)
+}
+
+// emvCurrencyCode returns the numeric ISO 4217 code of a numeric or common alphabetic
+// currency code.
+func emvCurrencyCode(currency string) (string, error) {
+	if emvCurrencyPattern.MatchString(currency) {
+		return currency, nil
+	}
+	if code, ok := emvCurrencies[strings.ToUpper(currency)]; ok {
+		return code, nil
+	}
+	return "", fmt.Errorf("Invalid currency %q: must be a 3-digit ISO 4217 code such as 986, or a common code such as BRL", currency)
+}
+
+// emvcoFields lists the fields of the generic EMVCo merchant-presented payload type.
+var emvcoFields = []PayloadField{
+	optional("merchantAccountTag", "merchant account information ID"), optional("merchantAccountGUID", "merchant account globally unique identifier"),
+	optional("merchantAccountID", "merchant account ID"), optional("merchantCategoryCode", "merchant category code"),
+	required("currency", "currency"), optional("amount", "amount"), required("countryCode", "country code"),
+	required("merchantName", "merchant name"), required("merchantCity", "merchant city"), optional("postalCode", "postal code"),
+	optional("billNumber", "bill number"), optional("referenceLabel", "reference label"), optional("initiation", "point of initiation"),
+}
+
+// emvcoMerchant reads the generic fields. IDs 02 to 25 are reserved for payment networks
+// and hold the account ID as is; IDs 26 to 51 are templates of a globally unique
+// identifier (ID 00) and the account ID (ID 01).
+func emvcoMerchant(get fieldGetter) *emvMerchant {
+	tag := get("merchantAccountTag")
+	if tag == "" {
+		tag = "26"
+	}
+	account := emvField{tag, get("merchantAccountID")}
+	if tag >= "26" {
+		account.Value = emvTLV(emvField{"00", get("merchantAccountGUID")}, emvField{"01", get("merchantAccountID")})
+	}
+	category := get("merchantCategoryCode")
+	if category == "" {
+		category = "0000"
+	}
+	currency, _ := emvCurrencyCode(get("currency"))
+	initiation := emvStaticInitiation
+	if strings.EqualFold(get("initiation"), "dynamic") {
+		initiation = emvDynamicInitiation
+	}
+	return &emvMerchant{
+		Initiation: initiation,
+		Account:    account,
+		Category:   category,
+		Currency:   currency,
+		Amount:     emvAmountValue(get("amount")),
+		Country:    strings.ToUpper(get("countryCode")),
+		Name:       get("merchantName"),
+		City:       get("merchantCity"),
+		PostalCode: get("postalCode"),
+		Additional: []emvField{{emvBillNumber, get("billNumber")}, {emvReferenceLabel, get("referenceLabel")}},
+	}
+}
+
+// checkEMVCoFields validates the generic merchant-presented fields.
+func checkEMVCoFields(get fieldGetter) error {
+	tag := get("merchantAccountTag")
+	switch {
+	case tag == "":
+	case !emvTagPattern.MatchString(tag) || tag < "02" || tag > "51":
+		return fmt.Errorf("Invalid merchantAccountTag %q: must be an ID from 02 to 51", tag)
+	case tag < "26":
+		if get("merchantAccountGUID") != "" {
+			return errors.New("Invalid merchantAccountGUID: IDs 02 to 25 hold the account ID without a template")
+		}
+		if get("merchantAccountID") == "" {
+			return errors.New("Missing merchant account ID")
+		}
+	}
+	if tag == "" || tag >= "26" {
+		if get("merchantAccountGUID") == "" {
+			return errors.New("Missing merchant account globally unique identifier")
+		}
+		if len(get("merchantAccountGUID")) > 32 {
+			return errors.New("Invalid merchantAccountGUID: must be at most 32 characters")
+		}
+	}
+
+	if category := get("merchantCategoryCode"); category != "" && !emvCategoryPattern.MatchString(category) {
+		return fmt.Errorf("Invalid merchantCategoryCode %q: must be a 4-digit ISO 18245 code", category)
+	}
+	if _, err := emvCurrencyCode(get("currency")); err != nil {
+		return err
+	}
+	if amount := get("amount"); amount != "" {
+		if _, err := parseAmount(amount); err != nil {
+			return err
+		}
+	}
+	if country := strings.ToUpper(get("countryCode")); !countryPattern.MatchString(country) {
+		return fmt.Errorf("Invalid countryCode %q: must be a 2-letter ISO 3166 country code", get("countryCode"))
+	}
+	if initiation := strings.ToLower(get("initiation")); initiation != "" && initiation != "static" && initiation != "dynamic" {
+		return fmt.Errorf("Invalid initiation %q: must be static or dynamic", get("initiation"))
+	}
+	return emvcoMerchant(get).check()
+}
+
+// pixFields lists the fields of the Brazilian PIX payload type.
+var pixFields = []PayloadField{
+	required("key", "PIX key"), required("merchantName", "merchant name"), required("merchantCity", "merchant city"),
+	optional("amount", "amount"), optional("description", "description"), optional("txid", "transaction ID"),
+}
+
+// pixMerchant builds a static PIX BR Code, with the key and description in the merchant
+// account template under ID 26. The transaction ID defaults to "***", for none.
+func pixMerchant(get fieldGetter) *emvMerchant {
+	key, _ := pixKey(get("key"))
+	txid := get("txid")
+	if txid == "" {
+		txid = "***"
+	}
+	return &emvMerchant{
+		Account:    emvField{"26", emvTLV(emvField{"00", PIXGUID}, emvField{"01", key}, emvField{"02", get("description")})},
+		Category:   "0000",
+		Currency:   emvCurrencies["BRL"],
+		Amount:     emvAmountValue(get("amount")),
+		Country:    "BR",
+		Name:       get("merchantName"),
+		City:       get("merchantCity"),
+		Additional: []emvField{{emvReferenceLabel, txid}},
+	}
+}
+
+// checkPIXFields validates the PIX key, amount and transaction ID.
+func checkPIXFields(get fieldGetter) error {
+	if _, err := pixKey(get("key")); err != nil {
+		return err
+	}
+	if amount := get("amount"); amount != "" {
+		if _, err := parseAmount(amount); err != nil {
+			return err
+		}
+	}
+	if txid := get("txid"); txid != "" && !pixTxIDPattern.MatchString(txid) {
+		return fmt.Errorf("Invalid txid %q: must be at most 25 letters and digits", txid)
+	}
+	return pixMerchant(get).check()
+}
+
+// pixKey validates a PIX key and returns it as registered: an email address, a phone
+// number with +55, a CPF or CNPJ with its check digits and without punctuation, or a
+// random key (EVP).
+func pixKey(key string) (string, error) {
+	key = strings.TrimSpace(key)
+	digits := strings.NewReplacer(".", "", "-", "", "/", "", " ", "").Replace(key)
+	switch {
+	case strings.Contains(key, "@"):
+		if !pixEmailPattern.MatchString(key) || len(key) > 77 {
+			return "", fmt.Errorf("Invalid key %q: not a valid email address", key)
+		}
+		return strings.ToLower(key), nil
+	case strings.HasPrefix(key, "+"):
+		if !pixPhonePattern.MatchString(digits) {
+			return "", fmt.Errorf("Invalid key %q: phone keys are +55 followed by the area code and number", key)
+		}
+		return digits, nil
+	case pixEVPPattern.MatchString(strings.ToLower(key)):
+		return strings.ToLower(key), nil
+	case len(digits) == 11 && isDigits(digits):
+		if !validCPF(digits) {
+			return "", fmt.Errorf("Invalid key %q: wrong CPF check digits", key)
+		}
+		return digits, nil
+	case len(digits) == 14 && isDigits(digits):
+		if !validCNPJ(digits) {
+			return "", fmt.Errorf("Invalid key %q: wrong CNPJ check digits", key)
+		}
+		return digits, nil
+	}
+	return "", fmt.Errorf("Invalid key %q: must be an email address, +55 phone number, CPF, CNPJ or random key", key)
+}
+
+// isDigits reports whether s only holds ASCII digits.
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// validCPF checks the two modulo 11 check digits of an 11-digit CPF.
+func validCPF(cpf string) bool {
+	if strings.Count(cpf, cpf[:1]) == len(cpf) {
+		return false
+	}
+	for n := 9; n <= 10; n++ {
+		sum := 0
+		for i := 0; i < n; i++ {
+			sum += int(cpf[i]-'0') * (n + 1 - i)
+		}
+		if digit := sum * 10 % 11 % 10; digit != int(cpf[n]-'0') {
+			return false
+		}
+	}
+	return true
+}
+
+// validCNPJ checks the two modulo 11 check digits of a 14-digit CNPJ.
+func validCNPJ(cnpj string) bool {
+	if strings.Count(cnpj, cnpj[:1]) == len(cnpj) {
+		return false
+	}
+	weights := []int{6, 5, 4, 3, 2, 9, 8, 7, 6, 5, 4, 3, 2}
+	for n := 12; n <= 13; n++ {
+		sum := 0
+		for i := 0; i < n; i++ {
+			sum += int(cnpj[i]-'0') * weights[13-n+i]
+		}
+		digit := 0
+		if r := sum % 11; r >= 2 {
+			digit = 11 - r
+		}
+		if digit != int(cnpj[n]-'0') {
+			return false
+		}
+	}
+	return true
+}
+
+// payNowFields lists the fields of the Singapore PayNow payload type.
+var payNowFields = []PayloadField{
+	optional("mobile", "mobile number"), optional("uen", "UEN"), required("merchantName", "merchant name"),
+	optional("amount", "amount"), optional("editable", "amount editable"), optional("expiry", "expiry date"),
+	optional("reference", "reference"),
+}
+
+// payNowProxy returns the proxy type (0 for a mobile number, 2 for a UEN) and value of
+// a PayNow account. Mobile numbers may leave out the +65 prefix.
+func payNowProxy(get fieldGetter) (string, string) {
+	if uen := strings.ToUpper(strings.TrimSpace(get("uen"))); uen != "" {
+		return "2", uen
+	}
+	mobile := strings.ReplaceAll(get("mobile"), " ", "")
+	if len(mobile) == 8 {
+		mobile = "+65" + mobile
+	}
+	return "0", mobile
+}
+
+// payNowMerchant builds a PayNow code. The amount is editable unless it is set and
+// editable is false, which makes the code dynamic.
+func payNowMerchant(get fieldGetter) *emvMerchant {
+	proxyType, proxy := payNowProxy(get)
+	amount := emvAmountValue(get("amount"))
+	editable, initiation := "1", emvStaticInitiation
+	if amount != "" && strings.EqualFold(get("editable"), "false") {
+		editable, initiation = "0", emvDynamicInitiation
+	}
+	expiry := ""
+	if t, err := time.Parse("2006-01-02", get("expiry")); err == nil {
+		expiry = t.Format("20060102")
+	}
+	return &emvMerchant{
+		Initiation: initiation,
+		Account: emvField{"26", emvTLV(
+			emvField{"00", PayNowGUID}, emvField{"01", proxyType}, emvField{"02", proxy},
+			emvField{"03", editable}, emvField{"04", expiry},
+		)},
+		Category:   "0000",
+		Currency:   emvCurrencies["SGD"],
+		Amount:     amount,
+		Country:    "SG",
+		Name:       get("merchantName"),
+		City:       "Singapore",
+		Additional: []emvField{{emvBillNumber, get("reference")}},
+	}
+}
+
+// checkPayNowFields validates the PayNow proxy, amount and expiry date.
+func checkPayNowFields(get fieldGetter) error {
+	switch {
+	case get("mobile") == "" && get("uen") == "":
+		return errors.New("Missing mobile number or UEN")
+	case get("mobile") != "" && get("uen") != "":
+		return errors.New("Set mobile or uen, not both")
+	}
+	if proxyType, proxy := payNowProxy(get); proxyType == "0" && !payNowMobile.MatchString(proxy) {
+		return fmt.Errorf("Invalid mobile %q: must be a Singapore number, e.g. +6581234567", get("mobile"))
+	} else if proxyType == "2" && !payNowUEN.MatchString(proxy) {
+		return fmt.Errorf("Invalid uen %q: not a valid Unique Entity Number", get("uen"))
+	}
+	if amount := get("amount"); amount != "" {
+		if _, err := parseAmount(amount); err != nil {
+			return err
+		}
+	}
+	if editable := get("editable"); editable != "" {
+		if _, err := strconv.ParseBool(editable); err != nil {
+			return fmt.Errorf("Invalid editable %q: must be true or false", editable)
+		}
+	}
+	if expiry := get("expiry"); expiry != "" {
+		if _, err := time.Parse("2006-01-02", expiry); err != nil {
+			return fmt.Errorf("Invalid expiry %q: must be a date as YYYY-MM-DD", expiry)
+		}
+	}
+	return payNowMerchant(get).check()
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// pixSample is the static BR Code with a random key of the BCB BR Code manual.
+const pixSample = "00020126580014br.gov.bcb.pix0136123e4567-e12b-12d1-a456-4266554400005204000053039865802BR5913Fulano de Tal6008BRASILIA62070503***63041D3D"
+
+func TestCRC16CCITT(t *testing.T) {
+	tests := []struct {
+		data string
+		want uint16
+	}{
+		// The check value of CRC-16/CCITT-FALSE
+		{"123456789", 0x29b1},
+		{"", 0xffff},
+		{pixSample[:len(pixSample)-4], 0x1d3d},
+	}
+	for _, tt := range tests {
+		if got := crc16CCITT(tt.data); got != tt.want {
+			t.Errorf("crc16CCITT(%q) = %04X, want %04X", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestEMVTLV(t *testing.T) {
+	got := emvTLV(emvField{"00", "01"}, emvField{"01", ""}, emvField{"59", "Fulano de Tal"})
+	if want := "0002015913Fulano de Tal"; got != want {
+		t.Errorf("emvTLV = %q, want %q", got, want)
+	}
+}
+
+func TestParseEMVTLV(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want map[string]string
+	}{
+		{"objects", "0002015913Fulano de Tal", map[string]string{"00": "01", "59": "Fulano de Tal"}},
+		{"missing length", "000201010059", nil},
+		{"zero length", "00020101005900", map[string]string{"00": "01", "01": "", "59": ""}},
+		{"empty", "", map[string]string{}},
+		{"negative length", "00-1abc", nil},
+		{"signed length", "00+5abcde", nil},
+		{"space in length", "00 5abcde", nil},
+		{"non-digit length", "000xabc", nil},
+		{"short header", "000", nil},
+		{"truncated value", "0005abc", nil},
+		{"trailing bytes", "000201X", nil},
+	}
+	for _, tt := range tests {
+		if got := parseEMVTLV(tt.data); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: parseEMVTLV(%q) = %v, want %v", tt.name, tt.data, got, tt.want)
+		}
+	}
+
+	// Malformed lengths behind a valid CRC must not panic, whether at the top level, which
+	// makes the payload unreadable, or inside the additional data and account templates
+	for _, data := range []string{"00-1", "0002016204" + "05-1", "0002012608" + "000001-1"} {
+		payload := data + emvCRC + "04"
+		payload += fmt.Sprintf("%04X", crc16CCITT(payload))
+		name, fields := parseEMVPayload(payload)
+		if data == "00-1" && fields != nil {
+			t.Errorf("parseEMVPayload(%q) = %s, %v, want nil", payload, name, fields)
+		}
+	}
+}
+
+func TestPIXMerchant(t *testing.T) {
+	sample := map[string]string{
+		"key": "123E4567-E12B-12D1-A456-426655440000", "merchantName": "Fulano de Tal", "merchantCity": "BRASILIA",
+	}
+	if err := checkPIXFields(fields(sample)); err != nil {
+		t.Fatalf("checkPIXFields: %v", err)
+	}
+	if got := pixMerchant(fields(sample)).String(); got != pixSample {
+		t.Errorf("pixMerchant:\n%s\nwant\n%s", got, pixSample)
+	}
+
+	// Amount, description and transaction ID
+	full := merge(sample, map[string]string{"amount": "10,5", "description": "Pedido 42", "txid": "PEDIDO42"})
+	got := pixMerchant(fields(full)).String()
+	want := "00020126710014br.gov.bcb.pix0136123e4567-e12b-12d1-a456-4266554400000209Pedido 42" +
+		"520400005303986540510.505802BR5913Fulano de Tal6008BRASILIA62120508PEDIDO426304"
+	if !strings.HasPrefix(got, want) || !validEMVCRC(got) {
+		t.Errorf("pixMerchant:\n%s\nwant\n%s and its CRC", got, want)
+	}
+}
+
+func TestPIXKey(t *testing.T) {
+	tests := []struct {
+		key     string
+		want    string
+		wantErr string
+	}{
+		{"Fulano@Example.com", "fulano@example.com", ""},
+		{"+55 61 99999-8888", "+5561999998888", ""},
+		{"+55 61 9999", "", "phone keys are +55"},
+		{"529.982.247-25", "52998224725", ""},
+		{"52998224726", "", "wrong CPF check digits"},
+		{"11.222.333/0001-81", "11222333000181", ""},
+		{"11222333000182", "", "wrong CNPJ check digits"},
+		{"123E4567-E12B-12D1-A456-426655440000", "123e4567-e12b-12d1-a456-426655440000", ""},
+		{"fulano@", "", "not a valid email address"},
+		{"12345", "", "must be an email address"},
+	}
+	for _, tt := range tests {
+		got, err := pixKey(tt.key)
+		if got != tt.want || !checkError(err, tt.wantErr) {
+			t.Errorf("pixKey(%q) = %q, %v; want %q, %q", tt.key, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestValidCPF(t *testing.T) {
+	tests := []struct {
+		cpf  string
+		want bool
+	}{
+		{"52998224725", true},
+		{"11144477735", true},
+		{"12345678909", true},
+		{"12345678900", false},
+		{"52998224752", false},
+		{"11111111111", false},
+		{"00000000000", false},
+	}
+	for _, tt := range tests {
+		if got := validCPF(tt.cpf); got != tt.want {
+			t.Errorf("validCPF(%q) = %t, want %t", tt.cpf, got, tt.want)
+		}
+	}
+}
+
+func TestValidCNPJ(t *testing.T) {
+	tests := []struct {
+		cnpj string
+		want bool
+	}{
+		{"11222333000181", true},
+		{"11444777000161", true},
+		{"11222333000182", false},
+		{"11222333000191", false},
+		{"00000000000000", false},
+	}
+	for _, tt := range tests {
+		if got := validCNPJ(tt.cnpj); got != tt.want {
+			t.Errorf("validCNPJ(%q) = %t, want %t", tt.cnpj, got, tt.want)
+		}
+	}
+}
+
+func TestPayNowMerchant(t *testing.T) {
+	values := map[string]string{
+		"uen": "201403121w", "merchantName": "Example Pte Ltd", "amount": "12.5", "editable": "false",
+		"expiry": "2026-12-31", "reference": "INV42",
+	}
+	if err := checkPayNowFields(fields(values)); err != nil {
+		t.Fatalf("checkPayNowFields: %v", err)
+	}
+	want := "00020101021226490009SG.PAYNOW010120210201403121W03010040820261231" +
+		"520400005303702540512.505802SG5915Example Pte Ltd6009Singapore62090105INV42630498C8"
+	if got := payNowMerchant(fields(values)).String(); got != want {
+		t.Errorf("payNowMerchant:\n%s\nwant\n%s", got, want)
+	}
+
+	// A mobile number without +65 and an editable amount make a static code
+	mobile := map[string]string{"mobile": "8123 4567", "merchantName": "Example", "amount": "5"}
+	got := payNowMerchant(fields(mobile)).String()
+	if want := "00020101021126380009SG.PAYNOW010100211+658123456703011"; !strings.HasPrefix(got, want) {
+		t.Errorf("payNowMerchant:\n%s\nwant prefix\n%s", got, want)
+	}
+}
+
+func TestCheckPayNowFields(t *testing.T) {
+	tests := []struct {
+		values  map[string]string
+		wantErr string
+	}{
+		{map[string]string{"mobile": "+6581234567"}, ""},
+		{map[string]string{"uen": "S61SS0001A"}, ""},
+		{map[string]string{}, "Missing mobile number or UEN"},
+		{map[string]string{"mobile": "+6581234567", "uen": "201403121W"}, "not both"},
+		{map[string]string{"mobile": "+6521234567"}, "must be a Singapore number"},
+		{map[string]string{"uen": "12345"}, "not a valid Unique Entity Number"},
+		{map[string]string{"mobile": "81234567", "editable": "maybe"}, "must be true or false"},
+		{map[string]string{"mobile": "81234567", "expiry": "31/12/2026"}, "must be a date"},
+	}
+	for _, tt := range tests {
+		values := merge(map[string]string{"merchantName": "Example"}, tt.values)
+		if err := checkPayNowFields(fields(values)); !checkError(err, tt.wantErr) {
+			t.Errorf("checkPayNowFields(%v) = %v, want %q", tt.values, err, tt.wantErr)
+		}
+	}
+}
+
+func TestEMVCoMerchant(t *testing.T) {
+	values := map[string]string{
+		"merchantAccountGUID": "com.example", "merchantAccountID": "12345", "currency": "usd", "amount": "9.99",
+		"countryCode": "us", "merchantName": "Shop", "merchantCity": "Austin", "billNumber": "B1",
+	}
+	if err := checkEMVCoFields(fields(values)); err != nil {
+		t.Fatalf("checkEMVCoFields: %v", err)
+	}
+	want := "00020101021126240011com.example01051234552040000530384054049.995802US5904Shop6006Austin62060102B163048346"
+	if got := emvcoMerchant(fields(values)).String(); got != want {
+		t.Errorf("emvcoMerchant:\n%s\nwant\n%s", got, want)
+	}
+
+	// IDs reserved for payment networks hold the account ID as is
+	network := merge(values, map[string]string{"merchantAccountTag": "04", "merchantAccountGUID": "", "initiation": "dynamic"})
+	if got := emvcoMerchant(fields(network)).String(); !strings.HasPrefix(got, "000201010212040512345") {
+		t.Errorf("emvcoMerchant: got %s", got)
+	}
+}
+
+func TestCheckEMVCoFields(t *testing.T) {
+	base := map[string]string{
+		"merchantAccountGUID": "com.example", "merchantAccountID": "12345", "currency": "840",
+		"countryCode": "US", "merchantName": "Shop", "merchantCity": "Austin",
+	}
+	tests := []struct {
+		values  map[string]string
+		wantErr string
+	}{
+		{nil, ""},
+		{map[string]string{"merchantAccountTag": "52"}, "must be an ID from 02 to 51"},
+		{map[string]string{"merchantAccountTag": "04"}, "IDs 02 to 25 hold the account ID"},
+		{map[string]string{"merchantAccountTag": "04", "merchantAccountGUID": "", "merchantAccountID": ""}, "Missing merchant account ID"},
+		{map[string]string{"merchantAccountGUID": ""}, "Missing merchant account globally unique identifier"},
+		{map[string]string{"merchantCategoryCode": "581"}, "4-digit ISO 18245 code"},
+		{map[string]string{"currency": "dollars"}, "Invalid currency"},
+		{map[string]string{"countryCode": "USA"}, "Invalid countryCode"},
+		{map[string]string{"initiation": "once"}, "must be static or dynamic"},
+		{map[string]string{"merchantName": "Café"}, "must be printable ASCII"},
+		{map[string]string{"merchantCity": strings.Repeat("c", 16)}, "at most 15 characters"},
+	}
+	for _, tt := range tests {
+		if err := checkEMVCoFields(fields(merge(base, tt.values))); !checkError(err, tt.wantErr) {
+			t.Errorf("checkEMVCoFields(%v) = %v, want %q", tt.values, err, tt.wantErr)
+		}
+	}
+}
+
+// validEMVCRC reports whether a payload ends with the CRC of the rest of it.
+func validEMVCRC(payload string) bool {
+	n := len(payload) - 4
+	return n >= 0 && payload[n:] == fmt.Sprintf("%04X", crc16CCITT(payload[:n]))
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// MaxEPCPayloadBytes is the largest payload the EPC069-12 guidelines allow
+	MaxEPCPayloadBytes = 331
+
+	// EPCECC is the error correction level the guidelines require
+	EPCECC = "M"
+
+	// Largest amount of a SEPA or Swiss QR-bill payment code, in cents
+	maxAmountCents = 99999999999
+)
+
+var (
+	// ibanLengths holds the IBAN length of each country of the SEPA scheme.
+	ibanLengths = map[string]int{
+		"AD": 24, "AT": 20, "BE": 16, "BG": 22, "CH": 21, "CY": 28, "CZ": 24, "DE": 22, "DK": 18,
+		"EE": 20, "ES": 24, "FI": 18, "FR": 27, "GB": 22, "GI": 23, "GR": 27, "HR": 21, "HU": 28,
+		"IE": 22, "IS": 26, "IT": 27, "LI": 21, "LT": 20, "LU": 20, "LV": 21, "MC": 27, "MT": 31,
+		"NL": 18, "NO": 15, "PL": 28, "PT": 25, "RO": 24, "SE": 24, "SI": 19, "SK": 24, "SM": 27,
+		"VA": 22,
+	}
+
+	bicPattern     = regexp.MustCompile(`^[A-Z]{4}[A-Z]{2}[A-Z0-9]{2}([A-Z0-9]{3})?$`)
+	purposePattern = regexp.MustCompile(`^[A-Z]{4}$`)
+	amountPattern  = regexp.MustCompile(`^[0-9]{1,9}([.,][0-9]{1,2})?$`)
+	rfPattern      = regexp.MustCompile(`^RF[0-9]{2}[A-Z0-9]{1,21}$`)
+)
+
+// epcFields lists the fields of the SEPA credit transfer payload type.
+var epcFields = []PayloadField{
+	required("name", "beneficiary name"), required("iban", "IBAN"), optional("bic", "BIC"),
+	optional("amount", "amount"), optional("purpose", "purpose code"),
+	optional("reference", "creditor reference"), optional("remittanceText", "remittance text"),
+	optional("info", "beneficiary to originator information"),
+}
+
+// epcFieldLengths holds the maximum length in characters of the text fields.
+var epcFieldLengths = map[string]int{"name": 70, "reference": 35, "remittanceText": 140, "info": 70}
+
+// checkEPCFields validates the payment fields against the EPC069-12 guidelines.
+func checkEPCFields(get fieldGetter) error {
+	for _, field := range epcFields {
+		if strings.ContainsAny(get(field.Name), "\r\n") {
+			return fmt.Errorf("Invalid %s: must be a single line", field.Name)
+		}
+		if max, ok := epcFieldLengths[field.Name]; ok && utf8.RuneCountInString(get(field.Name)) > max {
+			return fmt.Errorf("Invalid %s: must be at most %d characters", field.Name, max)
+		}
+	}
+
+	if err := checkIBAN(compactCode(get("iban"))); err != nil {
+		return err
+	}
+	if bic := compactCode(get("bic")); bic != "" && !bicPattern.MatchString(bic) {
+		return fmt.Errorf("Invalid BIC %q: must be 8 or 11 letters and digits", get("bic"))
+	}
+	if amount := get("amount"); amount != "" {
+		if _, err := parseAmount(amount); err != nil {
+			return err
+		}
+	}
+	if purpose := get("purpose"); purpose != "" && !purposePattern.MatchString(strings.ToUpper(purpose)) {
+		return fmt.Errorf("Invalid purpose %q: must be a 4-letter ISO 20022 purpose code such as CHAR", purpose)
+	}
+
+	// The reference and the text are alternatives
+	if reference := get("reference"); reference != "" {
+		if get("remittanceText") != "" {
+			return errors.New("Set reference or remittanceText, not both")
+		}
+		if rf := compactCode(reference); strings.HasPrefix(rf, "RF") && (!rfPattern.MatchString(rf) || mod97(rf[4:]+rf[:4]) != 1) {
+			return fmt.Errorf("Invalid reference %q: wrong ISO 11649 creditor reference check digits", reference)
+		}
+	}
+
+	if n := len(epcPayload(get)); n > MaxEPCPayloadBytes {
+		return fmt.Errorf("Payment payload is %d bytes, more than the %d allowed; shorten the text fields", n, MaxEPCPayloadBytes)
+	}
+	return nil
+}
+
+// checkIBAN validates the country, length and check digits of a compact IBAN.
+func checkIBAN(iban string) error {
+	if len(iban) < 2 {
+		return errors.New("Invalid IBAN")
+	}
+	length, ok := ibanLengths[iban[:2]]
+	if !ok {
+		return fmt.Errorf("Invalid IBAN: %s is not a SEPA country", iban[:2])
+	}
+	if len(iban) != length {
+		return fmt.Errorf("Invalid IBAN: %s IBANs have %d characters, not %d", iban[:2], length, len(iban))
+	}
+	if mod97(iban[4:]+iban[:4]) != 1 {
+		return errors.New("Invalid IBAN: wrong check digits")
+	}
+	return nil
+}
+
+// mod97 computes the ISO 7064 MOD 97-10 remainder used by IBANs and creditor references,
+// reading letters as 10 to 35. It returns -1 for other characters.
+func mod97(s string) int {
+	remainder := 0
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			remainder = (remainder*10 + int(r-'0')) % 97
+		case r >= 'A' && r <= 'Z':
+			remainder = (remainder*100 + int(r-'A') + 10) % 97
+		default:
+			return -1
+		}
+	}
+	return remainder
+}
+
+// compactCode removes the spaces printed in IBANs, BICs and references and upper cases them.
+func compactCode(s string) string {
+	return strings.ToUpper(strings.ReplaceAll(s, " ", ""))
+}
+
+// parseAmount reads an amount with a decimal point or comma into cents.
+func parseAmount(amount string) (int64, error) {
+	if !amountPattern.MatchString(amount) {
+		return 0, fmt.Errorf("Invalid amount %q: must be a number with at most 2 decimals", amount)
+	}
+	euros, cents, _ := strings.Cut(strings.Replace(amount, ",", ".", 1), ".")
+	value, _ := strconv.ParseInt(euros, 10, 64)
+	value *= 100
+	if cents != "" {
+		c, _ := strconv.ParseInt((cents + "0")[:2], 10, 64)
+		value += c
+	}
+	if value < 1 || value > maxAmountCents {
+		return 0, fmt.Errorf("Invalid amount %q: must be between 0.01 and 999999999.99", amount)
+	}
+	return value, nil
+}
+
+// epcPayload builds the EPC069-12 version 002 payload of a SEPA credit transfer, UTF-8
+// encoded, leaving out trailing empty elements.
+func epcPayload(get fieldGetter) string {
+	amount := ""
+	if cents, err := parseAmount(get("amount")); err == nil {
+		amount = fmt.Sprintf("EUR%d.%02d", cents/100, cents%100)
+	}
+	reference := get("reference")
+	if strings.HasPrefix(compactCode(reference), "RF") {
+		reference = compactCode(reference)
+	}
+	lines := []string{
+		"BCD", "002", "1", "SCT",
+		compactCode(get("bic")), get("name"), compactCode(get("iban")),
+		amount, strings.ToUpper(get("purpose")), reference, get("remittanceText"), get("info"),
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
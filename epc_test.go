@@ -0,0 +1,143 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMod97(t *testing.T) {
+	tests := []struct {
+		input string
+		want  int
+	}{
+		// GB82 WEST 1234 5698 7654 32, rearranged with letters as digits
+		{"3214282912345698765432161182", 1},
+		{"WEST12345698765432GB82", 1},
+		{"WEST12345698765432GB83", 2},
+		{"539007547034RF18", 1},
+		{"97", 0},
+		{"", 0},
+		{"west", -1},
+		{"1234-5", -1},
+	}
+	for _, tt := range tests {
+		if got := mod97(tt.input); got != tt.want {
+			t.Errorf("mod97(%q) = %d, want %d", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestCheckIBAN(t *testing.T) {
+	tests := []struct {
+		iban    string
+		wantErr string
+	}{
+		{"DE89370400440532013000", ""},
+		{"GB82WEST12345698765432", ""},
+		{"BE72000000001616", ""},
+		{"FR1420041010050500013M02606", ""},
+		{"CH9300762011623852957", ""},
+		{"DE88370400440532013000", "wrong check digits"},
+		{"DE89370400440532013001", "wrong check digits"},
+		{"GB82WEST1234569876543", "GB IBANs have 22 characters, not 21"},
+		{"US12345678901234", "US is not a SEPA country"},
+		{"D", "Invalid IBAN"},
+		{"DE89-70400440532013000", "wrong check digits"},
+	}
+	for _, tt := range tests {
+		if err := checkIBAN(tt.iban); !checkError(err, tt.wantErr) {
+			t.Errorf("checkIBAN(%q) = %v, want %q", tt.iban, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCompactCode(t *testing.T) {
+	if got := compactCode("de89 3704 0044 0532 0130 00"); got != "DE89370400440532013000" {
+		t.Errorf("compactCode = %q", got)
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		amount  string
+		want    int64
+		wantErr bool
+	}{
+		{"1", 100, false},
+		{"12.5", 1250, false},
+		{"12,50", 1250, false},
+		{"0.01", 1, false},
+		{"999999999.99", maxAmountCents, false},
+		{"0", 0, true},
+		{"0.00", 0, true},
+		{"1.234", 0, true},
+		{"-1", 0, true},
+		{"1e3", 0, true},
+		{"1 000", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseAmount(tt.amount)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseAmount(%q) = %d, %v; want %d, error %t", tt.amount, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestEPCPayload(t *testing.T) {
+	// The sample of the EPC069-12 guidelines, with the amount written with cents
+	sample := map[string]string{
+		"name": "Red Cross of Belgium", "iban": "BE72 0000 0000 1616", "bic": "BPOTBEB1",
+		"amount": "1", "purpose": "char", "remittanceText": "Urgency fund",
+	}
+	want := "BCD\n002\n1\nSCT\nBPOTBEB1\nRed Cross of Belgium\nBE72000000001616\nEUR1.00\nCHAR\n\nUrgency fund"
+	if err := checkEPCFields(fields(sample)); err != nil {
+		t.Fatalf("checkEPCFields: %v", err)
+	}
+	if got := epcPayload(fields(sample)); got != want {
+		t.Errorf("epcPayload:\n%q\nwant\n%q", got, want)
+	}
+
+	// A creditor reference is written compact, and trailing empty elements are left out
+	minimal := map[string]string{"name": "Example", "iban": "DE89370400440532013000", "reference": "rf18 5390 0754 7034"}
+	if got, want := epcPayload(fields(minimal)), "BCD\n002\n1\nSCT\n\nExample\nDE89370400440532013000\n\n\nRF18539007547034"; got != want {
+		t.Errorf("epcPayload:\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestCheckEPCFields(t *testing.T) {
+	base := map[string]string{"name": "Example", "iban": "DE89370400440532013000"}
+	tests := []struct {
+		name    string
+		values  map[string]string
+		wantErr string
+	}{
+		{"minimal", nil, ""},
+		{"creditor reference", map[string]string{"reference": "RF18 5390 0754 7034"}, ""},
+		{"other reference", map[string]string{"reference": "Invoice 42"}, ""},
+		{"wrong creditor reference", map[string]string{"reference": "RF19539007547034"}, "creditor reference check digits"},
+		{"malformed creditor reference", map[string]string{"reference": "RF18-5390"}, "creditor reference check digits"},
+		{"reference and text", map[string]string{"reference": "RF18539007547034", "remittanceText": "Invoice"}, "not both"},
+		{"wrong IBAN", map[string]string{"iban": "DE88370400440532013000"}, "wrong check digits"},
+		{"BIC", map[string]string{"bic": "cobadeffxxx"}, ""},
+		{"wrong BIC", map[string]string{"bic": "COBADE"}, "Invalid BIC"},
+		{"purpose", map[string]string{"purpose": "GDDS"}, ""},
+		{"wrong purpose", map[string]string{"purpose": "GOODS"}, "Invalid purpose"},
+		{"amount", map[string]string{"amount": "0"}, "Invalid amount"},
+		{"line break", map[string]string{"remittanceText": "a\nb"}, "single line"},
+		{"long name", map[string]string{"name": strings.Repeat("n", 71)}, "at most 70 characters"},
+		{"long payload", map[string]string{"remittanceText": strings.Repeat("€", 140), "info": strings.Repeat("€", 70)}, "more than the 331 allowed"},
+	}
+	for _, tt := range tests {
+		values := map[string]string{}
+		for k, v := range base {
+			values[k] = v
+		}
+		for k, v := range tt.values {
+			values[k] = v
+		}
+		if err := checkEPCFields(fields(values)); !checkError(err, tt.wantErr) {
+			t.Errorf("%s: checkEPCFields = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,500 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	// Embed the time zone database so TZID time zones work on hosts without one
+	_ "time/tzdata"
+)
+
+const (
+	// EventProductID identifies the generator in the PRODID of every calendar
+	EventProductID = "-//GoQrCodeGen//QR Code Generator//EN"
+
+	// UTCTimeZone converts every time to UTC instead of writing a TZID
+	UTCTimeZone = "UTC"
+
+	// EventStampField is the optional field setting the DTSTAMP, the generation time by default
+	EventStampField = "dtstamp"
+
+	// MaxRepeat limits repeatInterval and repeatCount
+	MaxRepeat = 999
+
+	// MaxReminderMinutes limits how long before the start a reminder can fire: four weeks
+	MaxReminderMinutes = 4 * 7 * 24 * 60
+
+	// Layouts of iCalendar DATE and DATE-TIME values
+	icalDate     = "20060102"
+	icalDateTime = "20060102T150405"
+)
+
+var (
+	// eventRepeatFrequencies maps the repeat field to the RRULE frequency.
+	eventRepeatFrequencies = map[string]string{"daily": "DAILY", "weekly": "WEEKLY", "monthly": "MONTHLY", "yearly": "YEARLY"}
+
+	// eventTimeLayouts are the accepted date-time inputs without a UTC offset: HTML
+	// datetime-local values, with or without seconds, and iCalendar local times.
+	eventTimeLayouts = []string{"2006-01-02T15:04", "2006-01-02T15:04:05", icalDateTime}
+
+	// eventZonedLayouts are the accepted date-time inputs with a UTC offset.
+	eventZonedLayouts = []string{time.RFC3339, "2006-01-02T15:04Z07:00", icalDateTime + "Z"}
+
+	// icalWeekdays are the RRULE abbreviations of the days of the week.
+	icalWeekdays = [...]string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+	// icalEscaper escapes TEXT values, which RFC 5545 escapes like vCard.
+	icalEscaper = vCardEscaper
+)
+
+// eventFields lists the fields of the event payload type. endDateTime is only optional
+// for all-day events.
+var eventFields = []PayloadField{
+	required("eventName", "event name"), required("startDateTime", "start date and time"),
+	optional("endDateTime", "end date and time"), optional("location", "location"), optional("description", "description"),
+	optional("allDay", "all-day event"), optional("timezone", "time zone"),
+	optional("repeat", "repeat frequency"), optional("repeatInterval", "repeat interval"),
+	optional("repeatCount", "repeat count"), optional("repeatUntil", "repeat end date"),
+	optional("reminder", "reminder"), optional("organizer", "organizer email"), optional("organizerName", "organizer name"),
+	optional("url", "URL"), optional("uid", "UID"), optional(EventStampField, "creation time"),
+}
+
+// calEvent is a calendar event that can be written as an iCalendar object.
+type calEvent struct {
+	Summary, Location, Description string
+	Start, End                     time.Time // End is the last day of all-day events
+	AllDay                         bool
+	Zone                           string         // "" for floating local times, UTC, or a TZID
+	TZ                             *time.Location // Location of the times
+	Frequency                      string         // RRULE frequency, or "" for single events
+	Interval, Count                int            // 0 when absent
+	Until                          time.Time      // Last day of the recurrence, zero when absent
+	Reminder                       int            // Minutes before the start, -1 for no alarm
+	OrganizerEmail, OrganizerName  string
+	URL                            string
+	UID                            string    // Generated from the summary and start when empty
+	Stamp                          time.Time // DTSTAMP, zero to use the generation time
+}
+
+// eventFromFields builds and validates a calendar event from the request fields.
+func eventFromFields(get fieldGetter) (*calEvent, error) {
+	event := &calEvent{
+		Summary: get("eventName"), Location: get("location"), Description: get("description"),
+		URL: get("url"), UID: get("uid"), Reminder: -1, TZ: time.UTC,
+	}
+
+	if value := get("allDay"); value != "" {
+		allDay, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid allDay %q: must be true or false", value)
+		}
+		event.AllDay = allDay
+	}
+
+	// Dates of all-day events have no time zone
+	if zone := get("timezone"); zone != "" && !event.AllDay {
+		if strings.EqualFold(zone, UTCTimeZone) {
+			event.Zone = UTCTimeZone
+		} else {
+			loc, err := time.LoadLocation(zone)
+			if err != nil || zone == "Local" {
+				return nil, fmt.Errorf("Invalid timezone %q: must be UTC or an IANA time zone such as Europe/Zurich", zone)
+			}
+			event.Zone, event.TZ = zone, loc
+		}
+	}
+
+	if err := event.parseTimes(get("startDateTime"), get("endDateTime")); err != nil {
+		return nil, err
+	}
+	if err := event.parseRepeat(get); err != nil {
+		return nil, err
+	}
+
+	if value := get("reminder"); value != "" {
+		minutes, err := strconv.Atoi(value)
+		if err != nil || minutes < 0 || minutes > MaxReminderMinutes {
+			return nil, fmt.Errorf("Invalid reminder %q: must be minutes before the start, 0 to %d", value, MaxReminderMinutes)
+		}
+		event.Reminder = minutes
+	}
+
+	if email := get("organizer"); email != "" {
+		address, err := mail.ParseAddress(email)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid organizer %q: must be an email address", email)
+		}
+		event.OrganizerEmail, event.OrganizerName = address.Address, get("organizerName")
+	} else if get("organizerName") != "" {
+		return nil, errors.New("organizerName requires organizer")
+	}
+
+	if event.URL != "" {
+		u, err := url.Parse(event.URL)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("Invalid url %q: must be an absolute URL", event.URL)
+		}
+	}
+
+	// DTSTAMP is always in UTC, so the stamp must be absolute
+	if value := get(EventStampField); value != "" {
+		stamp, zoned, ok := parseEventTime(value, time.UTC)
+		if !ok || !zoned {
+			return nil, fmt.Errorf("Invalid %s %q: must be a date and time with a UTC offset such as 2026-10-16T14:30Z", EventStampField, value)
+		}
+		event.Stamp = stamp
+	}
+	return event, nil
+}
+
+// parseTimes reads the start and end. All-day events take dates and last at least one
+// day. Timed events take date-times, read in the event's time zone unless they carry
+// a UTC offset, and must end after they start.
+func (e *calEvent) parseTimes(start, end string) error {
+	if e.AllDay {
+		var ok bool
+		if e.Start, ok = parseEventDate(start); !ok {
+			return fmt.Errorf("Invalid startDateTime %q: must be a date such as 2026-10-16", start)
+		}
+		e.End = e.Start
+		if end != "" {
+			if e.End, ok = parseEventDate(end); !ok {
+				return fmt.Errorf("Invalid endDateTime %q: must be a date such as 2026-10-16", end)
+			}
+		}
+		if e.End.Before(e.Start) {
+			return errors.New("endDateTime must not be before startDateTime")
+		}
+		return nil
+	}
+
+	if end == "" {
+		return errors.New("Missing end date and time")
+	}
+	startTime, startZoned, ok := parseEventTime(start, e.TZ)
+	if !ok {
+		return fmt.Errorf("Invalid startDateTime %q: must be a date and time such as 2026-10-16T14:30", start)
+	}
+	endTime, endZoned, ok := parseEventTime(end, e.TZ)
+	if !ok {
+		return fmt.Errorf("Invalid endDateTime %q: must be a date and time such as 2026-10-16T14:30", end)
+	}
+
+	// Times with a UTC offset are absolute, so they cannot be floating
+	if e.Zone == "" && (startZoned || endZoned) {
+		if !startZoned || !endZoned {
+			return errors.New("startDateTime and endDateTime must both have a UTC offset, or neither")
+		}
+		e.Zone = UTCTimeZone
+	}
+	e.Start, e.End = startTime.In(e.TZ), endTime.In(e.TZ)
+	if !e.End.After(e.Start) {
+		return errors.New("endDateTime must be after startDateTime")
+	}
+	return nil
+}
+
+// parseEventTime reads a date-time, reporting whether it had a UTC offset. Times without
+// one are read in loc.
+func parseEventTime(value string, loc *time.Location) (time.Time, bool, bool) {
+	for _, layout := range eventZonedLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true, true
+		}
+	}
+	for _, layout := range eventTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, false, true
+		}
+	}
+	return time.Time{}, false, false
+}
+
+// parseEventDate reads the date of an all-day event. Date-times are accepted too and
+// their time is ignored, as sent by datetime-local inputs.
+func parseEventDate(value string) (time.Time, bool) {
+	for _, layout := range []string{"2006-01-02", icalDate} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	if t, _, ok := parseEventTime(value, time.UTC); ok {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), true
+	}
+	return time.Time{}, false
+}
+
+// parseRepeat reads the recurrence rule fields.
+func (e *calEvent) parseRepeat(get fieldGetter) error {
+	repeat := strings.ToLower(get("repeat"))
+	if repeat == "" || repeat == "none" {
+		if get("repeatInterval") != "" || get("repeatCount") != "" || get("repeatUntil") != "" {
+			return errors.New("repeatInterval, repeatCount and repeatUntil require repeat")
+		}
+		return nil
+	}
+	frequency, ok := eventRepeatFrequencies[repeat]
+	if !ok {
+		return fmt.Errorf("Invalid repeat %q: must be daily, weekly, monthly or yearly", get("repeat"))
+	}
+	e.Frequency = frequency
+
+	for _, field := range []struct {
+		name  string
+		value *int
+	}{{"repeatInterval", &e.Interval}, {"repeatCount", &e.Count}} {
+		value := get(field.name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > MaxRepeat {
+			return fmt.Errorf("Invalid %s %q: must be between 1 and %d", field.name, value, MaxRepeat)
+		}
+		*field.value = n
+	}
+
+	if value := get("repeatUntil"); value != "" {
+		if e.Count > 0 {
+			return errors.New("Set repeatCount or repeatUntil, not both")
+		}
+		until, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return fmt.Errorf("Invalid repeatUntil %q: must be a date such as 2026-12-31", value)
+		}
+		start := e.Start.In(e.TZ)
+		if until.Before(time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)) {
+			return errors.New("repeatUntil must not be before startDateTime")
+		}
+		e.Until = until
+	}
+	return nil
+}
+
+// checkEventFields validates the event fields.
+func checkEventFields(get fieldGetter) error {
+	_, err := eventFromFields(get)
+	return err
+}
+
+// eventPayload builds an iCalendar object from validated event fields, stamped with the
+// dtstamp field or else the current time.
+func eventPayload(get fieldGetter) string {
+	event, _ := eventFromFields(get)
+	stamp := event.Stamp
+	if stamp.IsZero() {
+		stamp = time.Now()
+	}
+	return event.String(stamp)
+}
+
+// String writes the event as an iCalendar object with CRLF line endings, escaping text
+// values and folding long lines. TZID times are described by a VTIMEZONE component.
+func (e *calEvent) String(stamp time.Time) string {
+	var lines []string
+	add := func(line ...string) {
+		lines = append(lines, line...)
+	}
+
+	add("BEGIN:VCALENDAR", "VERSION:2.0", "PRODID:"+EventProductID)
+	if e.Zone != "" && e.Zone != UTCTimeZone {
+		add(vTimezone(e.Zone, e.TZ, e.Start)...)
+	}
+	add("BEGIN:VEVENT")
+
+	uid := e.UID
+	if uid == "" {
+		// A stable UID lets calendars update an event imported twice instead of duplicating it
+		sum := sha256.Sum256([]byte(e.Summary + "\n" + e.timeProperty("DTSTART", e.Start)))
+		uid = hex.EncodeToString(sum[:16]) + "@goqrcodegen"
+	}
+	add("UID:"+icalEscaper.Replace(uid), "DTSTAMP:"+stamp.UTC().Format(icalDateTime)+"Z")
+
+	add(e.timeProperty("DTSTART", e.Start))
+	if e.AllDay {
+		// The end date of all-day events is exclusive
+		add(e.timeProperty("DTEND", e.End.AddDate(0, 0, 1)))
+	} else {
+		add(e.timeProperty("DTEND", e.End))
+	}
+	if e.Frequency != "" {
+		add("RRULE:" + e.rrule())
+	}
+
+	add("SUMMARY:" + icalEscaper.Replace(e.Summary))
+	if e.Location != "" {
+		add("LOCATION:" + icalEscaper.Replace(e.Location))
+	}
+	if e.Description != "" {
+		add("DESCRIPTION:" + icalEscaper.Replace(e.Description))
+	}
+	if e.URL != "" {
+		add("URL:" + e.URL)
+	}
+	if e.OrganizerEmail != "" {
+		organizer := "ORGANIZER"
+		if e.OrganizerName != "" {
+			organizer += ";CN=" + icalParam(e.OrganizerName)
+		}
+		add(organizer + ":mailto:" + e.OrganizerEmail)
+	}
+	if e.Reminder >= 0 {
+		add("BEGIN:VALARM", "ACTION:DISPLAY", "DESCRIPTION:"+icalEscaper.Replace(e.Summary),
+			"TRIGGER:"+icalReminder(e.Reminder), "END:VALARM")
+	}
+	add("END:VEVENT", "END:VCALENDAR")
+
+	for i, line := range lines {
+		lines[i] = foldVCardLine(line)
+	}
+	return strings.Join(lines, "\r\n")
+}
+
+// timeProperty formats a date or date-time property: a DATE for all-day events, a UTC
+// time, a floating local time or a local time with its TZID.
+func (e *calEvent) timeProperty(property string, t time.Time) string {
+	switch {
+	case e.AllDay:
+		return property + ";VALUE=DATE:" + t.Format(icalDate)
+	case e.Zone == UTCTimeZone:
+		return property + ":" + t.UTC().Format(icalDateTime) + "Z"
+	case e.Zone == "":
+		return property + ":" + t.Format(icalDateTime)
+	}
+	return property + ";TZID=" + e.Zone + ":" + t.In(e.TZ).Format(icalDateTime)
+}
+
+// rrule formats the recurrence rule. UNTIL is the end of the last day, in UTC unless the
+// times are floating or dates, as RFC 5545 requires.
+func (e *calEvent) rrule() string {
+	rule := "FREQ=" + e.Frequency
+	if e.Interval > 1 {
+		rule += ";INTERVAL=" + strconv.Itoa(e.Interval)
+	}
+	if e.Count > 0 {
+		rule += ";COUNT=" + strconv.Itoa(e.Count)
+	}
+	if !e.Until.IsZero() {
+		endOfDay := time.Date(e.Until.Year(), e.Until.Month(), e.Until.Day(), 23, 59, 59, 0, e.TZ)
+		switch {
+		case e.AllDay:
+			rule += ";UNTIL=" + e.Until.Format(icalDate)
+		case e.Zone == "":
+			rule += ";UNTIL=" + endOfDay.Format(icalDateTime)
+		default:
+			rule += ";UNTIL=" + endOfDay.UTC().Format(icalDateTime) + "Z"
+		}
+	}
+	return rule
+}
+
+// icalReminder formats the trigger of a reminder the given minutes before the start,
+// in the largest whole unit.
+func icalReminder(minutes int) string {
+	switch {
+	case minutes == 0:
+		return "PT0M"
+	case minutes%(24*60) == 0:
+		return fmt.Sprintf("-P%dD", minutes/(24*60))
+	case minutes%60 == 0:
+		return fmt.Sprintf("-PT%dH", minutes/60)
+	}
+	return fmt.Sprintf("-PT%dM", minutes)
+}
+
+// icalParam formats a parameter value, quoting it when it contains separators. Quotes
+// and control characters cannot be written and are removed.
+func icalParam(value string) string {
+	value = strings.Map(func(r rune) rune {
+		if r == '"' || r < ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, value)
+	if strings.ContainsAny(value, ";:,") {
+		return `"` + value + `"`
+	}
+	return value
+}
+
+// vTimezone describes a time zone as a VTIMEZONE component. Zones with daylight saving
+// time get a STANDARD and a DAYLIGHT observance, starting with the transitions of the
+// year before the event and repeating yearly on the same weekday of the month, which
+// covers the rules in use today. Other zones get the offset in effect at the event.
+func vTimezone(zone string, loc *time.Location, at time.Time) []string {
+	lines := []string{"BEGIN:VTIMEZONE", "TZID:" + zone}
+	transitions := zoneTransitions(loc, at.Year()-1)
+	if len(transitions) != 2 {
+		name, offset := at.In(loc).Zone()
+		lines = append(lines, "BEGIN:STANDARD", "DTSTART:19700101T000000",
+			"TZOFFSETFROM:"+icalOffset(offset), "TZOFFSETTO:"+icalOffset(offset), "TZNAME:"+name, "END:STANDARD")
+		return append(lines, "END:VTIMEZONE")
+	}
+	for _, t := range transitions {
+		_, from := t.Add(-time.Minute).Zone()
+		name, to := t.Zone()
+		kind := "STANDARD"
+		if t.IsDST() {
+			kind = "DAYLIGHT"
+		}
+		// The onset is the local time before the transition
+		onset := t.In(time.FixedZone("", from))
+		lines = append(lines, "BEGIN:"+kind, "DTSTART:"+onset.Format(icalDateTime), "RRULE:"+yearlyRule(onset),
+			"TZOFFSETFROM:"+icalOffset(from), "TZOFFSETTO:"+icalOffset(to), "TZNAME:"+name, "END:"+kind)
+	}
+	return append(lines, "END:VTIMEZONE")
+}
+
+// zoneTransitions returns the instants in a year at which the UTC offset of loc changes,
+// to the minute.
+func zoneTransitions(loc *time.Location, year int) []time.Time {
+	var transitions []time.Time
+	t := time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC).In(loc)
+	end := time.Date(year+1, 1, 1, 0, 0, 0, 0, time.UTC)
+	_, offset := t.Zone()
+	for t.Before(end) {
+		next := t.Add(time.Hour)
+		if _, nextOffset := next.Zone(); nextOffset != offset {
+			// Find the first minute of the new offset
+			for next = t.Add(time.Minute); ; next = next.Add(time.Minute) {
+				if _, o := next.Zone(); o != offset {
+					break
+				}
+			}
+			transitions = append(transitions, next)
+			_, offset = next.Zone()
+		}
+		t = next
+	}
+	return transitions
+}
+
+// yearlyRule returns the RRULE repeating a date every year on the same weekday of the
+// month, such as the last Sunday of March.
+func yearlyRule(t time.Time) string {
+	n := (t.Day()-1)/7 + 1
+	if daysInMonth := time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day(); t.Day()+7 > daysInMonth {
+		n = -1
+	}
+	return fmt.Sprintf("FREQ=YEARLY;BYMONTH=%d;BYDAY=%d%s", t.Month(), n, icalWeekdays[t.Weekday()])
+}
+
+// icalOffset formats a UTC offset in seconds as +hhmm, with seconds when needed.
+func icalOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign, seconds = "-", -seconds
+	}
+	offset := fmt.Sprintf("%s%02d%02d", sign, seconds/3600, seconds/60%60)
+	if seconds%60 != 0 {
+		offset += fmt.Sprintf("%02d", seconds%60)
+	}
+	return offset
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// eventStamp is the DTSTAMP of the events written by the tests.
+var eventStamp = time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+// eventSample is a timed event in a time zone using most of the event fields.
+var eventSample = map[string]string{
+	"eventName": "Team sync", "startDateTime": "2026-11-02T09:00", "endDateTime": "2026-11-02T09:30",
+	"timezone": "Europe/Zurich", "repeat": "weekly", "repeatInterval": "2", "repeatUntil": "2026-12-31",
+	"reminder": "15", "organizer": "jane@example.com", "organizerName": "Doe, Jane", "location": "Room 1; floor 2",
+}
+
+// merge returns the values of base overridden by those of changes.
+func merge(base, changes map[string]string) map[string]string {
+	values := make(map[string]string, len(base)+len(changes))
+	for k, v := range base {
+		values[k] = v
+	}
+	for k, v := range changes {
+		values[k] = v
+	}
+	return values
+}
+
+func TestEventString(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields map[string]string
+		want   []string
+	}{
+		{"time zone", eventSample, []string{
+			"BEGIN:VCALENDAR",
+			"VERSION:2.0",
+			"PRODID:" + EventProductID,
+			"BEGIN:VTIMEZONE",
+			"TZID:Europe/Zurich",
+			"BEGIN:DAYLIGHT",
+			"DTSTART:20250330T020000",
+			"RRULE:FREQ=YEARLY;BYMONTH=3;BYDAY=-1SU",
+			"TZOFFSETFROM:+0100",
+			"TZOFFSETTO:+0200",
+			"TZNAME:CEST",
+			"END:DAYLIGHT",
+			"BEGIN:STANDARD",
+			"DTSTART:20251026T030000",
+			"RRULE:FREQ=YEARLY;BYMONTH=10;BYDAY=-1SU",
+			"TZOFFSETFROM:+0200",
+			"TZOFFSETTO:+0100",
+			"TZNAME:CET",
+			"END:STANDARD",
+			"END:VTIMEZONE",
+			"BEGIN:VEVENT",
+			"UID:cc8c85a194a309b08651421e6d1b4803@goqrcodegen",
+			"DTSTAMP:20261016T120000Z",
+			"DTSTART;TZID=Europe/Zurich:20261102T090000",
+			"DTEND;TZID=Europe/Zurich:20261102T093000",
+			"RRULE:FREQ=WEEKLY;INTERVAL=2;UNTIL=20261231T225959Z",
+			"SUMMARY:Team sync",
+			`LOCATION:Room 1\; floor 2`,
+			`ORGANIZER;CN="Doe, Jane":mailto:jane@example.com`,
+			"BEGIN:VALARM",
+			"ACTION:DISPLAY",
+			"DESCRIPTION:Team sync",
+			"TRIGGER:-PT15M",
+			"END:VALARM",
+			"END:VEVENT",
+			"END:VCALENDAR",
+		}},
+		{"all day", map[string]string{
+			"eventName": "Holiday", "startDateTime": "2026-12-24", "endDateTime": "2026-12-26", "allDay": "true",
+			"timezone": "Europe/Zurich", "repeat": "yearly", "reminder": "1440", "uid": "xmas@example.com",
+		}, []string{
+			"BEGIN:VCALENDAR",
+			"VERSION:2.0",
+			"PRODID:" + EventProductID,
+			"BEGIN:VEVENT",
+			"UID:xmas@example.com",
+			"DTSTAMP:20261016T120000Z",
+			"DTSTART;VALUE=DATE:20261224",
+			"DTEND;VALUE=DATE:20261227",
+			"RRULE:FREQ=YEARLY",
+			"SUMMARY:Holiday",
+			"BEGIN:VALARM",
+			"ACTION:DISPLAY",
+			"DESCRIPTION:Holiday",
+			"TRIGGER:-P1D",
+			"END:VALARM",
+			"END:VEVENT",
+			"END:VCALENDAR",
+		}},
+		{"UTC offset", map[string]string{
+			"eventName": "Launch", "startDateTime": "2026-10-16T14:30:00+02:00", "endDateTime": "2026-10-16T15:30:00+02:00",
+			"url": "https://example.com", "repeat": "daily", "repeatCount": "3",
+		}, []string{
+			"BEGIN:VCALENDAR",
+			"VERSION:2.0",
+			"PRODID:" + EventProductID,
+			"BEGIN:VEVENT",
+			"UID:b89d171562b5532217c2f040489e5b74@goqrcodegen",
+			"DTSTAMP:20261016T120000Z",
+			"DTSTART:20261016T123000Z",
+			"DTEND:20261016T133000Z",
+			"RRULE:FREQ=DAILY;COUNT=3",
+			"SUMMARY:Launch",
+			"URL:https://example.com",
+			"END:VEVENT",
+			"END:VCALENDAR",
+		}},
+	}
+	for _, tt := range tests {
+		event, err := eventFromFields(fields(tt.fields))
+		if err != nil {
+			t.Fatalf("%s: eventFromFields: %v", tt.name, err)
+		}
+		if got, want := event.String(eventStamp), strings.Join(tt.want, "\r\n"); got != want {
+			t.Errorf("%s: String =\n%s\nwant\n%s", tt.name, got, want)
+		}
+	}
+}
+
+func TestEventFromFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		changes map[string]string
+		wantErr string
+	}{
+		{"valid", nil, ""},
+		{"floating", map[string]string{"timezone": ""}, ""},
+		{"iCalendar times", map[string]string{"startDateTime": "20261102T090000", "endDateTime": "20261102T093000"}, ""},
+		{"invalid allDay", map[string]string{"allDay": "yes"}, "Invalid allDay"},
+		{"unknown time zone", map[string]string{"timezone": "Mars/Olympus"}, "Invalid timezone"},
+		{"local time zone", map[string]string{"timezone": "Local"}, "Invalid timezone"},
+		{"missing end", map[string]string{"endDateTime": ""}, "Missing end date and time"},
+		{"invalid start", map[string]string{"startDateTime": "tomorrow"}, "Invalid startDateTime"},
+		{"end before start", map[string]string{"endDateTime": "2026-11-02T08:00"}, "endDateTime must be after startDateTime"},
+		{"one UTC offset", map[string]string{"timezone": "", "endDateTime": "2026-11-02T09:30Z"}, "must both have a UTC offset"},
+		{"all-day end before start", map[string]string{"allDay": "true", "startDateTime": "2026-11-02", "endDateTime": "2026-11-01"}, "must not be before"},
+		{"all-day date-time", map[string]string{"allDay": "true", "endDateTime": ""}, ""},
+		{"unknown repeat", map[string]string{"repeat": "hourly"}, "Invalid repeat"},
+		{"repeat fields without repeat", map[string]string{"repeat": "none"}, "require repeat"},
+		{"interval out of range", map[string]string{"repeatInterval": "0"}, "Invalid repeatInterval"},
+		{"count and until", map[string]string{"repeatCount": "3"}, "not both"},
+		{"until before start", map[string]string{"repeatUntil": "2026-11-01"}, "repeatUntil must not be before"},
+		{"invalid until", map[string]string{"repeatUntil": "31.12.2026"}, "Invalid repeatUntil"},
+		{"negative reminder", map[string]string{"reminder": "-5"}, "Invalid reminder"},
+		{"reminder too early", map[string]string{"reminder": "40321"}, "Invalid reminder"},
+		{"invalid organizer", map[string]string{"organizer": "jane"}, "Invalid organizer"},
+		{"organizer name alone", map[string]string{"organizer": ""}, "organizerName requires organizer"},
+		{"relative URL", map[string]string{"url": "/event"}, "Invalid url"},
+		{"dtstamp", map[string]string{"dtstamp": "20261016T120000Z"}, ""},
+		{"dtstamp with offset", map[string]string{"dtstamp": "2026-10-16T14:00+02:00"}, ""},
+		{"floating dtstamp", map[string]string{"dtstamp": "2026-10-16T12:00"}, "Invalid dtstamp"},
+		{"invalid dtstamp", map[string]string{"dtstamp": "now"}, "Invalid dtstamp"},
+	}
+	for _, tt := range tests {
+		if _, err := eventFromFields(fields(merge(eventSample, tt.changes))); !checkError(err, tt.wantErr) {
+			t.Errorf("%s: eventFromFields = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestEventPayloadStamp(t *testing.T) {
+	// The dtstamp field sets the DTSTAMP, in UTC
+	payload := eventPayload(fields(merge(eventSample, map[string]string{"dtstamp": "2026-10-16T14:00+02:00"})))
+	if !strings.Contains(payload, "\r\nDTSTAMP:20261016T120000Z\r\n") {
+		t.Errorf("payload with dtstamp =\n%s", payload)
+	}
+
+	// Otherwise it is the generation time
+	before := time.Now().UTC().Truncate(time.Second)
+	payload = eventPayload(fields(eventSample))
+	after := time.Now().UTC()
+	i := strings.Index(payload, "DTSTAMP:")
+	if i < 0 {
+		t.Fatalf("payload without DTSTAMP:\n%s", payload)
+	}
+	stamp, err := time.Parse(icalDateTime+"Z", payload[i+len("DTSTAMP:"):i+len("DTSTAMP:")+len(icalDateTime)+1])
+	if err != nil || stamp.Before(before) || stamp.After(after) {
+		t.Errorf("DTSTAMP = %v (%v), want between %v and %v", stamp, err, before, after)
+	}
+}
+
+func TestVTimezone(t *testing.T) {
+	tests := []struct {
+		zone string
+		want []string
+	}{
+		// Southern hemisphere: daylight saving time spans the new year
+		{"Australia/Sydney", []string{
+			"BEGIN:VTIMEZONE", "TZID:Australia/Sydney",
+			"BEGIN:STANDARD", "DTSTART:20250406T030000", "RRULE:FREQ=YEARLY;BYMONTH=4;BYDAY=1SU",
+			"TZOFFSETFROM:+1100", "TZOFFSETTO:+1000", "TZNAME:AEST", "END:STANDARD",
+			"BEGIN:DAYLIGHT", "DTSTART:20251005T020000", "RRULE:FREQ=YEARLY;BYMONTH=10;BYDAY=1SU",
+			"TZOFFSETFROM:+1000", "TZOFFSETTO:+1100", "TZNAME:AEDT", "END:DAYLIGHT",
+			"END:VTIMEZONE",
+		}},
+		// No daylight saving time: a single observance
+		{"Asia/Kolkata", []string{
+			"BEGIN:VTIMEZONE", "TZID:Asia/Kolkata",
+			"BEGIN:STANDARD", "DTSTART:19700101T000000",
+			"TZOFFSETFROM:+0530", "TZOFFSETTO:+0530", "TZNAME:IST", "END:STANDARD",
+			"END:VTIMEZONE",
+		}},
+	}
+	for _, tt := range tests {
+		loc, err := time.LoadLocation(tt.zone)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := vTimezone(tt.zone, loc, time.Date(2026, 11, 2, 9, 0, 0, 0, loc))
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("vTimezone(%s) =\n%s\nwant\n%s", tt.zone, strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+		}
+	}
+}
+
+func TestICalReminder(t *testing.T) {
+	tests := []struct {
+		minutes int
+		want    string
+	}{
+		{0, "PT0M"}, {15, "-PT15M"}, {90, "-PT90M"}, {120, "-PT2H"}, {1440, "-P1D"}, {2 * 1440, "-P2D"}, {1500, "-PT25H"},
+	}
+	for _, tt := range tests {
+		if got := icalReminder(tt.minutes); got != tt.want {
+			t.Errorf("icalReminder(%d) = %q, want %q", tt.minutes, got, tt.want)
+		}
+	}
+}
+
+func TestICalParam(t *testing.T) {
+	tests := []struct {
+		value, want string
+	}{
+		{"Jane Doe", "Jane Doe"},
+		{"Doe, Jane", `"Doe, Jane"`},
+		{`Jane "JD" Doe`, "Jane JD Doe"},
+		{"Jane\nDoe", "JaneDoe"},
+	}
+	for _, tt := range tests {
+		if got := icalParam(tt.value); got != tt.want {
+			t.Errorf("icalParam(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	// Frame templates
+	FrameNone   = "none"   // No frame, with an optional caption next to the code
+	FrameBox    = "box"    // Rounded border around the code and caption
+	FrameBanner = "banner" // Rounded border with the caption knocked out of a solid band
+	FrameBubble = "bubble" // Speech bubble holding the caption, pointing at the code
+
+	// Caption positions
+	CaptionBelow = "below"
+	CaptionAbove = "above"
+
+	// Caption limits
+	MaxCaptionLength = 64  // Longest caption in characters
+	MinFontSize      = 4   // Smallest caption font size in pixels or points
+	MaxFontSize      = 400 // Largest caption font size in pixels or points
+
+	// Frame geometry in modules, or relative to the font size
+	frameLine          = 1.0  // Width of the box and banner border
+	frameRadius        = 2.0  // Outer corner radius of the box and banner
+	captionBandHeight  = 2.0  // Height of the caption band, in font sizes
+	captionPadding     = 0.75 // Space on either side of the caption, in font sizes
+	bubblePointer      = 0.6  // Height of the bubble pointer, in font sizes
+	defaultFontModules = 1.0 / 12
+)
+
+var (
+	// Valid values for the frame options
+	frameStyles      = map[string]bool{FrameNone: true, FrameBox: true, FrameBanner: true, FrameBubble: true}
+	captionPositions = map[string]bool{CaptionBelow: true, CaptionAbove: true}
+
+	// captionFont is the embedded TrueType font captions are drawn with.
+	captionFont *sfnt.Font
+)
+
+func init() {
+	var err error
+	captionFont, err = sfnt.Parse(gobold.TTF)
+	if err != nil {
+		panic(fmt.Sprintf("parsing caption font: %v", err))
+	}
+}
+
+// frameOptions controls the frame and caption drawn around a code.
+type frameOptions struct {
+	Style     string      // Frame template
+	Caption   string      // Call to action, empty for none
+	Position  string      // Whether the caption is above or below the code
+	Color     color.NRGBA // Colour of the frame
+	TextColor color.NRGBA // Colour of the caption
+	FontSize  float64     // Caption size in pixels, or points for PDF output; 0 for the default
+}
+
+// enabled reports whether anything is drawn around the code.
+func (f frameOptions) enabled() bool {
+	return f.Style != FrameNone || f.Caption != ""
+}
+
+// parseFrameOptions extracts and validates the frame and caption from the request fields.
+// The frame colour defaults to the foreground colour. Captions are drawn in the frame
+// colour, or knocked out in the background colour on banners and bubbles.
+func parseFrameOptions(get fieldGetter, fg, bg color.NRGBA) (frameOptions, error) {
+	frame := frameOptions{Style: FrameNone, Position: CaptionBelow, Color: fg}
+
+	// Validate the optional template and caption
+	if value := strings.ToLower(get("frame")); value != "" {
+		if !frameStyles[value] {
+			return frame, fmt.Errorf("Invalid frame %q: must be none, box, banner or bubble", value)
+		}
+		frame.Style = value
+	}
+	frame.Caption = strings.TrimSpace(get("caption"))
+	if utf8.RuneCountInString(frame.Caption) > MaxCaptionLength {
+		return frame, fmt.Errorf("Caption is too long: maximum is %d characters", MaxCaptionLength)
+	}
+	if strings.ContainsAny(frame.Caption, "\r\n") {
+		return frame, errors.New("Caption must be a single line")
+	}
+	if frame.Caption == "" && (frame.Style == FrameBanner || frame.Style == FrameBubble) {
+		return frame, fmt.Errorf("Missing caption for the %s frame", frame.Style)
+	}
+	if value := strings.ToLower(get("captionPosition")); value != "" {
+		if !captionPositions[value] {
+			return frame, fmt.Errorf("Invalid captionPosition %q: must be above or below", value)
+		}
+		frame.Position = value
+	}
+
+	// Validate the optional colours
+	if value := get("frameColor"); value != "" {
+		c, err := parseColor(value)
+		if err != nil {
+			return frame, fmt.Errorf("Invalid frameColor: %v", err)
+		}
+		frame.Color = c
+	}
+	frame.TextColor = frame.Color
+	if frame.Style == FrameBanner || frame.Style == FrameBubble {
+		frame.TextColor = bg
+		if bg.A == 0 {
+			frame.TextColor = color.NRGBA{0xff, 0xff, 0xff, 0xff}
+		}
+	}
+	if value := get("captionColor"); value != "" {
+		c, err := parseColor(value)
+		if err != nil {
+			return frame, fmt.Errorf("Invalid captionColor: %v", err)
+		}
+		frame.TextColor = c
+	}
+
+	// Validate the optional font size
+	if value := get("fontSize"); value != "" {
+		size, err := strconv.ParseFloat(value, 64)
+		if err != nil || size < MinFontSize || size > MaxFontSize {
+			return frame, fmt.Errorf("Invalid fontSize: must be between %d and %d", MinFontSize, MaxFontSize)
+		}
+		frame.FontSize = size
+	}
+
+	return frame, nil
+}
+
+// qrFrame is the layout of a code in its frame, in module units with y pointing down.
+type qrFrame struct {
+	Width, Height float64   // Size of the whole image
+	CodeX, CodeY  float64   // Top-left corner of the code, quiet zone included
+	Layers        []qrLayer // Frame and caption outlines in drawing order
+}
+
+// layoutFrame places a code that is modules wide, quiet zone included, in its frame.
+// fontSize is the caption size in modules, or 0 for the default; captions too wide for
+// the frame are scaled down to fit.
+func layoutFrame(f frameOptions, modules int, fontSize float64) *qrFrame {
+	m := float64(modules)
+	if fontSize <= 0 {
+		fontSize = m * defaultFontModules
+	}
+	band := 0.0
+	if f.Caption != "" {
+		band = fontSize * captionBandHeight
+	}
+	above := f.Position == CaptionAbove
+
+	// Lay out the frame around the code and the caption band
+	layout := &qrFrame{}
+	frame := qrLayer{Color: f.Color}
+	var bandY float64
+	switch f.Style {
+	case FrameBox, FrameBanner:
+		layout.Width = m + 2*frameLine
+		layout.Height = m + 2*frameLine + band
+		layout.CodeX, layout.CodeY = frameLine, frameLine
+		bandY = frameLine + m
+		if above {
+			layout.CodeY, bandY = frameLine+band, frameLine
+		}
+		radius := [4]float64{frameRadius, frameRadius, frameRadius, frameRadius}
+		frame.Path.roundedRect(0, 0, layout.Width, layout.Height, radius, true)
+		if f.Style == FrameBox {
+			// Cut out the code and the caption band, leaving a border
+			inner := frameRadius - frameLine
+			frame.Path.roundedRect(frameLine, frameLine, m, m+band, [4]float64{inner, inner, inner, inner}, false)
+		} else {
+			// Cut out only the code, leaving the caption band solid
+			frame.Path.rect(layout.CodeX, layout.CodeY, m, m, false)
+		}
+	case FrameBubble:
+		pointer := fontSize * bubblePointer
+		layout.Width = m
+		layout.Height = m + pointer + band
+		radius := band / 3
+		corners := [4]float64{radius, radius, radius, radius}
+		if above {
+			layout.CodeY = band + pointer
+			frame.Path.roundedRect(0, 0, m, band, corners, true)
+			frame.Path.moveTo(m/2-pointer, band-radius)
+			frame.Path.lineTo(m/2+pointer, band-radius)
+			frame.Path.lineTo(m/2, band+pointer)
+		} else {
+			bandY = m + pointer
+			frame.Path.roundedRect(0, bandY, m, band, corners, true)
+			frame.Path.moveTo(m/2-pointer, bandY+radius)
+			frame.Path.lineTo(m/2, m)
+			frame.Path.lineTo(m/2+pointer, bandY+radius)
+		}
+		frame.Path.close()
+	default:
+		layout.Width = m
+		layout.Height = m + band
+		bandY = m
+		if above {
+			layout.CodeY, bandY = band, 0
+		}
+	}
+	if f.Style != FrameNone {
+		layout.Layers = append(layout.Layers, frame)
+	}
+
+	// Centre the caption in its band, shrinking it to fit between the paddings
+	if f.Caption != "" {
+		available := layout.Width - 2*captionPadding*fontSize
+		if width := captionWidth(f.Caption, fontSize); width > available {
+			fontSize *= available / width
+		}
+		x := (layout.Width - captionWidth(f.Caption, fontSize)) / 2
+		y := bandY + band/2 + captionCapHeight(fontSize)/2
+		layout.Layers = append(layout.Layers, qrLayer{Color: f.TextColor, Path: captionPath(f.Caption, x, y, fontSize)})
+	}
+	return layout
+}
+
+// captionUnits returns the scale of the caption font at its units per em, so glyph
+// coordinates come back in font units.
+func captionUnits() (fixed.Int26_6, float64) {
+	upem := captionFont.UnitsPerEm()
+	return fixed.Int26_6(upem) << 6, float64(upem)
+}
+
+// captionWidth returns the advance width of a caption at the given font size.
+func captionWidth(text string, size float64) float64 {
+	var buf sfnt.Buffer
+	ppem, upem := captionUnits()
+	var width fixed.Int26_6
+	prev := sfnt.GlyphIndex(0)
+	for i, r := range text {
+		index, _ := captionFont.GlyphIndex(&buf, r)
+		if i > 0 {
+			if kern, err := captionFont.Kern(&buf, prev, index, ppem, font.HintingNone); err == nil {
+				width += kern
+			}
+		}
+		advance, _ := captionFont.GlyphAdvance(&buf, index, ppem, font.HintingNone)
+		width += advance
+		prev = index
+	}
+	return float64(width) / 64 * size / upem
+}
+
+// captionCapHeight returns the height of capital letters at the given font size.
+func captionCapHeight(size float64) float64 {
+	var buf sfnt.Buffer
+	ppem, upem := captionUnits()
+	metrics, err := captionFont.Metrics(&buf, ppem, font.HintingNone)
+	if err != nil || metrics.CapHeight <= 0 {
+		return size * 0.7
+	}
+	return float64(metrics.CapHeight) / 64 * size / upem
+}
+
+// captionPath outlines a caption with its baseline starting at (x, y).
+func captionPath(text string, x, y, size float64) qrPath {
+	var buf sfnt.Buffer
+	ppem, upem := captionUnits()
+	scale := size / upem / 64
+
+	var path qrPath
+	var pen fixed.Int26_6
+	prev := sfnt.GlyphIndex(0)
+	for i, r := range text {
+		index, _ := captionFont.GlyphIndex(&buf, r)
+		if i > 0 {
+			if kern, err := captionFont.Kern(&buf, prev, index, ppem, font.HintingNone); err == nil {
+				pen += kern
+			}
+		}
+		segments, err := captionFont.LoadGlyph(&buf, index, ppem, nil)
+		if err == nil {
+			pt := func(p fixed.Point26_6) (float64, float64) {
+				return x + float64(pen+p.X)*scale, y + float64(p.Y)*scale
+			}
+
+			// Convert the glyph outline, turning quadratic curves into cubic ones
+			var cx, cy float64
+			open := false
+			for _, segment := range segments {
+				switch segment.Op {
+				case sfnt.SegmentOpMoveTo:
+					if open {
+						path.close()
+					}
+					cx, cy = pt(segment.Args[0])
+					path.moveTo(cx, cy)
+					open = true
+				case sfnt.SegmentOpLineTo:
+					cx, cy = pt(segment.Args[0])
+					path.lineTo(cx, cy)
+				case sfnt.SegmentOpQuadTo:
+					qx, qy := pt(segment.Args[0])
+					ex, ey := pt(segment.Args[1])
+					path.cubeTo(cx+2*(qx-cx)/3, cy+2*(qy-cy)/3, ex+2*(qx-ex)/3, ey+2*(qy-ey)/3, ex, ey)
+					cx, cy = ex, ey
+				case sfnt.SegmentOpCubeTo:
+					x1, y1 := pt(segment.Args[0])
+					x2, y2 := pt(segment.Args[1])
+					cx, cy = pt(segment.Args[2])
+					path.cubeTo(x1, y1, x2, y2, cx, cy)
+				}
+			}
+			if open {
+				path.close()
+			}
+		}
+		advance, _ := captionFont.GlyphAdvance(&buf, index, ppem, font.HintingNone)
+		pen += advance
+		prev = index
+	}
+	path.Curved = true
+	return path
+}
+
+// frameScale returns the pixels per module of a raster or SVG code image, and the frame
+// layout with the font size converted from pixels to modules.
+func frameScale(opts qrOptions, modules int) (float64, *qrFrame) {
+	scale := float64(opts.pixelSize(modules)) / float64(modules)
+	return scale, layoutFrame(opts.Frame, modules, opts.Frame.FontSize/scale)
+}
+
+// framedSize returns the width and height in pixels of the framed image of a code.
+func framedSize(opts qrOptions, modules int) (int, int) {
+	if !opts.Frame.enabled() {
+		size := opts.pixelSize(modules)
+		return size, size
+	}
+	scale, layout := frameScale(opts, modules)
+	return int(math.Round(layout.Width * scale)), int(math.Round(layout.Height * scale))
+}
+
+// drawFrame places a rendered code image in its frame and draws the caption.
+func drawFrame(code image.Image, modules int, opts qrOptions) *image.RGBA {
+	scale, layout := frameScale(opts, modules)
+	width, height := framedSize(opts, modules)
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(opts.Background), image.Point{}, draw.Src)
+	offset := image.Pt(int(math.Round(layout.CodeX*scale)), int(math.Round(layout.CodeY*scale)))
+	draw.Draw(img, code.Bounds().Add(offset), code, code.Bounds().Min, draw.Src)
+	drawLayers(img, layout.Layers, scale)
+	return img
+}
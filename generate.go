@@ -0,0 +1,391 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// generateError is a failure in the generation pipeline, carrying the HTTP status and
+// JSON API error code to report it with.
+type generateError struct {
+	Status  int    // HTTP status code
+	Code    string // JSON API error code
+	Message string // Message shown to the caller
+	Err     error  // Underlying cause for the log, if different from Message
+}
+
+func (e *generateError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s - %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+// badRequest reports invalid input with its own message.
+func badRequest(code string, err error) *generateError {
+	return &generateError{Status: http.StatusBadRequest, Code: code, Message: err.Error()}
+}
+
+// internalError reports a server side failure with a generic message.
+func internalError(message string, err error) *generateError {
+	return &generateError{Status: http.StatusInternalServerError, Code: ErrCodeInternal, Message: message, Err: err}
+}
+
+// qrResult is a rendered QR code and the details of how it was encoded.
+type qrResult struct {
+	Data        []byte         // Encoded image
+	ContentType string         // MIME type of Data
+	Payload     string         // Text encoded in the QR code
+	Options     qrOptions      // Options the code was rendered with
+	Code        *qrcode.QRCode // Generated symbol
+	Logo        *qrLogo        // Logo overlaid on the code after any automatic shrinking, or nil
+	LogoPercent float64        // Final logo size, after any automatic shrinking
+	Verified    bool           // Whether the rendered image was decoded back to the payload
+	Width       int            // Width of the image in pixels, 0 for PDF output
+	Height      int            // Height of the image in pixels, 0 for PDF output
+	Warnings    []string       // Accepted options that may make the code harder to scan, and warnings about the data
+	Variants    []qrVariant    // Codes of the data in each format of the payload type, if it has several
+}
+
+// qrVariant describes the code the data would give in one of the formats of its payload
+// type, such as vCard or MeCard, with the same options.
+type qrVariant struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"` // QR code version, 1 to 40
+	Length  int    `json:"length"`  // Payload length in bytes
+}
+
+// variantVersions generates the code of every format the payload type offers for the
+// data. Formats that cannot be encoded with the options are left out.
+func variantVersions(t PayloadType, data fieldGetter, opts qrOptions, logoPercent float64) []qrVariant {
+	v, ok := t.(payloadVariants)
+	if !ok {
+		return nil
+	}
+	var variants []qrVariant
+	for _, variant := range v.Variants(data) {
+		qrCode, err := generateQRCode(variant.Payload, opts, logoPercent)
+		if err != nil {
+			continue
+		}
+		variants = append(variants, qrVariant{Format: variant.Format, Version: qrCode.VersionNumber, Length: len(variant.Payload)})
+	}
+	return variants
+}
+
+// generatePayloadQRCode runs the shared generation pipeline: it builds the payload from
+// the data fields, parses the styling and output options, loads the logo, generates the
+// QR code, renders it and decodes the result to verify it. A custom logo, when given, replaces the type's default logo and
+// is sized by the logoWidthPercent and logoOpacity options. Errors are *generateError.
+func generatePayloadQRCode(t PayloadType, data, options fieldGetter, customLogo image.Image) (*qrResult, error) {
+	// Build the payload from the validated data fields
+	payload, err := t.Build(data)
+	if err != nil {
+		return nil, badRequest(ErrCodeInvalidData, err)
+	}
+
+	// Formats that require an error correction level reject any other
+	options, err = applyRequiredECC(t, options)
+	if err != nil {
+		return nil, badRequest(ErrCodeInvalidOptions, err)
+	}
+
+	// Parse the shared QR code options (size, error correction level, colours, style and output format)
+	opts, err := parseQROptions(options)
+	if err != nil {
+		return nil, badRequest(ErrCodeInvalidOptions, err)
+	}
+
+	// Load the logo: the type's emblem, the uploaded one if any, otherwise the type's default
+	var logo *qrLogo
+	var emblem *qrEmblem
+	if e, ok := t.(payloadEmblem); ok {
+		emblem = e.Emblem()
+	}
+	if emblem != nil {
+		if customLogo != nil {
+			err := fmt.Errorf("%s codes carry their own emblem and cannot have a logo", t.Name())
+			return nil, badRequest(ErrCodeInvalidOptions, err)
+		}
+		// Sized against the symbol once it is generated; the width is an upper bound until then
+		logo = &qrLogo{Image: emblem.Image, Percent: emblem.Width, Opacity: 1}
+	} else if customLogo != nil {
+		logo, err = parseLogoOptions(options)
+		if err != nil {
+			return nil, badRequest(ErrCodeInvalidOptions, err)
+		}
+		logo.Image = customLogo
+	} else if path := t.DefaultLogo(); path != "" {
+		img, err := loadLogo(path)
+		if err != nil {
+			return nil, internalError("Failed to load logo", err)
+		}
+		logo = &qrLogo{Image: img, Percent: LogoPercent, Opacity: 1}
+	}
+
+	// Parse the round-trip verification options
+	verify, err := parseVerifyOptions(options)
+	if err != nil {
+		return nil, badRequest(ErrCodeInvalidOptions, err)
+	}
+
+	// Generate, render and verify the QR code, shrinking the logo on failure if requested.
+	// Emblems have a prescribed size and are never shrunk.
+	autoShrink := verify.AutoShrinkLogo && emblem == nil
+	for {
+		// Generate the QR code, reserving error correction for the logo
+		logoPercent := 0.0
+		if logo != nil {
+			logoPercent = logo.Percent
+		}
+		qrCode, err := generateQRCode(payload, opts, logoPercent)
+		if errors.Is(err, errLogoTooLarge) && autoShrink && shrinkLogo(logo) {
+			continue
+		}
+		if errors.Is(err, errLogoTooLarge) {
+			return nil, badRequest(ErrCodeLogoTooLarge, err)
+		}
+		if err != nil {
+			return nil, internalError("Failed to generate QR code", err)
+		}
+
+		// Size the emblem against the symbol, as the logo is measured with the quiet zone
+		if emblem != nil {
+			modules := len(qrBitmap(qrCode, opts.Margin))
+			logo.Percent = emblem.Width * float64(modules-2*opts.Margin) / float64(modules)
+			logoPercent = logo.Percent
+		}
+
+		// Check the image size, which depends on the symbol when a module size is given
+		width, height := 0, 0
+		if opts.Format != FormatPDF {
+			modules := len(qrBitmap(qrCode, opts.Margin))
+			if size := opts.pixelSize(modules); size > MaxQRCodeSize {
+				err := fmt.Errorf("moduleSize %d gives a %dpx image, larger than the maximum of %dpx", opts.ModuleSize, size, MaxQRCodeSize)
+				return nil, badRequest(ErrCodeInvalidOptions, err)
+			}
+			width, height = framedSize(opts, modules)
+		}
+
+		// Render the QR code in the requested output format
+		image, contentType, err := renderQRCode(qrCode, opts, logo)
+		if err != nil {
+			return nil, internalError("Failed to render QR code", err)
+		}
+		result := &qrResult{Data: image, ContentType: contentType, Payload: payload, Options: opts, Code: qrCode, Logo: logo, LogoPercent: logoPercent, Width: width, Height: height, Warnings: opts.warnings()}
+		result.Variants = variantVersions(t, data, opts, logoPercent)
+		if !verify.Verify {
+			return result, nil
+		}
+
+		// Decode the rendered image to check that it scans
+		err = verifyQRCode(image, qrCode, opts, logo, payload)
+		if errors.Is(err, errUnreadable) && autoShrink && shrinkLogo(logo) {
+			continue
+		}
+		if errors.Is(err, errUnreadable) {
+			// The error already names errUnreadable and the decoder's reason
+			message := err.Error()
+			if logo != nil && emblem == nil {
+				message += "; reduce logoWidthPercent, raise logoOpacity or set autoShrinkLogo"
+			}
+			return nil, &generateError{Status: http.StatusUnprocessableEntity, Code: ErrCodeUnreadable, Message: message}
+		}
+		if err != nil {
+			return nil, internalError("Failed to verify QR code", err)
+		}
+		result.Verified = true
+		return result, nil
+	}
+}
+
+// applyRequiredECC sets the ecc option to the level the payload type's format requires,
+// if any, rejecting a conflicting level.
+func applyRequiredECC(t PayloadType, options fieldGetter) (fieldGetter, error) {
+	r, ok := t.(payloadECC)
+	if !ok || r.RequiredECC() == "" {
+		return options, nil
+	}
+	level := r.RequiredECC()
+	if ecc := options("ecc"); ecc != "" && !strings.EqualFold(ecc, level) {
+		return nil, fmt.Errorf("Invalid ecc level %q: %s codes require level %s", ecc, t.Name(), level)
+	}
+	return withField(options, "ecc", level), nil
+}
+
+// payloadFits returns a function that reports whether a payload can be encoded with the
+// options as generatePayloadQRCode would encode it for the type: at the same error
+// correction level, leaving room for the same logo in the same quiet zone, shrunk first
+// if autoShrinkLogo is set. Imports use it to trim content that does not fit.
+func payloadFits(t PayloadType, options fieldGetter, customLogo image.Image) (func(payload string) bool, error) {
+	options, err := applyRequiredECC(t, options)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := parseQROptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the logo size matters, so the default logo is not loaded
+	logoPercent := 0.0
+	var emblem *qrEmblem
+	if e, ok := t.(payloadEmblem); ok {
+		emblem = e.Emblem()
+	}
+	if emblem != nil {
+		logoPercent = emblem.Width
+	} else if customLogo != nil {
+		logo, err := parseLogoOptions(options)
+		if err != nil {
+			return nil, err
+		}
+		logoPercent = logo.Percent
+	} else if t.DefaultLogo() != "" {
+		logoPercent = LogoPercent
+	}
+	verify, err := parseVerifyOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	autoShrink := verify.AutoShrinkLogo && emblem == nil
+
+	return func(payload string) bool {
+		logo := &qrLogo{Percent: logoPercent}
+		for {
+			_, err := generateQRCode(payload, opts, logo.Percent)
+			if errors.Is(err, errLogoTooLarge) && autoShrink && shrinkLogo(logo) {
+				continue
+			}
+			return err == nil
+		}
+	}, nil
+}
+
+// withField returns a field getter that overrides one field.
+func withField(get fieldGetter, name, value string) fieldGetter {
+	return func(field string) string {
+		if field == name {
+			return value
+		}
+		return get(field)
+	}
+}
+
+// shrinkLogo reduces the logo size for another attempt, reporting false when there is
+// no logo or it cannot shrink further.
+func shrinkLogo(logo *qrLogo) bool {
+	if logo == nil || logo.Percent*LogoShrinkFactor < MinLogoPercent {
+		return false
+	}
+	logo.Percent *= LogoShrinkFactor
+	return true
+}
+
+// parseLogoOptions reads the size and opacity of an uploaded logo. The width percentage
+// is required, the opacity defaults to 1.
+func parseLogoOptions(get fieldGetter) (*qrLogo, error) {
+	logo := &qrLogo{Opacity: 1}
+
+	// A logo is always drawn, so it must cover part of the code for the coverage check
+	percent, err := strconv.ParseFloat(get("logoWidthPercent"), 64)
+	if err != nil || percent <= 0 || percent > 1 {
+		return nil, errors.New("Invalid logo width percent: must be greater than 0 and at most 1")
+	}
+	logo.Percent = percent
+
+	if value := get("logoOpacity"); value != "" {
+		opacity, err := strconv.ParseFloat(value, 64)
+		if err != nil || opacity < 0 || opacity > 1 {
+			return nil, errors.New("Invalid logo opacity")
+		}
+		logo.Opacity = opacity
+	}
+	return logo, nil
+}
+
+// loadLogo opens and decodes a logo image relative to the working directory.
+func loadLogo(path string) (image.Image, error) {
+	file, err := http.Dir(".").Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return decodeImage(file)
+}
+
+// setResultHeaders reports the verification result, the final width and height of raster
+// and SVG images, any warnings about the options and the version of each format the
+// payload type offers, e.g. "X-QR-Variant: mecard; version=4; length=96".
+func setResultHeaders(w http.ResponseWriter, result *qrResult) {
+	w.Header().Set("X-QR-Verified", strconv.FormatBool(result.Verified))
+	if result.Width > 0 {
+		w.Header().Set("X-QR-Size", strconv.Itoa(result.Width))
+		w.Header().Set("X-QR-Height", strconv.Itoa(result.Height))
+	}
+	for _, warning := range result.Warnings {
+		w.Header().Add("X-QR-Warning", warning)
+	}
+	for _, variant := range result.Variants {
+		w.Header().Add("X-QR-Variant", fmt.Sprintf("%s; version=%d; length=%d", variant.Format, variant.Version, variant.Length))
+	}
+}
+
+// generateHandler returns the form handler for a payload type. Every type accepts the
+// shared QR code options and an optional uploaded "image" logo.
+func generateHandler(t PayloadType) http.HandlerFunc {
+	name := "generateHandler(" + t.Name() + ")"
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Check if the request method is POST, otherwise return an error
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Printf("%s: Method not allowed", name)
+			return
+		}
+
+		// Decode the uploaded logo, if any
+		var customLogo image.Image
+		file, _, err := r.FormFile("image")
+		if err != nil && err != http.ErrMissingFile {
+			http.Error(w, "Error reading image", http.StatusBadRequest)
+			log.Printf("%s: Error reading image - %v", name, err)
+			return
+		}
+		if file != nil {
+			defer file.Close()
+			customLogo, err = decodeImage(file)
+			if err != nil {
+				http.Error(w, "Failed to decode image", http.StatusBadRequest)
+				log.Printf("%s: Failed to decode image - %v", name, err)
+				return
+			}
+		}
+
+		// Generate the QR code from the form fields
+		result, err := generatePayloadQRCode(t, r.FormValue, r.FormValue, customLogo)
+		if err != nil {
+			var genErr *generateError
+			if errors.As(err, &genErr) {
+				http.Error(w, genErr.Message, genErr.Status)
+			} else {
+				http.Error(w, "Failed to generate QR code", http.StatusInternalServerError)
+			}
+			log.Printf("%s: %v", name, err)
+			return
+		}
+
+		// Set the content type header and write the encoded QR code to the HTTP response writer
+		w.Header().Set("Content-Type", result.ContentType)
+		setResultHeaders(w, result)
+		if _, err := w.Write(result.Data); err != nil {
+			log.Printf("%s: Failed to write QR code - %v", name, err)
+		}
+	}
+}
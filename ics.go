@@ -0,0 +1,274 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// DefaultICSStrip lists the properties removed from imported events by default. They
+// hold attachments, guest lists and HTML copies of the description, which are too
+// large for a QR code and not needed to add the event to a calendar.
+const DefaultICSStrip = "ATTACH,ATTENDEE,X-ALT-DESC"
+
+// importedEventPayload encodes an event read from a .ics file as it was written, apart
+// from the removed properties. The event's warnings are reported by the import handler.
+var importedEventPayload = payloadSpec{
+	name:   "ics",
+	fields: []PayloadField{required("payload", "event")},
+	logo:   EventLogoPath,
+	format: func(get fieldGetter) string { return get("payload") },
+}
+
+// icsEvent is one event read from a .ics file.
+type icsEvent struct {
+	Summary     string
+	Lines       []string   // Content lines of the VEVENT, BEGIN and END included
+	TimeZones   [][]string // VTIMEZONE components of the TZIDs the event uses
+	Description int        // Index of the event's DESCRIPTION line, or -1
+	Stripped    []string   // Names of the properties removed from the event
+	Warnings    []string   // Content removed from the event, reported with its code
+}
+
+// String writes the event as a calendar of its own with CRLF line endings, folding long
+// lines again.
+func (e *icsEvent) String() string {
+	lines := []string{"BEGIN:VCALENDAR", "VERSION:2.0", "PRODID:" + EventProductID}
+	for _, zone := range e.TimeZones {
+		lines = append(lines, zone...)
+	}
+	lines = append(lines, e.Lines...)
+	lines = append(lines, "END:VCALENDAR")
+	for i, line := range lines {
+		lines[i] = foldVCardLine(line)
+	}
+	return strings.Join(lines, "\r\n")
+}
+
+// fit removes the description when the event does not fit in a QR code, which is the
+// largest part of most events, with a warning.
+func (e *icsEvent) fit(fits func(payload string) bool) {
+	if e.Description < 0 || fits(e.String()) {
+		return
+	}
+	removed := len(contentLineValue(e.Lines[e.Description]))
+	e.Lines = append(e.Lines[:e.Description:e.Description], e.Lines[e.Description+1:]...)
+	e.Description = -1
+	e.Warnings = append(e.Warnings, fmt.Sprintf("Removed the description (%d bytes) to fit the code", removed))
+}
+
+// readICS splits a .ics file into its events, removing the properties in strip. Each
+// event keeps the VTIMEZONE components of the time zones it refers to.
+func readICS(r io.Reader, strip map[string]bool) ([]*icsEvent, error) {
+	lines, err := readContentLines(r, false)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid .ics file: %v", err)
+	}
+
+	var events []*icsEvent
+	var event *icsEvent
+	var zone []string
+	zones := map[string][]string{}
+	var stack []string // Names of the open components
+	for _, line := range lines {
+		name, _ := contentLineName(line)
+		value := strings.ToUpper(contentLineValue(line))
+		switch {
+		case name == "BEGIN":
+			if len(stack) == 0 && value != "VCALENDAR" {
+				return nil, errors.New("Invalid .ics file: content outside BEGIN:VCALENDAR and END:VCALENDAR")
+			}
+			stack = append(stack, value)
+			switch {
+			case len(stack) == 2 && value == "VEVENT":
+				event = &icsEvent{Description: -1}
+			case len(stack) == 2 && value == "VTIMEZONE":
+				zone = []string{}
+			}
+		case name == "END":
+			if len(stack) == 0 || stack[len(stack)-1] != value {
+				return nil, fmt.Errorf("Invalid .ics file: unexpected END:%s", value)
+			}
+			stack = stack[:len(stack)-1]
+		case len(stack) == 0:
+			return nil, errors.New("Invalid .ics file: content outside BEGIN:VCALENDAR and END:VCALENDAR")
+		}
+
+		switch {
+		case event != nil:
+			if strip[name] {
+				event.Stripped = append(event.Stripped, name)
+				continue
+			}
+			if name == "SUMMARY" && len(stack) == 2 {
+				event.Summary = unescapeBackslashes(contentLineValue(line), true)
+			}
+			if name == "DESCRIPTION" && len(stack) == 2 {
+				event.Description = len(event.Lines)
+			}
+			event.Lines = append(event.Lines, line)
+			if len(stack) == 1 {
+				events = append(events, event)
+				event = nil
+				if len(events) > MaxBatchRows {
+					return nil, fmt.Errorf("Too many events: maximum is %d", MaxBatchRows)
+				}
+			}
+		case zone != nil:
+			zone = append(zone, line)
+			if len(stack) == 1 {
+				for _, line := range zone {
+					if name, _ := contentLineName(line); name == "TZID" {
+						zones[contentLineValue(line)] = zone
+					}
+				}
+				zone = nil
+			}
+		}
+	}
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("Invalid .ics file: missing END:%s", stack[len(stack)-1])
+	}
+	if len(events) == 0 {
+		return nil, errors.New("No events found in .ics file")
+	}
+
+	for _, event := range events {
+		// Report the removed properties once each
+		if len(event.Stripped) > 0 {
+			removed := map[string]bool{}
+			for _, name := range event.Stripped {
+				removed[name] = true
+			}
+			event.Warnings = append(event.Warnings, "Removed "+strings.Join(sortedKeys(removed), ", "))
+		}
+
+		// Attach the time zones the event refers to, in order of first use
+		seen := map[string]bool{}
+		for _, line := range event.Lines {
+			_, params := contentLineName(line)
+			for _, param := range params {
+				key, tzid, ok := strings.Cut(param, "=")
+				tzid = strings.Trim(tzid, `"`)
+				if !ok || !strings.EqualFold(key, "TZID") || seen[tzid] {
+					continue
+				}
+				seen[tzid] = true
+				if zone, ok := zones[tzid]; ok {
+					event.TimeZones = append(event.TimeZones, zone)
+				}
+			}
+		}
+	}
+	return events, nil
+}
+
+// icsBatchSource lists the events as batch rows, with their warnings, so a file with
+// several events is written as a ZIP archive with a manifest like a CSV batch.
+func icsBatchSource(events []*icsEvent) *batchSource {
+	source := &batchSource{Columns: map[string]int{"payload": 0, BatchFilenameColumn: 1}}
+	for _, event := range events {
+		source.Rows = append(source.Rows, []string{event.String(), event.Summary})
+		source.Warnings = append(source.Warnings, event.Warnings)
+	}
+	return source
+}
+
+func importICSHandler(w http.ResponseWriter, r *http.Request) {
+	// Check if the request method is POST, otherwise return an error
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		log.Printf("importICSHandler: Method not allowed")
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, MaxBatchUploadBytes)
+
+	// Read the uploaded .ics file
+	icsFile, _, err := r.FormFile("ics")
+	if err != nil {
+		http.Error(w, "Missing .ics file", http.StatusBadRequest)
+		log.Printf("importICSHandler: Missing .ics file - %v", err)
+		return
+	}
+	defer icsFile.Close()
+	events, err := readICS(icsFile, parseStripOption(r.FormValue("strip"), DefaultICSStrip))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		log.Printf("importICSHandler: %v", err)
+		return
+	}
+
+	// Decode the uploaded logo, if any
+	var customLogo image.Image
+	file, _, err := r.FormFile("image")
+	if err != nil && err != http.ErrMissingFile {
+		http.Error(w, "Error reading image", http.StatusBadRequest)
+		log.Printf("importICSHandler: Error reading image - %v", err)
+		return
+	}
+	if file != nil {
+		defer file.Close()
+		customLogo, err = decodeImage(file)
+		if err != nil {
+			http.Error(w, "Failed to decode image", http.StatusBadRequest)
+			log.Printf("importICSHandler: Failed to decode image - %v", err)
+			return
+		}
+	}
+
+	// Validate the shared options, then trim the events that do not fit
+	if err := validateBatchOptions(importedEventPayload, r.FormValue, customLogo); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		log.Printf("importICSHandler: %v", err)
+		return
+	}
+	fits, err := payloadFits(importedEventPayload, r.FormValue, customLogo)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		log.Printf("importICSHandler: %v", err)
+		return
+	}
+	for _, event := range events {
+		event.fit(fits)
+	}
+	source := icsBatchSource(events)
+
+	// Several events are returned as a ZIP archive with one code each
+	if len(events) > 1 {
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="events-qr-codes.zip"`)
+		failed, err := writeBatchZip(w, importedEventPayload, source, r.FormValue, customLogo)
+		if err != nil {
+			log.Printf("importICSHandler: Failed to write ZIP archive - %v", err)
+			return
+		}
+		log.Printf("importICSHandler: Generated %d of %d event codes", len(source.Rows)-failed, len(source.Rows))
+		return
+	}
+
+	// Generate the code of a single event
+	result, err := generatePayloadQRCode(importedEventPayload, source.get(source.Rows[0]), r.FormValue, customLogo)
+	if err != nil {
+		var genErr *generateError
+		if errors.As(err, &genErr) {
+			http.Error(w, genErr.Message, genErr.Status)
+		} else {
+			http.Error(w, "Failed to generate QR code", http.StatusInternalServerError)
+		}
+		log.Printf("importICSHandler: %v", err)
+		return
+	}
+
+	// Set the content type header and write the QR code to the HTTP response writer,
+	// reporting the content removed from the event with the warnings
+	result.Warnings = append(result.Warnings, events[0].Warnings...)
+	w.Header().Set("Content-Type", result.ContentType)
+	setResultHeaders(w, result)
+	if _, err := w.Write(result.Data); err != nil {
+		log.Printf("importICSHandler: Failed to write QR code - %v", err)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"image"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// icsSample is a calendar with two events, one using a time zone, a stripped attendee
+// list and an alarm of its own.
+var icsSample = strings.Join([]string{
+	"BEGIN:VCALENDAR", "VERSION:2.0", "PRODID:-//Other//EN",
+	"BEGIN:VTIMEZONE", "TZID:Europe/Zurich",
+	"BEGIN:STANDARD", "DTSTART:19701025T030000", "TZOFFSETFROM:+0200", "TZOFFSETTO:+0100", "END:STANDARD",
+	"END:VTIMEZONE",
+	"BEGIN:VTIMEZONE", "TZID:America/New_York", "END:VTIMEZONE",
+	"BEGIN:VEVENT", "UID:1", `SUMMARY:Team\, sync`, "DTSTART;TZID=Europe/Zurich:20261102T090000",
+	"DESCRIPTION:Agenda", "ATTENDEE:mailto:a@example.com", "ATTENDEE:mailto:b@example.com",
+	"X-ALT-DESC;FMTTYPE=text/html:<b>Agenda</b>",
+	"BEGIN:VALARM", "TRIGGER:-PT5M", "DESCRIPTION:Alarm", "END:VALARM",
+	"END:VEVENT",
+	"BEGIN:VEVENT", "UID:2", "SUMMARY:Call", "DTSTART:20261103T090000Z", "END:VEVENT",
+	"END:VCALENDAR", "",
+}, "\r\n")
+
+func TestReadICS(t *testing.T) {
+	events, err := readICS(strings.NewReader(icsSample), parseStripOption("", DefaultICSStrip))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2", len(events))
+	}
+
+	first := events[0]
+	if first.Summary != "Team, sync" {
+		t.Errorf("summary = %q", first.Summary)
+	}
+	if first.Description != 4 || first.Lines[first.Description] != "DESCRIPTION:Agenda" {
+		t.Errorf("description index = %d", first.Description)
+	}
+	if want := []string{"Removed ATTENDEE, X-ALT-DESC"}; !reflect.DeepEqual(first.Warnings, want) {
+		t.Errorf("warnings = %q, want %q", first.Warnings, want)
+	}
+	want := strings.Join([]string{
+		"BEGIN:VCALENDAR", "VERSION:2.0", "PRODID:" + EventProductID,
+		"BEGIN:VTIMEZONE", "TZID:Europe/Zurich",
+		"BEGIN:STANDARD", "DTSTART:19701025T030000", "TZOFFSETFROM:+0200", "TZOFFSETTO:+0100", "END:STANDARD",
+		"END:VTIMEZONE",
+		"BEGIN:VEVENT", "UID:1", `SUMMARY:Team\, sync`, "DTSTART;TZID=Europe/Zurich:20261102T090000",
+		"DESCRIPTION:Agenda", "BEGIN:VALARM", "TRIGGER:-PT5M", "DESCRIPTION:Alarm", "END:VALARM",
+		"END:VEVENT", "END:VCALENDAR",
+	}, "\r\n")
+	if got := first.String(); got != want {
+		t.Errorf("String =\n%s\nwant\n%s", got, want)
+	}
+
+	second := events[1]
+	if second.Summary != "Call" || second.Description != -1 || len(second.Warnings) != 0 || len(second.TimeZones) != 0 {
+		t.Errorf("second event = %+v", second)
+	}
+}
+
+func TestReadICSErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		ics     string
+		wantErr string
+	}{
+		{"empty", "", "No events found"},
+		{"no events", "BEGIN:VCALENDAR\nVERSION:2.0\nEND:VCALENDAR\n", "No events found"},
+		{"content outside calendar", "SUMMARY:x\n", "content outside BEGIN:VCALENDAR"},
+		{"component outside calendar", "BEGIN:VEVENT\nEND:VEVENT\n", "content outside BEGIN:VCALENDAR"},
+		{"mismatched END", "BEGIN:VCALENDAR\nBEGIN:VEVENT\nEND:VTODO\n", "unexpected END:VTODO"},
+		{"missing END", "BEGIN:VCALENDAR\nBEGIN:VEVENT\nSUMMARY:x\n", "missing END:VEVENT"},
+		{"too many events", "BEGIN:VCALENDAR\n" + strings.Repeat("BEGIN:VEVENT\nEND:VEVENT\n", MaxBatchRows+1) + "END:VCALENDAR\n", "Too many events"},
+	}
+	for _, tt := range tests {
+		if _, err := readICS(strings.NewReader(tt.ics), parseStripOption("", DefaultICSStrip)); !checkError(err, tt.wantErr) {
+			t.Errorf("%s: readICS = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestICSEventFit(t *testing.T) {
+	read := func() *icsEvent {
+		events, err := readICS(strings.NewReader(icsSample), parseStripOption("none", DefaultICSStrip))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return events[0]
+	}
+
+	// An event that fits is left as it is
+	event := read()
+	lines := len(event.Lines)
+	event.fit(func(string) bool { return true })
+	if len(event.Lines) != lines || event.Description != 4 || len(event.Warnings) != 0 {
+		t.Errorf("fitting event changed: %+v", event)
+	}
+
+	// Otherwise the event's description is removed, but not the alarm's
+	event = read()
+	event.fit(func(payload string) bool { return !strings.Contains(payload, "DESCRIPTION:Agenda") })
+	if len(event.Lines) != lines-1 || event.Description != -1 {
+		t.Errorf("lines = %q", event.Lines)
+	}
+	if !strings.Contains(event.String(), "DESCRIPTION:Alarm") {
+		t.Error("alarm description removed")
+	}
+	if want := []string{"Removed the description (6 bytes) to fit the code"}; !reflect.DeepEqual(event.Warnings, want) {
+		t.Errorf("warnings = %q, want %q", event.Warnings, want)
+	}
+
+	// Events without a description are left too large
+	event = read()
+	event.fit(func(string) bool { return false })
+	event.fit(func(string) bool { return false })
+	if len(event.Warnings) != 1 {
+		t.Errorf("warnings = %q", event.Warnings)
+	}
+}
+
+func TestPayloadFits(t *testing.T) {
+	logo := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	tests := []struct {
+		name       string
+		options    map[string]string
+		customLogo image.Image
+		payload    string
+		want       bool
+	}{
+		{"default logo", map[string]string{"size": "256"}, nil, "BEGIN:VCALENDAR", true},
+		{"too long at level H", map[string]string{"size": "256"}, nil, strings.Repeat("x", 3000), false},
+		{"large custom logo", map[string]string{"size": "256", "logoWidthPercent": "0.6"}, logo, "BEGIN:VCALENDAR", false},
+		{"large custom logo shrunk", map[string]string{"size": "256", "logoWidthPercent": "0.6", "autoShrinkLogo": "true"}, logo, "BEGIN:VCALENDAR", true},
+		{"no margin", map[string]string{"size": "256", "logoWidthPercent": "0.45", "margin": "0"}, logo, "BEGIN:VCALENDAR", true},
+		{"wide margin", map[string]string{"size": "256", "logoWidthPercent": "0.45", "margin": "40"}, logo, "BEGIN:VCALENDAR", false},
+	}
+	for _, tt := range tests {
+		fits, err := payloadFits(importedEventPayload, fields(tt.options), tt.customLogo)
+		if err != nil {
+			t.Fatalf("%s: payloadFits: %v", tt.name, err)
+		}
+		if got := fits(tt.payload); got != tt.want {
+			t.Errorf("%s: fits = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := payloadFits(importedEventPayload, fields(map[string]string{}), nil); !checkError(err, "Missing size") {
+		t.Errorf("payloadFits without size = %v", err)
+	}
+	if _, err := payloadFits(importedEventPayload, fields(map[string]string{"size": "256"}), logo); !checkError(err, "Invalid logo width percent") {
+		t.Errorf("payloadFits without logo width = %v", err)
+	}
+}
+
+func TestICSBatchWarnings(t *testing.T) {
+	events, err := readICS(strings.NewReader(icsSample), parseStripOption("", DefaultICSStrip))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var archive bytes.Buffer
+	options := fields(map[string]string{"size": "64", "verify": "false"})
+	if _, err := writeBatchZip(&archive, importedEventPayload, icsBatchSource(events), options, nil); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := zip.NewReader(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := reader.Open(BatchManifestName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manifest.Close()
+	records, err := csv.NewReader(manifest).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("manifest has %d records, want 3", len(records))
+	}
+	if got, want := records[1][4], "Removed ATTENDEE, X-ALT-DESC"; got != want {
+		t.Errorf("first event warnings = %q, want %q", got, want)
+	}
+	if got := records[2][4]; got != "" {
+		t.Errorf("second event warnings = %q, want none", got)
+	}
+	if got := records[0][4]; got != "warnings" {
+		t.Errorf("manifest header = %q", records[0])
+	}
+}
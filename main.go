@@ -2,21 +2,26 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"image"
 	"image/color"
 	"image/draw"
+	_ "image/gif"
 	"image/jpeg"
 	"image/png"
 	"io"
 	"log"
 	"net/http"
-	"net/url"
+	"os"
 	"strconv"
 	"strings"
 
 	"github.com/nfnt/resize"
 	"github.com/skip2/go-qrcode"
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
 )
 
 const (
@@ -26,6 +31,28 @@ const (
 	QRLarge      = 512  // Large QR code size in pixels
 	QRExtraLarge = 1024 // Extra large QR code size in pixels
 
+	// Range of image sizes accepted by the size option, in pixels
+	MinQRCodeSize = 64
+	MaxQRCodeSize = 4096
+
+	// MaxModuleSize is the largest moduleSize option, in pixels per module
+	MaxModuleSize = 100
+
+	// QuietZone is the margin in modules required by the QR code specification, used by default
+	QuietZone = 4
+
+	// MaxMargin is the largest margin option, in modules
+	MaxMargin = 40
+
+	// MaxImageDimension is the largest width and height of an uploaded image, in pixels,
+	// so a small file declaring a huge image cannot exhaust memory when decoded
+	MaxImageDimension = 8192
+
+	// Output formats
+	FormatPNG = "png" // Raster PNG image
+	FormatSVG = "svg" // Scalable vector image
+	FormatPDF = "pdf" // Print-ready vector PDF
+
 	// Logo size configuration
 	LogoPercent = 0.25 // Percentage of the QR code occupied by the logo
 
@@ -50,875 +77,422 @@ const (
 )
 
 func main() {
+	// Run the requested subcommand, serving by default
+	os.Exit(runCLI(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// serve starts the web server on the given address.
+func serve(addr string) error {
 	// Serve static files from the "static" directory
 	fs := http.FileServer(http.Dir("./static"))
 	http.Handle("/static/", http.StripPrefix("/static/", fs))
 
 	// Define handler functions for different QR code generation requests
 	http.HandleFunc("/", serveHTML)
-	http.HandleFunc("/generate", generateQRCodeHandler)
-	http.HandleFunc("/generate_instagram", generateInstagramQRCodeHandler)
-	http.HandleFunc("/generate_facebook", generateFacebookQRCodeHandler)
-	http.HandleFunc("/generate_tiktok", generateTikTokQRCodeHandler)
-	http.HandleFunc("/generate_linkedin", generateLinkedInQRCodeHandler)
-	http.HandleFunc("/generate_youtube", generateYouTubeQRCodeHandler)
-	http.HandleFunc("/generate_vcard", generateVCardQRCodeHandler)
-	http.HandleFunc("/generate_wifi", generateWiFiQRCodeHandler)
-	http.HandleFunc("/generate_map", generateMapQRCodeHandler)
-	http.HandleFunc("/generate_event", generateEventQRCodeHandler)
-	http.HandleFunc("/generate_paypal", generatePayPalQRCodeHandler)
-	http.HandleFunc("/generate_whatsapp", generateWhatsAppQRCodeHandler)
-	http.HandleFunc("/generate_x", generateXQRCodeHandler)
-	http.HandleFunc("/generate_email", generateEmailQRCodeHandler)
-	http.HandleFunc("/generate_sms", generateSMSQRCodeHandler)
-	http.HandleFunc("/generate_phone", generatePhoneQRCodeHandler)
-	http.HandleFunc("/generate_spotify", generateSpotifyQRCodeHandler)
-	http.HandleFunc("/generate_telegram", generateTelegramQRCodeHandler)
-	http.HandleFunc("/generate_zoom", generateZoomQRCodeHandler)
-
-	// Log server startup message
-	log.Println("Server running on port 5555")
-
-	// Start the server and handle fatal errors
-	log.Fatal(http.ListenAndServe(":5555", nil))
-}
-
-func serveHTML(w http.ResponseWriter, r *http.Request) {
-	// Serve the index.html file
-	http.ServeFile(w, r, "static/index.html")
-}
-
-func isValidQRCodeSize(size int) bool {
-	// Check if the provided size is one of the predefined valid sizes
-	return size == QRSmall || size == QRMedium || size == QRLarge || size == QRExtraLarge
-}
-
-func generateMapQRCodeHandler(w http.ResponseWriter, r *http.Request) {
-	// Check if the request method is POST, otherwise return an error
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		log.Printf("generateMapQRCodeHandler: Method not allowed")
-		return
-	}
-
-	// Extract latitude and longitude from the request form
-	latitude := r.FormValue("latitude")
-	longitude := r.FormValue("longitude")
-	// Check if both latitude and longitude are present in the request
-	if latitude == "" || longitude == "" {
-		http.Error(w, "Missing latitude or longitude", http.StatusBadRequest)
-		log.Printf("generateMapQRCodeHandler: Missing latitude or longitude")
-		return
+	for _, name := range payloadTypeNames() {
+		t, _ := lookupPayloadType(name)
+		http.HandleFunc("/generate_"+name, generateHandler(t))
 	}
 
-	// Validate the format and range of latitude
-	lat, err := strconv.ParseFloat(latitude, 64)
-	if err != nil || lat < -90 || lat > 90 {
-		http.Error(w, "Invalid latitude", http.StatusBadRequest)
-		log.Printf("generateMapQRCodeHandler: Invalid latitude")
-		return
-	}
+	// Custom URL codes are also served from /generate
+	urlType, _ := lookupPayloadType("url")
+	http.HandleFunc("/generate", generateHandler(urlType))
 
-	// Validate the format and range of longitude
-	lon, err := strconv.ParseFloat(longitude, 64)
-	if err != nil || lon < -180 || lon > 180 {
-		http.Error(w, "Invalid longitude", http.StatusBadRequest)
-		log.Printf("generateMapQRCodeHandler: Invalid longitude")
-		return
-	}
+	// Batch generation from a CSV file
+	http.HandleFunc("/batch", batchQRCodeHandler)
 
-	// Extract the requested QR code size from the form
-	sizeStr := r.FormValue("size")
+	// Contact codes from an uploaded .vcf file
+	http.HandleFunc("/import_vcf", importVCFHandler)
 
-	// Check if the size parameter is present
-	if sizeStr == "" {
-		http.Error(w, "Missing size", http.StatusBadRequest)
-		log.Printf("generateMapQRCodeHandler: Missing size")
-		return
-	}
+	// Event codes from an uploaded .ics file
+	http.HandleFunc("/import_ics", importICSHandler)
 
-	// Convert the size string to an integer and validate it against allowed sizes
-	size, err := strconv.Atoi(sizeStr)
-	if err != nil || !isValidQRCodeSize(size) {
-		http.Error(w, "Invalid size", http.StatusBadRequest)
-		log.Printf("generateMapQRCodeHandler: Invalid size - %v", err)
-		return
-	}
+	// Printable guest Wi-Fi cards
+	http.HandleFunc("/wifi_card", wifiCardHandler)
 
-	// Construct the geo URI for Google Maps using the validated latitude and longitude
-	geoURL := fmt.Sprintf("geo:%f,%f", lat, lon)
+	// Decoding and restyling of existing codes
+	http.HandleFunc("/decode", decodeHandler)
+	http.HandleFunc("/restyle", restyleHandler)
 
-	// Generate the QR code for the geo URI with the requested size
-	qrCode, err := generateQRCode(geoURL, size)
-	if err != nil {
-		http.Error(w, "Failed to generate QR code", http.StatusInternalServerError)
-		log.Printf("generateMapQRCodeHandler: Failed to generate QR code - %v", err)
-		return
-	}
+	// Versioned JSON API
+	http.HandleFunc("/api/v1/types", apiTypesHandler)
+	http.HandleFunc("/api/v1/qr", apiQRCodeHandler)
 
-	// Open the map logo image file
-	mapLogoFile, err := http.Dir(".").Open(MapLogoPath)
-	if err != nil {
-		http.Error(w, "Failed to open map logo: file not found or cannot be opened", http.StatusInternalServerError)
-		log.Printf("generateMapQRCodeHandler: Failed to open map logo - %v", err)
-		return
-	}
-	defer mapLogoFile.Close() // Close the file after processing
+	// Log server startup message
+	log.Printf("Server running on %s", addr)
 
-	// Decode the map logo image
-	mapLogo, err := decodeImage(mapLogoFile)
-	if err != nil {
-		http.Error(w, "Failed to decode map logo", http.StatusInternalServerError)
-		log.Printf("generateMapQRCodeHandler: Failed to decode map logo - %v", err)
-		return
-	}
+	// Start the server and return fatal errors
+	return http.ListenAndServe(addr, nil)
+}
 
-	// Overlay the map logo onto the QR code with a specific logo size percentage
-	qrCode, err = overlayImageOnQRCode(qrCode, mapLogo, LogoPercent)
-	if err != nil {
-		http.Error(w, "Failed to overlay map logo on QR code", http.StatusInternalServerError)
-		log.Printf("generateMapQRCodeHandler: Failed to overlay map logo on QR code - %v", err)
-		return
-	}
+func serveHTML(w http.ResponseWriter, r *http.Request) {
+	// Serve the index.html file
+	http.ServeFile(w, r, "static/index.html")
+}
 
-	// Set the content type header to indicate PNG image data
-	w.Header().Set("Content-Type", "image/png")
+func isValidQRCodeSize(size int) bool {
+	// Check if the provided size is within the configured range
+	return size >= MinQRCodeSize && size <= MaxQRCodeSize
+}
 
-	// Encode the QR code image as PNG format and write it to the HTTP response writer
-	err = png.Encode(w, qrCode)
-	if err != nil {
-		log.Printf("generateMapQRCodeHandler: Failed to encode QR code as PNG - %v", err)
-	}
+// qrOptions holds the QR code settings shared by every generate handler.
+type qrOptions struct {
+	Size       int          // Image size in pixels
+	ModuleSize int          // Pixels per module, replacing Size when set
+	Margin     int          // Quiet zone width in modules
+	ECC        string       // Requested error correction level (L, M, Q or H), empty for the default
+	Format     string       // Output format, FormatPNG, FormatSVG or FormatPDF
+	Print      printOptions // Physical page settings, used only for PDF output
+	Foreground color.NRGBA  // Colour of the dark modules
+	Background color.NRGBA  // Colour of the light modules and quiet zone, possibly transparent
+	Style      styleOptions // Module and finder pattern shapes
+	Frame      frameOptions // Frame and caption drawn around the code
 }
 
-func generateWiFiQRCodeHandler(w http.ResponseWriter, r *http.Request) {
-	// Check if the request method is POST, otherwise return an error
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		log.Printf("generateWiFiQRCodeHandler: Method not allowed")
-		return
-	}
+// parseQROptions extracts and validates the shared QR code options from the request fields.
+func parseQROptions(get fieldGetter) (qrOptions, error) {
+	var opts qrOptions
 
-	// Extract SSID, password, security type, and size from the request form
-	ssid := r.FormValue("ssid")
-	password := r.FormValue("password")
-	security := r.FormValue("security")
-	sizeStr := r.FormValue("size")
-
-	// Validate the presence of SSID
-	if ssid == "" {
-		http.Error(w, "Missing SSID", http.StatusBadRequest)
-		log.Printf("generateWiFiQRCodeHandler: Missing SSID")
-		return
+	// Validate the optional output format, defaulting to PNG
+	opts.Format = strings.ToLower(get("format"))
+	if opts.Format == "" {
+		opts.Format = FormatPNG
 	}
-
-	// Define a map of valid security types for Wi-Fi networks
-	validSecurities := map[string]bool{"WPA": true, "WPA2": true, "WPA3": true, "WEP": true, "nopass": true}
-
-	// Validate the provided security typ
-	if !validSecurities[security] {
-		http.Error(w, "Invalid security type", http.StatusBadRequest)
-		log.Printf("generateWiFiQRCodeHandler: Invalid security type")
-		return
+	if opts.Format != FormatPNG && opts.Format != FormatSVG && opts.Format != FormatPDF {
+		return opts, fmt.Errorf("Invalid format %q: must be png, svg or pdf", get("format"))
 	}
 
-	// Validate password requirements for WPA/WPA2/WPA3 security
-	if security == "WPA" || security == "WPA2" || security == "WPA3" {
-		if password == "" {
-			http.Error(w, "Password is required for WPA/WPA2/WPA3 security", http.StatusBadRequest)
-			log.Printf("generateWiFiQRCodeHandler: Password is required for WPA/WPA2/WPA3 security")
-			return
+	// PDF output is sized physically rather than in pixels
+	if opts.Format == FormatPDF {
+		printOpts, err := parsePrintOptions(get)
+		if err != nil {
+			return opts, err
 		}
-		if len(password) < 8 || len(password) > 63 {
-			http.Error(w, "Password for WPA/WPA2/WPA3 must be between 8 and 63 characters", http.StatusBadRequest)
-			log.Printf("generateWiFiQRCodeHandler: Password for WPA/WPA2/WPA3 must be between 8 and 63 characters")
-			return
+		opts.Print = printOpts
+	} else if value := get("moduleSize"); value != "" {
+		// A module size gives every module the same whole number of pixels
+		moduleSize, err := strconv.Atoi(value)
+		if err != nil || moduleSize < 1 || moduleSize > MaxModuleSize {
+			return opts, fmt.Errorf("Invalid moduleSize: must be 1 to %d pixels", MaxModuleSize)
 		}
-	}
-
-	// Validate password requirements for WEP security
-	if security == "WEP" {
-		if len(password) != 5 && len(password) != 13 {
-			http.Error(w, "Password for WEP must be exactly 5 or 13 characters", http.StatusBadRequest)
-			log.Printf("generateWiFiQRCodeHandler: Password for WEP must be exactly 5 or 13 characters")
-			return
+		opts.ModuleSize = moduleSize
+	} else {
+		// Validate the presence of size parameter. SVG images scale freely, so their size
+		// only sets the nominal width and defaults to the large size.
+		sizeStr := get("size")
+		if sizeStr == "" && opts.Format == FormatSVG {
+			sizeStr = strconv.Itoa(QRLarge)
+		}
+		if sizeStr == "" {
+			return opts, fmt.Errorf("Missing size")
 		}
-	}
-
-	// Validate the presence of size parameter
-	if sizeStr == "" {
-		http.Error(w, "Missing size", http.StatusBadRequest)
-		log.Printf("generateWiFiQRCodeHandler: Missing size")
-		return
-	}
-
-	// Convert size string to integer and validate it against allowed sizes
-	size, err := strconv.Atoi(sizeStr)
-	if err != nil || !isValidQRCodeSize(size) {
-		http.Error(w, "Invalid size", http.StatusBadRequest)
-		log.Printf("generateWiFiQRCodeHandler: Invalid size - %v", err)
-		return
-	}
-
-	// Construct the Wi-Fi network information string using the validated parameters
-	wifiString := fmt.Sprintf("WIFI:T:%s;S:%s;P:%s;;", security, ssid, password)
-	qrCode, err := generateQRCode(wifiString, size)
-	if err != nil {
-		http.Error(w, "Failed to generate QR code", http.StatusInternalServerError)
-		log.Printf("generateWiFiQRCodeHandler: Failed to generate QR code - %v", err)
-		return
-	}
-
-	// Generate the QR code for the Wi-Fi network information string with the requested size
-	wifiLogoFile, err := http.Dir(".").Open(WiFiLogoPath)
-	if err != nil {
-		http.Error(w, "Failed to open Wi-Fi logo: file not found or cannot be opened", http.StatusInternalServerError)
-		log.Printf("generateWiFiQRCodeHandler: Failed to open Wi-Fi logo - %v", err)
-		return
-	}
-	defer wifiLogoFile.Close() // Close the file after processing
-
-	// Decode the Wi-Fi logo image
-	wifiLogo, err := decodeImage(wifiLogoFile)
-	if err != nil {
-		http.Error(w, "Failed to decode Wi-Fi logo", http.StatusInternalServerError)
-		log.Printf("generateWiFiQRCodeHandler: Failed to decode Wi-Fi logo - %v", err)
-		return
-	}
-
-	// Overlay the Wi-Fi logo onto the QR code with a specific logo size percentage
-	qrCode, err = overlayImageOnQRCode(qrCode, wifiLogo, LogoPercent)
-	if err != nil {
-		http.Error(w, "Failed to overlay Wi-Fi logo on QR code", http.StatusInternalServerError)
-		log.Printf("generateWiFiQRCodeHandler: Failed to overlay Wi-Fi logo on QR code - %v", err)
-		return
-	}
-
-	// Set the content type header to indicate PNG image data
-	w.Header().Set("Content-Type", "image/png")
 
-	// Encode the QR code image as PNG format and write it to the HTTP response writer
-	err = png.Encode(w, qrCode)
-	if err != nil {
-		log.Printf("generateWiFiQRCodeHandler: Failed to encode QR code as PNG - %v", err)
+		// Convert size string to integer and validate it against allowed sizes
+		size, err := strconv.Atoi(sizeStr)
+		if err != nil || !isValidQRCodeSize(size) {
+			return opts, fmt.Errorf("Invalid size: must be %d to %d pixels", MinQRCodeSize, MaxQRCodeSize)
+		}
+		opts.Size = size
 	}
-}
 
-func generateLinkedInQRCodeHandler(w http.ResponseWriter, r *http.Request) {
-	// Check if the request method is POST, otherwise return an error
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		log.Printf("generateLinkedInQRCodeHandler: Method not allowed")
-		return
+	// Validate the optional margin, defaulting to the standard quiet zone
+	opts.Margin = QuietZone
+	if value := get("margin"); value != "" {
+		margin, err := strconv.Atoi(value)
+		if err != nil || margin < 0 || margin > MaxMargin {
+			return opts, fmt.Errorf("Invalid margin: must be 0 to %d modules", MaxMargin)
+		}
+		opts.Margin = margin
 	}
 
-	// Extract username from the request form
-	username := r.FormValue("username")
-
-	// Validate the presence of username
-	if username == "" {
-		http.Error(w, "Missing username", http.StatusBadRequest)
-		log.Printf("generateLinkedInQRCodeHandler: Missing username")
-		return
+	// Validate the optional error correction level
+	opts.ECC = strings.ToUpper(get("ecc"))
+	if _, ok := eccLevels[opts.ECC]; opts.ECC != "" && !ok {
+		return opts, fmt.Errorf("Invalid ecc level %q: must be L, M, Q or H", get("ecc"))
 	}
 
-	// Extract size string from the request form
-	sizeStr := r.FormValue("size")
-	// Validate the presence of size parameter
-	if sizeStr == "" {
-		http.Error(w, "Missing size", http.StatusBadRequest)
-		log.Printf("generateLinkedInQRCodeHandler: Missing size")
-		return
+	// Validate the optional colours, defaulting to black on white
+	opts.Foreground, opts.Background = defaultForeground, defaultBackground
+	if value := get("foreground"); value != "" {
+		fg, err := parseColor(value)
+		if err != nil {
+			return opts, fmt.Errorf("Invalid foreground: %v", err)
+		}
+		opts.Foreground = fg
 	}
-
-	// Convert size string to integer and validate it against allowed sizes
-	size, err := strconv.Atoi(sizeStr)
-	if err != nil || !isValidQRCodeSize(size) {
-		http.Error(w, "Invalid size", http.StatusBadRequest)
-		log.Printf("generateLinkedInQRCodeHandler: Invalid size - %v", err)
-		return
+	if value := get("background"); value != "" {
+		bg, err := parseColor(value)
+		if err != nil {
+			return opts, fmt.Errorf("Invalid background: %v", err)
+		}
+		opts.Background = bg
 	}
 
-	// Construct the LinkedIn profile URL using the extracted username
-	url := "https://www.linkedin.com/in/" + username
-
-	// Generate the QR code for the LinkedIn profile URL with the requested size
-	qrCode, err := generateQRCode(url, size)
-	if err != nil {
-		http.Error(w, "Failed to generate QR code", http.StatusInternalServerError)
-		log.Printf("generateLinkedInQRCodeHandler: Failed to generate QR code - %v", err)
-		return
+	// Reject colour pairs that phone scanners cannot tell apart reliably
+	if ratio := contrastRatio(opts.Foreground, opts.Background); ratio < MinContrastRatio {
+		return opts, fmt.Errorf("Insufficient contrast between foreground and background: %.2f:1, minimum is %.1f:1", ratio, MinContrastRatio)
 	}
 
-	// Open the LinkedIn logo image file
-	linkedinLogoFile, err := http.Dir(".").Open(LinkedInLogoPath)
+	// Validate the optional module and eye styling
+	style, err := parseStyleOptions(get, opts.Foreground)
 	if err != nil {
-		http.Error(w, "Failed to open LinkedIn logo: file not found or cannot be opened", http.StatusInternalServerError)
-		log.Printf("generateLinkedInQRCodeHandler: Failed to open LinkedIn logo - %v", err)
-		return
+		return opts, err
 	}
-	defer linkedinLogoFile.Close() // Close the file after processing
-
-	// Decode the LinkedIn logo image
-	linkedinLogo, err := decodeImage(linkedinLogoFile)
-	if err != nil {
-		http.Error(w, "Failed to decode LinkedIn logo", http.StatusInternalServerError)
-		log.Printf("generateLinkedInQRCodeHandler: Failed to decode LinkedIn logo - %v", err)
-		return
+	for name, c := range map[string]color.NRGBA{"eyeOuterColor": style.EyeOuterColor, "eyeInnerColor": style.EyeInnerColor} {
+		if ratio := contrastRatio(c, opts.Background); ratio < MinContrastRatio {
+			return opts, fmt.Errorf("Insufficient contrast between %s and background: %.2f:1, minimum is %.1f:1", name, ratio, MinContrastRatio)
+		}
 	}
+	opts.Style = style
 
-	// Overlay the LinkedIn logo onto the QR code with a specific logo size percentage
-	qrCode, err = overlayImageOnQRCode(qrCode, linkedinLogo, LogoPercent)
+	// Validate the optional frame and caption
+	frame, err := parseFrameOptions(get, opts.Foreground, opts.Background)
 	if err != nil {
-		http.Error(w, "Failed to overlay LinkedIn logo on QR code", http.StatusInternalServerError)
-		log.Printf("generateLinkedInQRCodeHandler: Failed to overlay LinkedIn logo on QR code - %v", err)
-		return
+		return opts, err
 	}
+	opts.Frame = frame
 
-	// Set the content type header to indicate PNG image data
-	w.Header().Set("Content-Type", "image/png")
-
-	// Encode the QR code image as PNG format and write it to the HTTP response writer
-	err = png.Encode(w, qrCode)
-	if err != nil {
-		log.Printf("generateLinkedInQRCodeHandler: Failed to encode QR code as PNG - %v", err)
-	}
+	return opts, nil
 }
 
-func generateYouTubeQRCodeHandler(w http.ResponseWriter, r *http.Request) {
-	// Check if the request method is POST, otherwise return an error
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		log.Printf("generateYouTubeQRCodeHandler: Method not allowed")
-		return
+// parseFormBool parses an optional boolean form value, accepting "on" as sent by HTML checkboxes.
+func parseFormBool(value string) (bool, error) {
+	if value == "" {
+		return false, nil
 	}
-	// Extract YouTube channel name from the request form
-	channel := r.FormValue("channel")
-	// Validate the presence of channel name
-	if channel == "" {
-		http.Error(w, "Missing channel", http.StatusBadRequest)
-		log.Printf("generateYouTubeQRCodeHandler: Missing channel")
-		return
+	if strings.EqualFold(value, "on") {
+		return true, nil
 	}
+	return strconv.ParseBool(value)
+}
 
-	// Extract size string from the request form
-	sizeStr := r.FormValue("size")
-	// Validate the presence of size parameter
-	if sizeStr == "" {
-		http.Error(w, "Missing size", http.StatusBadRequest)
-		log.Printf("generateYouTubeQRCodeHandler: Missing size")
-		return
-	}
+// eccLevels maps the standard error correction level names to the skip2/go-qrcode levels,
+// which are named one step differently (qrcode.High is level Q).
+var eccLevels = map[string]qrcode.RecoveryLevel{
+	"L": qrcode.Low,
+	"M": qrcode.Medium,
+	"Q": qrcode.High,
+	"H": qrcode.Highest,
+}
 
-	// Convert size string to integer and validate it against allowed sizes
-	size, err := strconv.Atoi(sizeStr)
-	if err != nil || !isValidQRCodeSize(size) {
-		http.Error(w, "Invalid size", http.StatusBadRequest)
-		log.Printf("generateYouTubeQRCodeHandler: Invalid size - %v", err)
-		return
-	}
+// eccRecovery is the fraction of the symbol each error correction level can restore.
+var eccRecovery = map[qrcode.RecoveryLevel]float64{
+	qrcode.Low:     0.07,
+	qrcode.Medium:  0.15,
+	qrcode.High:    0.25,
+	qrcode.Highest: 0.30,
+}
 
-	// Construct the YouTube channel URL using the extracted channel name
-	url := "https://www.youtube.com/channel/" + channel
+// errLogoTooLarge is returned when a logo would hide more of the code than its error correction can recover.
+var errLogoTooLarge = errors.New("Logo too large for error correction level")
 
-	// Generate the QR code for the YouTube channel URL with the requested size
-	qrCode, err := generateQRCode(url, size)
-	if err != nil {
-		http.Error(w, "Failed to generate QR code", http.StatusInternalServerError)
-		log.Printf("generateYouTubeQRCodeHandler: Failed to generate QR code - %v", err)
-		return
-	}
-	// Open the YouTube logo image file
-	youtubeLogoFile, err := http.Dir(".").Open(YouTubeLogoPath)
-	if err != nil {
-		http.Error(w, "Failed to open YouTube logo: file not found or cannot be opened", http.StatusInternalServerError)
-		log.Printf("generateYouTubeQRCodeHandler: Failed to open YouTube logo - %v", err)
-		return
+// resolveECCLevel returns the requested error correction level, defaulting to H when a logo
+// is overlaid and to M otherwise.
+func resolveECCLevel(ecc string, hasLogo bool) qrcode.RecoveryLevel {
+	if level, ok := eccLevels[ecc]; ok {
+		return level
 	}
-	defer youtubeLogoFile.Close() // Close the file after processing
-
-	// Decode the YouTube logo image
-	youtubeLogo, err := decodeImage(youtubeLogoFile)
-	if err != nil {
-		http.Error(w, "Failed to decode YouTube logo", http.StatusInternalServerError)
-		log.Printf("generateYouTubeQRCodeHandler: Failed to decode YouTube logo - %v", err)
-		return
+	if hasLogo {
+		return qrcode.Highest
 	}
+	return qrcode.Medium
+}
 
-	// Overlay the YouTube logo onto the QR code with a specific logo size percentage
-	qrCode, err = overlayImageOnQRCode(qrCode, youtubeLogo, LogoPercent)
-	if err != nil {
-		http.Error(w, "Failed to overlay YouTube logo on QR code", http.StatusInternalServerError)
-		log.Printf("generateYouTubeQRCodeHandler: Failed to overlay YouTube logo on QR code - %v", err)
-		return
-	}
-	// Set the content type header to indicate PNG image data
-	w.Header().Set("Content-Type", "image/png")
-	// Encode the QR code image as PNG format and write it to the HTTP response writer
-	err = png.Encode(w, qrCode)
-	if err != nil {
-		log.Printf("generateYouTubeQRCodeHandler: Failed to encode QR code as PNG - %v", err)
+// eccLevelName returns the standard name (L, M, Q or H) of an error correction level.
+func eccLevelName(level qrcode.RecoveryLevel) string {
+	for name, l := range eccLevels {
+		if l == level {
+			return name
+		}
 	}
+	return "?"
 }
 
-func generateQRCodeHandler(w http.ResponseWriter, r *http.Request) {
-	// Check if the request method is POST, otherwise return an error
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		log.Printf("generateQRCodeHandler: Method not allowed")
-		return
+// checkLogoCoverage verifies that a centred logo occupying logoPercent of the image width
+// hides no more of the symbol than its error correction level can recover.
+func checkLogoCoverage(qr *qrcode.QRCode, margin int, logoPercent float64) error {
+	if logoPercent <= 0 {
+		return nil
 	}
 
-	// Extract URL from the request form
-	url := r.FormValue("url")
+	// The image includes the quiet zone, which the logo percentage is measured against
+	// but which carries no data, so scale the logo up to the symbol itself.
+	total := len(qrBitmap(qr, margin))
+	symbol := total - 2*margin
+	side := logoPercent * float64(total) / float64(symbol)
+	coverage := side * side
 
-	// Validate the presence of URL
-	if url == "" {
-		http.Error(w, "Missing URL", http.StatusBadRequest)
-		log.Printf("generateQRCodeHandler: Missing URL")
-		return
+	if recovery := eccRecovery[qr.Level]; coverage > recovery {
+		return fmt.Errorf("%w: logo covers %.1f%% of the code but level %s recovers at most %.0f%%",
+			errLogoTooLarge, coverage*100, eccLevelName(qr.Level), recovery*100)
 	}
+	return nil
+}
 
-	// Check if an image file was uploaded
-	file, _, err := r.FormFile("image")
-
-	// Handle errors except for missing file (handled separately)
-	if err != nil && err != http.ErrMissingFile {
-		http.Error(w, "Error reading image", http.StatusInternalServerError)
-		log.Printf("generateQRCodeHandler: Error reading image - %v", err)
-		return
-	}
-	// Extract size string from the request form
-	sizeStr := r.FormValue("size")
-	// Validate the presence of size parameter
-	if sizeStr == "" {
-		http.Error(w, "Missing size", http.StatusBadRequest)
-		log.Printf("generateQRCodeHandler: Missing size")
-		return
+// Generate a QR code from the given data string using the requested options.
+// logoPercent is the fraction of the image width covered by a logo, or 0 when there is none.
+func generateQRCode(data string, opts qrOptions, logoPercent float64) (*qrcode.QRCode, error) {
+	// Create a new QR code instance with the given data and the resolved error correction level.
+	qr, err := qrcode.New(data, resolveECCLevel(opts.ECC, logoPercent > 0))
+	if err != nil {
+		// If there's an error creating the QR code, return it immediately.
+		return nil, err
 	}
 
-	// Convert size string to integer and validate it against allowed sizes
-	size, err := strconv.Atoi(sizeStr)
-	if err != nil || !isValidQRCodeSize(size) {
-		http.Error(w, "Invalid size", http.StatusBadRequest)
-		log.Printf("generateQRCodeHandler: Invalid size - %v", err)
-		return
+	// Reject logos that would make the code unreadable at this error correction level.
+	if err := checkLogoCoverage(qr, opts.Margin, logoPercent); err != nil {
+		return nil, err
 	}
 
-	// Extract logo width percentage string (optional)
-	logoWidthPercentStr := r.FormValue("logoWidthPercent")
-	// Extract logo opacity string (optional, defaults to 1 if missing)
-	logoOpacityStr := r.FormValue("logoOpacity")
-
-	logoWidthPercent, err := strconv.ParseFloat(logoWidthPercentStr, 64)
-	if err != nil {
-		http.Error(w, "Invalid logo width percent", http.StatusBadRequest)
-		log.Printf("generateQRCodeHandler: Invalid logo width percent - %v", err)
-		return
-	}
+	return qr, nil
+}
 
-	// Parse logo opacity as float64 (handle potential parsing error with default value)
-	logoOpacity, err := strconv.ParseFloat(logoOpacityStr, 64)
-	if err != nil {
-		logoOpacity = 1 // Use default opacity of 1 if parsing fails
-	}
+// qrLogo is an image overlaid on the centre of a QR code.
+type qrLogo struct {
+	Image   image.Image
+	Percent float64 // Maximum fraction of the QR code width and height occupied by the logo
+	Opacity float64 // Logo opacity between 0 and 1
+}
 
-	// Generate the QR code for the provided URL with the requested size
-	qrCode, err := generateQRCode(url, size)
-	if err != nil {
-		http.Error(w, "Failed to generate QR code", http.StatusInternalServerError)
-		log.Printf("generateQRCodeHandler: Failed to generate QR code - %v", err)
-		return
-	}
-	// If an image file was uploaded, process it
-	if file != nil {
-		// Decode the uploaded image
-		overlayImage, err := decodeImage(file)
+// renderQRCode encodes a QR code with an optional logo in the requested output format,
+// returning the encoded bytes and their content type.
+func renderQRCode(qr *qrcode.QRCode, opts qrOptions, logo *qrLogo) ([]byte, string, error) {
+	switch opts.Format {
+	case FormatSVG:
+		// Draw the modules as vector paths and embed the logo as an image element.
+		data, err := renderSVG(qr, opts, logo)
 		if err != nil {
-			http.Error(w, "Failed to decode image", http.StatusInternalServerError)
-			log.Printf("generateQRCodeHandler: Failed to decode image - %v", err)
-			return
+			return nil, "", err
 		}
-
-		// Overlay the uploaded image onto the QR code with specified width percentage and opacity
-		qrCode, err = overlayImageOnQRCodeWithOpacity(qrCode, overlayImage, logoWidthPercent, logoOpacity)
+		return data, "image/svg+xml", nil
+	case FormatPDF:
+		// Lay out the code on a physically sized page with optional bleed and crop marks.
+		data, err := renderPDF(qr, opts, logo)
 		if err != nil {
-			http.Error(w, "Failed to overlay image on QR code", http.StatusInternalServerError)
-			log.Printf("generateQRCodeHandler: Failed to overlay image on QR code - %v", err)
-			return
+			return nil, "", err
+		}
+		return data, "application/pdf", nil
+	}
+
+	// Rasterize the QR code with the requested size and colours. Styled modules are drawn
+	// from their outlines, while plain ones keep the library's pixel-exact rendering.
+	var img image.Image
+	if opts.Style.isPlain(opts.Foreground) {
+		bitmap := qrBitmap(qr, opts.Margin)
+		if opts.ModuleSize > 0 {
+			img = moduleImage(bitmap, opts.ModuleSize, opts.Foreground, opts.Background)
+		} else {
+			img = scaledModuleImage(bitmap, opts.pixelSize(len(bitmap)), opts.Foreground, opts.Background)
+		}
+	} else {
+		layers, modules := qrLayers(qr, opts)
+		img = rasterizeQRCode(layers, modules, opts.pixelSize(modules), opts.Background)
+	}
+
+	// Overlay the logo, applying its opacity only when it is partially transparent.
+	if logo != nil {
+		var err error
+		if logo.Opacity < 1 {
+			img, err = overlayImageOnQRCodeWithOpacity(img, logo.Image, logo.Percent, logo.Opacity)
+		} else {
+			img, err = overlayImageOnQRCode(img, logo.Image, logo.Percent)
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to overlay logo: %w", err)
 		}
 	}
 
-	// Set the content type header to indicate PNG image data
-	w.Header().Set("Content-Type", "image/png")
-
-	// Encode the QR code image as PNG format and write it to the HTTP response writer
-	err = png.Encode(w, qrCode)
-	if err != nil {
-		log.Printf("generateQRCodeHandler: Failed to encode QR code as PNG - %v", err)
-	}
-}
-
-func generateFacebookQRCodeHandler(w http.ResponseWriter, r *http.Request) {
-	// Check if the request method is POST, otherwise return an error
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		log.Printf("generateFacebookQRCodeHandler: Method not allowed")
-		return
-	}
-	// Extract Facebook username from the request form
-	username := r.FormValue("username")
-
-	// Validate the presence of username
-	if username == "" {
-		http.Error(w, "Missing username", http.StatusBadRequest)
-		log.Printf("generateFacebookQRCodeHandler: Missing username")
-		return
-	}
-
-	// Extract size string from the request form
-	sizeStr := r.FormValue("size")
-
-	// Validate the presence of size parameter
-	if sizeStr == "" {
-		http.Error(w, "Missing size", http.StatusBadRequest)
-		log.Printf("generateFacebookQRCodeHandler: Missing size")
-		return
-	}
-
-	// Convert size string to integer and validate it against allowed sizes
-	size, err := strconv.Atoi(sizeStr)
-	if err != nil || !isValidQRCodeSize(size) {
-		http.Error(w, "Invalid size", http.StatusBadRequest)
-		log.Printf("generateFacebookQRCodeHandler: Invalid size - %v", err)
-		return
-	}
-
-	// Construct the Facebook profile URL using the extracted username
-	url := "https://www.facebook.com/" + username
-
-	// Generate the QR code for the Facebook profile URL with the requested size
-	qrCode, err := generateQRCode(url, size)
-	if err != nil {
-		http.Error(w, "Failed to generate QR code", http.StatusInternalServerError)
-		log.Printf("generateFacebookQRCodeHandler: Failed to generate QR code - %v", err)
-		return
-	}
-
-	// Open the Facebook logo image file
-	facebookLogoFile, err := http.Dir(".").Open(FacebookLogoPath)
-	if err != nil {
-		http.Error(w, "Failed to open Facebook logo: file not found or cannot be opened", http.StatusInternalServerError)
-		log.Printf("generateFacebookQRCodeHandler: Failed to open Facebook logo - %v", err)
-		return
-	}
-	defer facebookLogoFile.Close() // Close the file after processing
-
-	// Decode the Facebook logo image
-	facebookLogo, err := decodeImage(facebookLogoFile)
-	if err != nil {
-		http.Error(w, "Failed to decode Facebook logo", http.StatusInternalServerError)
-		log.Printf("generateFacebookQRCodeHandler: Failed to decode Facebook logo - %v", err)
-		return
-	}
-
-	// Overlay the Facebook logo onto the QR code with a specific logo size percentage
-	qrCode, err = overlayImageOnQRCode(qrCode, facebookLogo, LogoPercent)
-	if err != nil {
-		http.Error(w, "Failed to overlay Facebook logo on QR code", http.StatusInternalServerError)
-		log.Printf("generateFacebookQRCodeHandler: Failed to overlay Facebook logo on QR code - %v", err)
-		return
+	// Place the code in its frame, drawing the caption.
+	if opts.Frame.enabled() {
+		img = drawFrame(img, len(qrBitmap(qr, opts.Margin)), opts)
 	}
 
-	// Set the content type header to indicate PNG image data
-	w.Header().Set("Content-Type", "image/png")
-
-	// Encode the QR code image as PNG format and write it to the HTTP response writer
-	err = png.Encode(w, qrCode)
-	if err != nil {
-		log.Printf("generateFacebookQRCodeHandler: Failed to encode QR code as PNG - %v", err)
+	// Encode the QR code image as PNG format.
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, "", fmt.Errorf("failed to encode QR code as PNG: %w", err)
 	}
+	return buf.Bytes(), "image/png", nil
 }
 
-func generateTikTokQRCodeHandler(w http.ResponseWriter, r *http.Request) {
-	// Check if the request method is POST, otherwise return an error
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		log.Printf("generateTikTokQRCodeHandler: Method not allowed")
-		return
-	}
-
-	// Extract TikTok username from the request form
-	username := r.FormValue("username")
-
-	// Validate the presence of username
-	if username == "" {
-		http.Error(w, "Missing username", http.StatusBadRequest)
-		log.Printf("generateTikTokQRCodeHandler: Missing username")
-		return
-	}
-
-	// Extract size string from the request form
-	sizeStr := r.FormValue("size")
-
-	// Validate the presence of size parameter
-	if sizeStr == "" {
-		http.Error(w, "Missing size", http.StatusBadRequest)
-		log.Printf("generateTikTokQRCodeHandler: Missing size")
-		return
-	}
-
-	// Convert size string to integer and validate it against allowed sizes
-	size, err := strconv.Atoi(sizeStr)
-	if err != nil || !isValidQRCodeSize(size) {
-		http.Error(w, "Invalid size", http.StatusBadRequest)
-		log.Printf("generateTikTokQRCodeHandler: Invalid size - %v", err)
-		return
-	}
-
-	// Construct the TikTok profile URL using the extracted username
-	url := "https://www.tiktok.com/@" + username
-
-	// Generate the QR code for the TikTok profile URL with the requested size
-	qrCode, err := generateQRCode(url, size)
-	if err != nil {
-		http.Error(w, "Failed to generate QR code", http.StatusInternalServerError)
-		log.Printf("generateTikTokQRCodeHandler: Failed to generate QR code - %v", err)
-		return
-	}
-
-	// Open the TikTok logo image file
-	tiktokLogoFile, err := http.Dir(".").Open(TikTokLogoPath)
-	if err != nil {
-		http.Error(w, "Failed to open TikTok logo: file not found or cannot be opened", http.StatusInternalServerError)
-		log.Printf("generateTikTokQRCodeHandler: Failed to open TikTok logo - %v", err)
-		return
-	}
-	defer tiktokLogoFile.Close() // Close the file after processing
-
-	// Decode the TikTok logo image
-	tiktokLogo, err := decodeImage(tiktokLogoFile)
-	if err != nil {
-		http.Error(w, "Failed to decode TikTok logo", http.StatusInternalServerError)
-		log.Printf("generateTikTokQRCodeHandler: Failed to decode TikTok logo - %v", err)
-		return
+// pixelSize returns the width and height in pixels of the image of a symbol that is
+// modules wide, margin included. With a module size every module covers exactly
+// that many pixels; otherwise the image never has less than one pixel per module.
+func (o qrOptions) pixelSize(modules int) int {
+	if o.ModuleSize > 0 {
+		return modules * o.ModuleSize
 	}
-
-	// Overlay the TikTok logo onto the QR code with a specific logo size percentage
-	qrCode, err = overlayImageOnQRCode(qrCode, tiktokLogo, LogoPercent)
-	if err != nil {
-		http.Error(w, "Failed to overlay TikTok logo on QR code", http.StatusInternalServerError)
-		log.Printf("generateTikTokQRCodeHandler: Failed to overlay TikTok logo on QR code - %v", err)
-		return
-	}
-
-	// Set the content type header to indicate PNG image data
-	w.Header().Set("Content-Type", "image/png")
-
-	// Encode the QR code image as PNG format and write it to the HTTP response writer
-	err = png.Encode(w, qrCode)
-	if err != nil {
-		log.Printf("generateTikTokQRCodeHandler: Failed to encode QR code as PNG - %v", err)
+	if o.Size < modules {
+		return modules
 	}
+	return o.Size
 }
 
-func generateInstagramQRCodeHandler(w http.ResponseWriter, r *http.Request) {
-	// Check if the request method is POST, otherwise return an error
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-	// Extract Instagram username from the request form
-	username := r.FormValue("username")
-
-	// Validate the presence of username
-	if username == "" {
-		http.Error(w, "Missing username", http.StatusBadRequest)
-		log.Printf("generateInstagramQRCodeHandler: Missing username")
-		return
-	}
-
-	// Extract size string from the request form
-	sizeStr := r.FormValue("size")
-
-	// Validate the presence of size parameter
-	if sizeStr == "" {
-		http.Error(w, "Missing size", http.StatusBadRequest)
-		log.Printf("generateInstagramQRCodeHandler: Missing size")
-		return
-	}
-
-	// Convert size string to integer and validate it against allowed sizes
-	size, err := strconv.Atoi(sizeStr)
-	if err != nil || !isValidQRCodeSize(size) {
-		http.Error(w, "Invalid size", http.StatusBadRequest)
-		log.Printf("generateInstagramQRCodeHandler: Invalid size - %v", err)
-		return
-	}
-
-	// Construct the Instagram profile URL using the extracted username
-	url := "https://www.instagram.com/" + username
-
-	// Generate the QR code for the Instagram profile URL with the requested size
-	qrCode, err := generateQRCode(url, size)
-	if err != nil {
-		http.Error(w, "Failed to generate QR code", http.StatusInternalServerError)
-		log.Printf("generateInstagramQRCodeHandler: Failed to generate QR code - %v", err)
-		return
-	}
-
-	// Open the Instagram logo image file
-	instagramLogoFile, err := http.Dir(".").Open(InstagramLogoPath)
-	if err != nil {
-		http.Error(w, "Failed to open Instagram logo: file not found or cannot be opened", http.StatusInternalServerError)
-		log.Printf("generateInstagramQRCodeHandler: Failed to open Instagram logo - %v", err)
-		return
-	}
-	defer instagramLogoFile.Close() // Close the file after processing
-
-	// Decode the Instagram logo image
-	instagramLogo, err := decodeImage(instagramLogoFile)
-	if err != nil {
-		http.Error(w, "Failed to decode Instagram logo", http.StatusInternalServerError)
-		log.Printf("generateInstagramQRCodeHandler: Failed to decode Instagram logo - %v", err)
-		return
-	}
-
-	// Overlay the Instagram logo onto the QR code with a specific logo size percentage
-	qrCode, err = overlayImageOnQRCode(qrCode, instagramLogo, LogoPercent)
-	if err != nil {
-		http.Error(w, "Failed to overlay Instagram logo on QR code", http.StatusInternalServerError)
-		log.Printf("generateInstagramQRCodeHandler: Failed to overlay Instagram logo on QR code - %v", err)
-		return
-	}
-
-	// Set the content type header to indicate PNG image data
-	w.Header().Set("Content-Type", "image/png")
-
-	// Encode the QR code image as PNG format and write it to the HTTP response writer
-	err = png.Encode(w, qrCode)
-	if err != nil {
-		log.Printf("generateInstagramQRCodeHandler: Failed to encode QR code as PNG - %v", err)
+// warnings lists accepted options that may make the code harder to scan.
+func (o qrOptions) warnings() []string {
+	var warnings []string
+	if o.Margin < QuietZone {
+		warnings = append(warnings, fmt.Sprintf("Margin of %d is below the %d-module quiet zone required by the QR code specification; some scanners may not read the code", o.Margin, QuietZone))
 	}
+	return warnings
 }
 
-func generateVCardQRCodeHandler(w http.ResponseWriter, r *http.Request) {
-	// Check if the request method is POST, otherwise return an error
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	// Extract contact information from the request form
-	firstName := r.FormValue("firstName")
-	lastName := r.FormValue("lastName")
-	title := r.FormValue("title")
-	phone := r.FormValue("phone")
-	mobile := r.FormValue("mobile")
-	email := r.FormValue("email")
-	address := r.FormValue("address")
-	company := r.FormValue("company")
-	url := r.FormValue("url")
-	role := r.FormValue("role")
-	lang := r.FormValue("lang")
-	geo := r.FormValue("geo")
-
-	// Generate a VCARD string representation of the contact information
-	vCard := generateVCardString(firstName, lastName, title, phone, mobile, email, address, company, url, role, lang, geo)
-
-	// Extract size string from the request form
-	sizeStr := r.FormValue("size")
-
-	// Validate the presence of size parameter
-	if sizeStr == "" {
-		http.Error(w, "Missing size", http.StatusBadRequest)
-		log.Printf("generateVCardQRCodeHandler: Missing size")
-		return
-	}
-
-	// Convert size string to integer and validate it against allowed sizes
-	size, err := strconv.Atoi(sizeStr)
-	if err != nil || !isValidQRCodeSize(size) {
-		http.Error(w, "Invalid size", http.StatusBadRequest)
-		log.Printf("generateVCardQRCodeHandler: Invalid size - %v", err)
-		return
-	}
-
-	// Extract logo width percentage and opacity (optional) from the request form
-	logoWidthPercentStr := r.FormValue("logoWidthPercent")
-	logoOpacityStr := r.FormValue("logoOpacity")
-
-	// Parse logo width percentage as float64
-	logoWidthPercent, err := strconv.ParseFloat(logoWidthPercentStr, 64)
-	if err != nil {
-		http.Error(w, "Invalid logo width percent", http.StatusBadRequest)
-		log.Printf("generateVCardQRCodeHandler: Invalid logo width percent - %v", err)
-		return
-	}
-
-	// Parse logo opacity as float64 (handle potential parsing error with default value)
-	logoOpacity, err := strconv.ParseFloat(logoOpacityStr, 64)
-	if err != nil {
-		logoOpacity = 1 // Use default opacity of 1 if parsing fails
-	}
-
-	// Generate the QR code for the VCARD data with the requested size
-	qrCode, err := generateQRCode(vCard, size)
-	if err != nil {
-		http.Error(w, "Failed to generate QR code", http.StatusInternalServerError)
-		log.Printf("generateVCardQRCodeHandler: Failed to generate QR code - %v", err)
-		return
-	}
-
-	// Extract uploaded image file (optional)
-	file, _, err := r.FormFile("image")
-
-	// Handle errors except for missing file (handled separately)
-	if err != nil && err != http.ErrMissingFile {
-		http.Error(w, "Error reading image", http.StatusInternalServerError)
-		log.Printf("generateVCardQRCodeHandler: Error reading image - %v", err)
-		return
-	}
-
-	// If an image file was uploaded, process it
-	if file != nil {
-		// Decode the uploaded image
-		overlayImage, err := decodeImage(file)
-		if err != nil {
-			http.Error(w, "Failed to decode image", http.StatusInternalServerError)
-			log.Printf("generateVCardQRCodeHandler: Failed to decode image - %v", err)
-			return
-		}
-
-		// Overlay the uploaded image onto the QR code with specified width percentage and opacity
-		qrCode, err = overlayImageOnQRCodeWithOpacity(qrCode, overlayImage, logoWidthPercent, logoOpacity)
-		if err != nil {
-			http.Error(w, "Failed to overlay image on QR code", http.StatusInternalServerError)
-			log.Printf("generateVCardQRCodeHandler: Failed to overlay image on QR code - %v", err)
-			return
+// qrBitmap returns the modules of a QR code surrounded by a quiet zone of margin light
+// modules, replacing the library's fixed quiet zone.
+func qrBitmap(qr *qrcode.QRCode, margin int) [][]bool {
+	bitmap := qr.Bitmap()
+	border := 0
+	if !qr.DisableBorder {
+		border = QuietZone
+	}
+	symbol := len(bitmap) - 2*border
+	size := symbol + 2*margin
+
+	result := make([][]bool, size)
+	for y := range result {
+		result[y] = make([]bool, size)
+		if y >= margin && y < margin+symbol {
+			copy(result[y][margin:], bitmap[y-margin+border][border:border+symbol])
 		}
 	}
+	return result
+}
 
-	// Set the content type header to indicate PNG image data
-	w.Header().Set("Content-Type", "image/png")
-
-	// Encode the QR code image as PNG format and write it to the HTTP response writer
-	err = png.Encode(w, qrCode)
-	if err != nil {
-		log.Printf("generateVCardQRCodeHandler: Failed to encode QR code as PNG - %v", err)
+// scaledModuleImage draws a plain QR code bitmap into a size x size image, mapping each
+// pixel to the nearest module as the library's own renderer does.
+func scaledModuleImage(bitmap [][]bool, size int, fg, bg color.NRGBA) *image.Paletted {
+	img := image.NewPaletted(image.Rect(0, 0, size, size), color.Palette{bg, fg})
+	modulesPerPixel := float64(len(bitmap)) / float64(size)
+	for y := 0; y < size; y++ {
+		row := bitmap[int(float64(y)*modulesPerPixel)]
+		for x := 0; x < size; x++ {
+			if row[int(float64(x)*modulesPerPixel)] {
+				img.Pix[img.PixOffset(x, y)] = 1
+			}
+		}
 	}
+	return img
 }
 
-// Generate a QR code image from the given data string, with a specified size.
-func generateQRCode(data string, size int) (image.Image, error) {
-	// Create a new QR code instance with the given data and high error correction level.
-	qr, err := qrcode.New(data, qrcode.High)
-	if err != nil {
-		// If there's an error creating the QR code, return it immediately.
-		return nil, err
+// moduleImage draws a plain QR code bitmap with every module exactly moduleSize pixels
+// wide, avoiding the uneven module widths of scaling to an arbitrary size.
+func moduleImage(bitmap [][]bool, moduleSize int, fg, bg color.NRGBA) *image.Paletted {
+	size := len(bitmap) * moduleSize
+	img := image.NewPaletted(image.Rect(0, 0, size, size), color.Palette{bg, fg})
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if !dark {
+				continue
+			}
+			for py := y * moduleSize; py < (y+1)*moduleSize; py++ {
+				offset := img.PixOffset(x*moduleSize, py)
+				for i := 0; i < moduleSize; i++ {
+					img.Pix[offset+i] = 1
+				}
+			}
+		}
 	}
-	// Return the generated QR code image with the specified size.
-	return qr.Image(size), nil
+	return img
 }
 
 // Decode an image from a file reader, returning the image and any error.
@@ -930,6 +504,15 @@ func decodeImage(file io.Reader) (image.Image, error) {
 		return nil, fmt.Errorf("failed to read image data: %w", err)
 	}
 
+	// Check the declared dimensions before decoding the pixels.
+	config, _, err := image.DecodeConfig(bytes.NewReader(imgData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	if config.Width > MaxImageDimension || config.Height > MaxImageDimension {
+		return nil, fmt.Errorf("image is %dx%d pixels, larger than the maximum of %dx%d", config.Width, config.Height, MaxImageDimension, MaxImageDimension)
+	}
+
 	// Attempt to decode the image using the standard image.Decode function.
 	img, format, err := image.Decode(bytes.NewReader(imgData))
 	if err != nil {
@@ -945,6 +528,9 @@ func decodeImage(file io.Reader) (image.Image, error) {
 	case "png":
 		// Decode PNG images using the png package.
 		img, err = png.Decode(bytes.NewReader(imgData))
+	case "gif", "bmp", "webp", "tiff":
+		// Screenshots and scans come in other formats too; the image decoded above is used
+		// as is. Animated GIFs yield their first frame.
 	default:
 		// Handle unsupported image formats
 		return nil, fmt.Errorf("unsupported image format: %s", format)
@@ -989,867 +575,6 @@ func overlayImageOnQRCode(qrCode image.Image, overlay image.Image, overlayPercen
 	return m, nil
 }
 
-// Generate a vCard string from the given information.
-func generateVCardString(firstName, lastName, title, phone, mobile, email, address, company, url, role, lang, geo string) string {
-	// Create a string builder to efficiently build the vCard string.
-	var sb strings.Builder
-	sb.WriteString("BEGIN:VCARD\n")
-	sb.WriteString("VERSION:3.0\n")
-
-	// Add the formatted name (Last Name, First Name).
-	sb.WriteString(fmt.Sprintf("N:%s;%s;;;\n", lastName, firstName))
-
-	// Add the full name (First Name Last Name).
-	sb.WriteString(fmt.Sprintf("FN:%s %s\n", firstName, lastName))
-
-	// Add the company name if provided.
-	if company != "" {
-		sb.WriteString(fmt.Sprintf("ORG:%s\n", company))
-	}
-
-	// Add the title.
-	sb.WriteString(fmt.Sprintf("TITLE:%s\n", title))
-
-	// Add the work phone number.
-	sb.WriteString(fmt.Sprintf("TEL;TYPE=WORK,VOICE:%s\n", phone))
-
-	// Add the mobile phone number if provided.
-	if mobile != "" {
-		sb.WriteString(fmt.Sprintf("TEL;TYPE=CELL,VOICE:%s\n", mobile))
-	}
-
-	// Add the email address.
-	sb.WriteString(fmt.Sprintf("EMAIL:%s\n", email))
-
-	// Add the address.
-	sb.WriteString(fmt.Sprintf("ADR:%s\n", address))
-
-	// Add the URL if provided.
-	if url != "" {
-		sb.WriteString(fmt.Sprintf("URL:%s\n", url))
-	}
-
-	// Add the role if provided.
-	if role != "" {
-		sb.WriteString(fmt.Sprintf("ROLE:%s\n", role))
-	}
-
-	// Add the language if provided.
-	if lang != "" {
-		sb.WriteString(fmt.Sprintf("LANG:%s\n", lang))
-	}
-
-	// Add the geographical position if provided.
-	if geo != "" {
-		sb.WriteString(fmt.Sprintf("GEO:%s\n", geo))
-	}
-
-	// End the vCard.
-	sb.WriteString("END:VCARD")
-	return sb.String()
-}
-
-func generateEventQRCodeHandler(w http.ResponseWriter, r *http.Request) {
-	// Check for allowed method (POST only)
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		log.Printf("generateEventQRCodeHandler: Method not allowed")
-		return
-	}
-
-	// Extract event details from request form
-	eventName := r.FormValue("eventName")
-	startDateTime := r.FormValue("startDateTime")
-	endDateTime := r.FormValue("endDateTime")
-	location := r.FormValue("location")
-	description := r.FormValue("description")
-
-	// Validate presence of required event details
-	if eventName == "" || startDateTime == "" || endDateTime == "" {
-		http.Error(w, "Missing event details", http.StatusBadRequest)
-		log.Printf("generateEventQRCodeHandler: Missing event details")
-		return
-	}
-
-	// Extract and validate QR code size
-	sizeStr := r.FormValue("size")
-	if sizeStr == "" {
-		http.Error(w, "Missing size", http.StatusBadRequest)
-		log.Printf("generateEventQRCodeHandler: Missing size")
-		return
-	}
-	size, err := strconv.Atoi(sizeStr)
-	if err != nil || !isValidQRCodeSize(size) {
-		http.Error(w, "Invalid size", http.StatusBadRequest)
-		log.Printf("generateEventQRCodeHandler: Invalid size - %v", err)
-		return
-	}
-
-	// Generate ICS string for event data
-	icsString := fmt.Sprintf("BEGIN:VEVENT\nSUMMARY:%s\nDTSTART:%s\nDTEND:%s\nLOCATION:%s\nDESCRIPTION:%s\nEND:VEVENT",
-		eventName, startDateTime, endDateTime, location, description)
-
-	// Generate QR code from ICS string
-	qrCode, err := generateQRCode(icsString, size)
-	if err != nil {
-		http.Error(w, "Failed to generate QR code", http.StatusInternalServerError)
-		log.Printf("generateEventQRCodeHandler: Failed to generate QR code - %v", err)
-		return
-	}
-
-	// Open event logo file
-	eventLogoFile, err := http.Dir(".").Open(EventLogoPath)
-	if err != nil {
-		http.Error(w, "Failed to open event logo: file not found or cannot be opened", http.StatusInternalServerError)
-		log.Printf("generateEventQRCodeHandler: Failed to open event logo - %v", err)
-		return
-	}
-	defer eventLogoFile.Close()
-
-	// Decode event logo image
-	eventLogo, err := decodeImage(eventLogoFile)
-	if err != nil {
-		http.Error(w, "Failed to decode event logo", http.StatusInternalServerError)
-		log.Printf("generateEventQRCodeHandler: Failed to decode event logo - %v", err)
-		return
-	}
-
-	// Overlay event logo on QR code
-	qrCode, err = overlayImageOnQRCode(qrCode, eventLogo, LogoPercent)
-	if err != nil {
-		http.Error(w, "Failed to overlay event logo on QR code", http.StatusInternalServerError)
-		log.Printf("generateEventQRCodeHandler: Failed to overlay event logo on QR code - %v", err)
-		return
-	}
-
-	// Set content type for QR code image
-	w.Header().Set("Content-Type", "image/png")
-
-	// Encode QR code as PNG and write to response
-	err = png.Encode(w, qrCode)
-	if err != nil {
-		log.Printf("generateEventQRCodeHandler: Failed to encode QR code as PNG - %v", err)
-	}
-}
-
-// Generate a PayPal QrCode from the given information.
-func generatePayPalQRCodeHandler(w http.ResponseWriter, r *http.Request) {
-	// Check for allowed method (POST only)
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		log.Printf("generatePayPalQRCodeHandler: Method not allowed")
-		return
-	}
-
-	// Extract payment details from request form
-	email := r.FormValue("email")
-	amount := r.FormValue("amount")
-	currency := r.FormValue("currency")
-	description := r.FormValue("description")
-
-	// Validate presence of required payment details
-	if email == "" || amount == "" || currency == "" {
-		http.Error(w, "Missing payment details", http.StatusBadRequest)
-		log.Printf("generatePayPalQRCodeHandler: Missing payment details")
-		return
-	}
-
-	// Extract and validate QR code size
-	sizeStr := r.FormValue("size")
-	if sizeStr == "" {
-		http.Error(w, "Missing size", http.StatusBadRequest)
-		log.Printf("generatePayPalQRCodeHandler: Missing size")
-		return
-	}
-	size, err := strconv.Atoi(sizeStr)
-	if err != nil || !isValidQRCodeSize(size) {
-		http.Error(w, "Invalid size", http.StatusBadRequest)
-		log.Printf("generatePayPalQRCodeHandler: Invalid size - %v", err)
-		return
-	}
-
-	// Generate PayPal payment URL
-	paypalURL := fmt.Sprintf("https://www.paypal.com/cgi-bin/webscr?cmd=_xclick&business=%s&amount=%s&currency_code=%s&item_name=%s",
-		email, amount, currency, description)
-
-	// Generate QR code from PayPal URL
-	qrCode, err := generateQRCode(paypalURL, size)
-	if err != nil {
-		http.Error(w, "Failed to generate QR code", http.StatusInternalServerError)
-		log.Printf("generatePayPalQRCodeHandler: Failed to generate QR code - %v", err)
-		return
-	}
-
-	// Open PayPal logo file
-	paypalLogoFile, err := http.Dir(".").Open(PayPalLogoPath)
-	if err != nil {
-		http.Error(w, "Failed to open PayPal logo: file not found or cannot be opened", http.StatusInternalServerError)
-		log.Printf("generatePayPalQRCodeHandler: Failed to open PayPal logo - %v", err)
-		return
-	}
-	defer paypalLogoFile.Close()
-
-	// Decode PayPal logo image
-	paypalLogo, err := decodeImage(paypalLogoFile)
-	if err != nil {
-		http.Error(w, "Failed to decode PayPal logo", http.StatusInternalServerError)
-		log.Printf("generatePayPalQRCodeHandler: Failed to decode PayPal logo - %v", err)
-		return
-	}
-
-	// Overlay PayPal logo on QR code
-	qrCode, err = overlayImageOnQRCode(qrCode, paypalLogo, LogoPercent)
-	if err != nil {
-		http.Error(w, "Failed to overlay PayPal logo on QR code", http.StatusInternalServerError)
-		log.Printf("generatePayPalQRCodeHandler: Failed to overlay PayPal logo on QR code - %v", err)
-		return
-	}
-
-	// Set content type for QR code image
-	w.Header().Set("Content-Type", "image/png")
-
-	// Encode QR code as PNG and write to response
-	err = png.Encode(w, qrCode)
-	if err != nil {
-		log.Printf("generatePayPalQRCodeHandler: Failed to encode QR code as PNG - %v", err)
-	}
-}
-
-// Generates a QR code for opening a WhatsApp chat with a phone number and optional message.
-
-func generateWhatsAppQRCodeHandler(w http.ResponseWriter, r *http.Request) {
-	// Check for allowed method (POST only)
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		log.Printf("generateWhatsAppQRCodeHandler: Method not allowed")
-		return
-	}
-
-	// Extract phone number and message from request form
-	phone := r.FormValue("phone")
-	message := r.FormValue("message")
-
-	// Validate presence of phone number
-	if phone == "" {
-		http.Error(w, "Missing phone number", http.StatusBadRequest)
-		log.Printf("generateWhatsAppQRCodeHandler: Missing phone number")
-		return
-	}
-
-	// Extract and validate QR code size
-	sizeStr := r.FormValue("size")
-	if sizeStr == "" {
-		http.Error(w, "Missing size", http.StatusBadRequest)
-		log.Printf("generateWhatsAppQRCodeHandler: Missing size")
-		return
-	}
-	size, err := strconv.Atoi(sizeStr)
-	if err != nil || !isValidQRCodeSize(size) {
-		http.Error(w, "Invalid size", http.StatusBadRequest)
-		log.Printf("generateWhatsAppQRCodeHandler: Invalid size - %v", err)
-		return
-	}
-
-	// Generate WhatsApp URL with phone number and message
-	whatsappURL := fmt.Sprintf("https://wa.me/%s?text=%s", phone, message)
-
-	// Generate QR code from WhatsApp URL
-	qrCode, err := generateQRCode(whatsappURL, size)
-	if err != nil {
-		http.Error(w, "Failed to generate QR code", http.StatusInternalServerError)
-		log.Printf("generateWhatsAppQRCodeHandler: Failed to generate QR code - %v", err)
-		return
-	}
-
-	// Open WhatsApp logo file
-	whatsappLogoFile, err := http.Dir(".").Open(WhatsAppLogoPath)
-	if err != nil {
-		http.Error(w, "Failed to open WhatsApp logo: file not found or cannot be opened", http.StatusInternalServerError)
-		log.Printf("generateWhatsAppQRCodeHandler: Failed to open WhatsApp logo - %v", err)
-		return
-	}
-	defer whatsappLogoFile.Close()
-
-	// Decode WhatsApp logo image
-	whatsappLogo, err := decodeImage(whatsappLogoFile)
-	if err != nil {
-		http.Error(w, "Failed to decode WhatsApp logo", http.StatusInternalServerError)
-		log.Printf("generateWhatsAppQRCodeHandler: Failed to decode WhatsApp logo - %v", err)
-		return
-	}
-
-	// Overlay WhatsApp logo on QR code
-	qrCode, err = overlayImageOnQRCode(qrCode, whatsappLogo, LogoPercent)
-	if err != nil {
-		http.Error(w, "Failed to overlay WhatsApp logo on QR code", http.StatusInternalServerError)
-		log.Printf("generateWhatsAppQRCodeHandler: Failed to overlay WhatsApp logo on QR code - %v", err)
-		return
-	}
-
-	// Set content type for QR code image
-	w.Header().Set("Content-Type", "image/png")
-
-	// Encode QR code as PNG and write to response
-	err = png.Encode(w, qrCode)
-	if err != nil {
-		log.Printf("generateWhatsAppQRCodeHandler: Failed to encode QR code as PNG - %v", err)
-	}
-}
-
-// Generates a QR code for X based on a username.
-func generateXQRCodeHandler(w http.ResponseWriter, r *http.Request) {
-	// Check for allowed method (POST only)
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		log.Printf("generateXQRCodeHandler: Method not allowed")
-		return
-	}
-
-	// Extract username from request form
-	username := r.FormValue("username")
-
-	// Validate presence of username
-	if username == "" {
-		http.Error(w, "Missing username", http.StatusBadRequest)
-		log.Printf("generateXQRCodeHandler: Missing username")
-		return
-	}
-
-	// Extract and validate QR code size
-	sizeStr := r.FormValue("size")
-	if sizeStr == "" {
-		http.Error(w, "Missing size", http.StatusBadRequest)
-		log.Printf("generateXQRCodeHandler: Missing size")
-		return
-	}
-	size, err := strconv.Atoi(sizeStr)
-	if err != nil || !isValidQRCodeSize(size) {
-		http.Error(w, "Invalid size", http.StatusBadRequest)
-		log.Printf("generateXQRCodeHandler: Invalid size - %v", err)
-		return
-	}
-
-	// Generate platform URL with username
-	url := "https://www.twitter.com/" + username
-
-	// Generate QR code from platform URL
-	qrCode, err := generateQRCode(url, size)
-	if err != nil {
-		http.Error(w, "Failed to generate QR code", http.StatusInternalServerError)
-		log.Printf("generateXQRCodeHandler: Failed to generate QR code - %v", err)
-		return
-	}
-
-	// Open platform logo file
-	xLogoFile, err := http.Dir(".").Open(XLogoPath)
-	if err != nil {
-		http.Error(w, "Failed to open X logo: file not found or cannot be opened", http.StatusInternalServerError)
-		log.Printf("generateXQRCodeHandler: Failed to open X logo - %v", err)
-		return
-	}
-	defer xLogoFile.Close()
-
-	// Decode platform logo image
-	xLogo, err := decodeImage(xLogoFile)
-	if err != nil {
-		http.Error(w, "Failed to decode X logo", http.StatusInternalServerError)
-		log.Printf("generateXQRCodeHandler: Failed to decode X logo - %v", err)
-		return
-	}
-
-	// Overlay platform logo on QR code
-	qrCode, err = overlayImageOnQRCode(qrCode, xLogo, LogoPercent)
-	if err != nil {
-		http.Error(w, "Failed to overlay X logo on QR code", http.StatusInternalServerError)
-		log.Printf("generateXQRCodeHandler: Failed to overlay X logo on QR code - %v", err)
-		return
-	}
-
-	// Set content type for QR code image
-	w.Header().Set("Content-Type", "image/png")
-
-	// Encode QR code as PNG and write to response
-	err = png.Encode(w, qrCode)
-	if err != nil {
-		log.Printf("generateXQRCodeHandler: Failed to encode QR code as PNG - %v", err)
-	}
-}
-
-// Generates a QR code for composing an email with a specific email address, subject, and body.
-func generateEmailQRCodeHandler(w http.ResponseWriter, r *http.Request) {
-	// Check for allowed method (POST only)
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		log.Printf("generateEmailQRCodeHandler: Method not allowed")
-		return
-	}
-
-	// Extract email address, subject, and body from request form
-	email := r.FormValue("email")
-	subject := r.FormValue("subject")
-	body := r.FormValue("body")
-
-	// Validate presence of email address
-	if email == "" {
-		http.Error(w, "Missing email", http.StatusBadRequest)
-		log.Printf("generateEmailQRCodeHandler: Missing email")
-		return
-	}
-
-	// Extract and validate QR code size
-	sizeStr := r.FormValue("size")
-	if sizeStr == "" {
-		http.Error(w, "Missing size", http.StatusBadRequest)
-		log.Printf("generateEmailQRCodeHandler: Missing size")
-		return
-	}
-	size, err := strconv.Atoi(sizeStr)
-	if err != nil || !isValidQRCodeSize(size) {
-		http.Error(w, "Invalid size", http.StatusBadRequest)
-		log.Printf("generateEmailQRCodeHandler: Invalid size - %v", err)
-		return
-	}
-
-	// Generatemailto URL with email address, subject, and body
-	mailtoURL := fmt.Sprintf("mailto:%s?subject=%s&body=%s", email, url.QueryEscape(subject), url.QueryEscape(body))
-
-	// Generate QR code from mailto URL
-	qrCode, err := generateQRCode(mailtoURL, size)
-	if err != nil {
-		http.Error(w, "Failed to generate QR code", http.StatusInternalServerError)
-		log.Printf("generateEmailQRCodeHandler: Failed to generate QR code - %v", err)
-		return
-	}
-
-	// Open email logo file
-	emailLogoFile, err := http.Dir(".").Open(EmailLogoPath)
-	if err != nil {
-		http.Error(w, "Failed to open email logo: file not found or cannot be opened", http.StatusInternalServerError)
-		log.Printf("generateEmailQRCodeHandler: Failed to open email logo - %v", err)
-		return
-	}
-	defer emailLogoFile.Close()
-
-	// Decode email logo image
-	emailLogo, err := decodeImage(emailLogoFile)
-	if err != nil {
-		http.Error(w, "Failed to decode email logo", http.StatusInternalServerError)
-		log.Printf("generateEmailQRCodeHandler: Failed to decode email logo - %v", err)
-		return
-	}
-
-	// Overlay email logo on QR code
-	qrCode, err = overlayImageOnQRCode(qrCode, emailLogo, LogoPercent)
-	if err != nil {
-		http.Error(w, "Failed to overlay email logo on QR code", http.StatusInternalServerError)
-		log.Printf("generateEmailQRCodeHandler: Failed to overlay email logo on QR code - %v", err)
-		return
-	}
-
-	// Set content type for QR code image
-	w.Header().Set("Content-Type", "image/png")
-
-	// Encode QR code as PNG and write to response
-	err = png.Encode(w, qrCode)
-	if err != nil {
-		log.Printf("generateEmailQRCodeHandler: Failed to encode QR code as PNG - %v", err)
-	}
-}
-
-// Generates a QR code for sending an SMS message to a phone number with an optional message.
-func generateSMSQRCodeHandler(w http.ResponseWriter, r *http.Request) {
-	// Check for allowed method (POST only)
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		log.Printf("generateSMSQRCodeHandler: Method not allowed")
-		return
-	}
-
-	// Extract phone number and message from request form
-	phoneNumber := r.FormValue("phoneNumber")
-	message := r.FormValue("message")
-
-	// Validate presence of phone number
-	if phoneNumber == "" {
-		http.Error(w, "Missing phone number", http.StatusBadRequest)
-		log.Printf("generateSMSQRCodeHandler: Missing phone number")
-		return
-	}
-
-	// Extract and validate QR code size
-	sizeStr := r.FormValue("size")
-	if sizeStr == "" {
-		http.Error(w, "Missing size", http.StatusBadRequest)
-		log.Printf("generateSMSQRCodeHandler: Missing size")
-		return
-	}
-	size, err := strconv.Atoi(sizeStr)
-	if err != nil || !isValidQRCodeSize(size) {
-		http.Error(w, "Invalid size", http.StatusBadRequest)
-		log.Printf("generateSMSQRCodeHandler: Invalid size - %v", err)
-		return
-	}
-
-	// Generate SMS URL with phone number and message
-	smsURL := fmt.Sprintf("sms:%s?body=%s", phoneNumber, message)
-
-	// Generate QR code from SMS URL
-	qrCode, err := generateQRCode(smsURL, size)
-	if err != nil {
-		http.Error(w, "Failed to generate QR code", http.StatusInternalServerError)
-		log.Printf("generateSMSQRCodeHandler: Failed to generate QR code - %v", err)
-		return
-	}
-
-	// Open SMS logo file
-	smsLogoFile, err := http.Dir(".").Open(SMSLogoPath)
-	if err != nil {
-		http.Error(w, "Failed to open SMS logo: file not found or cannot be opened", http.StatusInternalServerError)
-		log.Printf("generateSMSQRCodeHandler: Failed to open SMS logo - %v", err)
-		return
-	}
-	defer smsLogoFile.Close()
-
-	// Decode SMS logo image
-	smsLogo, err := decodeImage(smsLogoFile)
-	if err != nil {
-		http.Error(w, "Failed to decode SMS logo", http.StatusInternalServerError)
-		log.Printf("generateSMSQRCodeHandler: Failed to decode SMS logo - %v", err)
-		return
-	}
-
-	// Overlay SMS logo on QR code
-	qrCode, err = overlayImageOnQRCode(qrCode, smsLogo, LogoPercent)
-	if err != nil {
-		http.Error(w, "Failed to overlay SMS logo on QR code", http.StatusInternalServerError)
-		log.Printf("generateSMSQRCodeHandler: Failed to overlay SMS logo on QR code - %v", err)
-		return
-	}
-
-	// Set content type for QR code image
-	w.Header().Set("Content-Type", "image/png")
-
-	// Encode QR code as PNG and write to response
-	err = png.Encode(w, qrCode)
-	if err != nil {
-		log.Printf("generateSMSQRCodeHandler: Failed to encode QR code as PNG - %v", err)
-	}
-}
-
-// Generates a QR code for calling a phone number.
-func generatePhoneQRCodeHandler(w http.ResponseWriter, r *http.Request) {
-	// Check for allowed method (POST only)
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		log.Printf("generatePhoneQRCodeHandler: Method not allowed")
-		return
-	}
-
-	// Extract phone number from request form
-	phoneNumber := r.FormValue("phoneNumber")
-
-	// Validate presence of phone number
-	if phoneNumber == "" {
-		http.Error(w, "Missing phone number", http.StatusBadRequest)
-		log.Printf("generatePhoneQRCodeHandler: Missing phone number")
-		return
-	}
-
-	// Extract and validate QR code size
-	sizeStr := r.FormValue("size")
-	if sizeStr == "" {
-		http.Error(w, "Missing size", http.StatusBadRequest)
-		log.Printf("generatePhoneQRCodeHandler: Missing size")
-		return
-	}
-	size, err := strconv.Atoi(sizeStr)
-	if err != nil || !isValidQRCodeSize(size) {
-		http.Error(w, "Invalid size", http.StatusBadRequest)
-		log.Printf("generatePhoneQRCodeHandler: Invalid size - %v", err)
-		return
-	}
-
-	// Generate phone URL with phone number
-	phoneURL := fmt.Sprintf("tel:%s", phoneNumber)
-
-	// Generate QR code from phone URL
-	qrCode, err := generateQRCode(phoneURL, size)
-	if err != nil {
-		http.Error(w, "Failed to generate QR code", http.StatusInternalServerError)
-		log.Printf("generatePhoneQRCodeHandler: Failed to generate QR code - %v", err)
-		return
-	}
-
-	// Open phone logo file
-	phoneLogoFile, err := http.Dir(".").Open(PhoneLogoPath)
-	if err != nil {
-		http.Error(w, "Failed to open phone logo: file not found or cannot be opened", http.StatusInternalServerError)
-		log.Printf("generatePhoneQRCodeHandler: Failed to open phone logo - %v", err)
-		return
-	}
-	defer phoneLogoFile.Close()
-
-	// Decode phone logo image
-	phoneLogo, err := decodeImage(phoneLogoFile)
-	if err != nil {
-		http.Error(w, "Failed to decode phone logo", http.StatusInternalServerError)
-		log.Printf("generatePhoneQRCodeHandler: Failed to decode phone logo - %v", err)
-		return
-	}
-
-	// Overlay phone logo on QR code
-	qrCode, err = overlayImageOnQRCode(qrCode, phoneLogo, LogoPercent)
-	if err != nil {
-		http.Error(w, "Failed to overlay phone logo on QR code", http.StatusInternalServerError)
-		log.Printf("generatePhoneQRCodeHandler: Failed to overlay phone logo on QR code - %v", err)
-		return
-	}
-
-	// Set content type for QR code image
-	w.Header().Set("Content-Type", "image/png")
-
-	// Encode QR code as PNG and write to response
-	err = png.Encode(w, qrCode)
-	if err != nil {
-		log.Printf("generatePhoneQRCodeHandler: Failed to encode QR code as PNG - %v", err)
-	}
-}
-
-// Generates a QR code for a Spotify URL.
-func generateSpotifyQRCodeHandler(w http.ResponseWriter, r *http.Request) {
-	// Check for allowed method (POST only)
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		log.Printf("generateSpotifyQRCodeHandler: Method not allowed")
-		return
-	}
-
-	// Extract Spotify URL from request form
-	spotifyURL := r.FormValue("spotifyURL")
-
-	// Validate presence of Spotify URL
-	if spotifyURL == "" {
-		http.Error(w, "Missing Spotify URL", http.StatusBadRequest)
-		log.Printf("generateSpotifyQRCodeHandler: Missing Spotify URL")
-		return
-	}
-
-	// Extract and validate QR code size
-	sizeStr := r.FormValue("size")
-	if sizeStr == "" {
-		http.Error(w, "Missing size", http.StatusBadRequest)
-		log.Printf("generateSpotifyQRCodeHandler: Missing size")
-		return
-	}
-	size, err := strconv.Atoi(sizeStr)
-	if err != nil || !isValidQRCodeSize(size) {
-		http.Error(w, "Invalid size", http.StatusBadRequest)
-		log.Printf("generateSpotifyQRCodeHandler: Invalid size - %v", err)
-		return
-	}
-
-	// Generate QR code from Spotify URL
-	qrCode, err := generateQRCode(spotifyURL, size)
-	if err != nil {
-		http.Error(w, "Failed to generate QR code", http.StatusInternalServerError)
-		log.Printf("generateSpotifyQRCodeHandler: Failed to generate QR code - %v", err)
-		return
-	}
-
-	// Open Spotify logo file
-	spotifyLogoFile, err := http.Dir(".").Open(SpotifyLogoPath)
-	if err != nil {
-		http.Error(w, "Failed to open Spotify logo: file not found or cannot be opened", http.StatusInternalServerError)
-		log.Printf("generateSpotifyQRCodeHandler: Failed to open Spotify logo - %v", err)
-		return
-	}
-	defer spotifyLogoFile.Close()
-
-	// Decode Spotify logo image
-	spotifyLogo, err := decodeImage(spotifyLogoFile)
-	if err != nil {
-		http.Error(w, "Failed to decode Spotify logo", http.StatusInternalServerError)
-		log.Printf("generateSpotifyQRCodeHandler: Failed to decode Spotify logo - %v", err)
-		return
-	}
-
-	// Overlay Spotify logo on QR code
-	qrCode, err = overlayImageOnQRCode(qrCode, spotifyLogo, LogoPercent)
-	if err != nil {
-		http.Error(w, "Failed to overlay Spotify logo on QR code", http.StatusInternalServerError)
-		log.Printf("generateSpotifyQRCodeHandler: Failed to overlay Spotify logo on QR code - %v", err)
-		return
-	}
-
-	// Set content type for QR code image
-	w.Header().Set("Content-Type", "image/png")
-
-	// Encode QR code as PNG and write to response
-	err = png.Encode(w, qrCode)
-	if err != nil {
-		log.Printf("generateSpotifyQRCodeHandler: Failed to encode QR code as PNG - %v", err)
-	}
-}
-
-// Generates a QR code for a Telegram.
-func generateTelegramQRCodeHandler(w http.ResponseWriter, r *http.Request) {
-	// Check for allowed method (POST only)
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		log.Printf("generateTelegramQRCodeHandler: Method not allowed")
-		return
-	}
-
-	// Extract Telegram username or group name from request form
-	telegramName := r.FormValue("telegramName")
-
-	// Validate presence of Telegram name
-	if telegramName == "" {
-		http.Error(w, "Missing Telegram username or group name", http.StatusBadRequest)
-		log.Printf("generateTelegramQRCodeHandler: Missing Telegram username or group name")
-		return
-	}
-
-	// Extract and validate QR code size
-	sizeStr := r.FormValue("size")
-	if sizeStr == "" {
-		http.Error(w, "Missing size", http.StatusBadRequest)
-		log.Printf("generateTelegramQRCodeHandler: Missing size")
-		return
-	}
-	size, err := strconv.Atoi(sizeStr)
-	if err != nil || !isValidQRCodeSize(size) {
-		http.Error(w, "Invalid size", http.StatusBadRequest)
-		log.Printf("generateTelegramQRCodeHandler: Invalid size - %v", err)
-		return
-	}
-
-	// Generate Telegram URL with username or group name
-	telegramURL := fmt.Sprintf("https://t.me/%s", telegramName)
-
-	// Generate QR code from Telegram URL
-	qrCode, err := generateQRCode(telegramURL, size)
-	if err != nil {
-		http.Error(w, "Failed to generate QR code", http.StatusInternalServerError)
-		log.Printf("generateTelegramQRCodeHandler: Failed to generate QR code - %v", err)
-		return
-	}
-
-	// Open Telegram logo file
-	telegramLogoFile, err := http.Dir(".").Open(TelegramLogoPath)
-	if err != nil {
-		http.Error(w, "Failed to open Telegram logo: file not found or cannot be opened", http.StatusInternalServerError)
-		log.Printf("generateTelegramQRCodeHandler: Failed to open Telegram logo - %v", err)
-		return
-	}
-	defer telegramLogoFile.Close()
-
-	// Decode Telegram logo image
-	telegramLogo, err := decodeImage(telegramLogoFile)
-	if err != nil {
-		http.Error(w, "Failed to decode Telegram logo", http.StatusInternalServerError)
-		log.Printf("generateTelegramQRCodeHandler: Failed to decode Telegram logo - %v", err)
-		return
-	}
-
-	// Overlay Telegram logo on QR code
-	qrCode, err = overlayImageOnQRCode(qrCode, telegramLogo, LogoPercent)
-	if err != nil {
-		http.Error(w, "Failed to overlay Telegram logo on QR code", http.StatusInternalServerError)
-		log.Printf("generateTelegramQRCodeHandler: Failed to overlay Telegram logo on QR code - %v", err)
-		return
-	}
-
-	// Set content type for QR code image
-	w.Header().Set("Content-Type", "image/png")
-
-	// Encode QR code as PNG and write to response
-	err = png.Encode(w, qrCode)
-	if err != nil {
-		log.Printf("generateTelegramQRCodeHandler: Failed to encode QR code as PNG - %v", err)
-	}
-}
-
-// Generates a QR code for joining a Zoom meeting.
-func generateZoomQRCodeHandler(w http.ResponseWriter, r *http.Request) {
-	// Check for allowed method (POST only)
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		log.Printf("generateZoomQRCodeHandler: Method not allowed")
-		return
-	}
-
-	// Extract meeting ID and password from request form
-	meetingID := r.FormValue("meetingID")
-	password := r.FormValue("password")
-
-	// Validate presence of meeting ID
-	if meetingID == "" {
-		http.Error(w, "Missing meeting ID", http.StatusBadRequest)
-		log.Printf("generateZoomQRCodeHandler: Missing meeting ID")
-		return
-	}
-
-	// Extract and validate QR code size
-	sizeStr := r.FormValue("size")
-	if sizeStr == "" {
-		http.Error(w, "Missing size", http.StatusBadRequest)
-		log.Printf("generateZoomQRCodeHandler: Missing size")
-		return
-	}
-	size, err := strconv.Atoi(sizeStr)
-	if err != nil || !isValidQRCodeSize(size) {
-		http.Error(w, "Invalid size", http.StatusBadRequest)
-		log.Printf("generateZoomQRCodeHandler: Invalid size - %v", err)
-		return
-	}
-
-	// Generate Zoom meeting URL with meeting ID and password (optional)
-	zoomURL := fmt.Sprintf("https://zoom.us/j/%s?pwd=%s", meetingID, password)
-
-	// Generate QR code from Zoom meeting URL
-	qrCode, err := generateQRCode(zoomURL, size)
-	if err != nil {
-		http.Error(w, "Failed to generate QR code", http.StatusInternalServerError)
-		log.Printf("generateZoomQRCodeHandler: Failed to generate QR code - %v", err)
-		return
-	}
-
-	// Open Zoom logo file
-	zoomLogoFile, err := http.Dir(".").Open(ZoomLogoPath)
-	if err != nil {
-		http.Error(w, "Failed to open Zoom logo: file not found or cannot be opened", http.StatusInternalServerError)
-		log.Printf("generateZoomQRCodeHandler: Failed to open Zoom logo - %v", err)
-		return
-	}
-	defer zoomLogoFile.Close()
-
-	// Decode Zoom logo image
-	zoomLogo, err := decodeImage(zoomLogoFile)
-	if err != nil {
-		http.Error(w, "Failed to decode Zoom logo", http.StatusInternalServerError)
-		log.Printf("generateZoomQRCodeHandler: Failed to decode Zoom logo - %v", err)
-		return
-	}
-
-	// Overlay Zoom logo on QR code
-	qrCode, err = overlayImageOnQRCode(qrCode, zoomLogo, LogoPercent)
-	if err != nil {
-		http.Error(w, "Failed to overlay Zoom logo on QR code", http.StatusInternalServerError)
-		log.Printf("generateZoomQRCodeHandler: Failed to overlay Zoom logo on QR code - %v", err)
-		return
-	}
-
-	// Set content type for QR code image
-	w.Header().Set("Content-Type", "image/png")
-
-	// Encode QR code as PNG and write to response
-	err = png.Encode(w, qrCode)
-	if err != nil {
-		log.Printf("generateZoomQRCodeHandler: Failed to encode QR code as PNG - %v", err)
-	}
-}
-
 // overlayImageOnQRCodeWithOpacity overlays an image onto a QR code with a specified size and opacity.
 func overlayImageOnQRCodeWithOpacity(qrCode image.Image, overlay image.Image, overlayPercent, overlayOpacity float64) (image.Image, error) {
 	// Get the boundaries (width and height) of the QR code image
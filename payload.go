@@ -0,0 +1,340 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+// fieldGetter returns the value of a named input field, or "" when it is absent.
+// Form handlers pass r.FormValue and the JSON API passes the Get method of its decoded fields.
+type fieldGetter func(name string) string
+
+// PayloadField describes one input field of a payload type.
+type PayloadField struct {
+	Name     string `json:"name"`     // Form field and JSON data key
+	Label    string `json:"label"`    // Human readable name, used in error messages
+	Required bool   `json:"required"` // Whether the field must be non-empty
+}
+
+// PayloadType is a kind of QR code content, such as a URL or Wi-Fi network.
+// Registering a PayloadType makes it available to every generator with the
+// shared styling and output options.
+type PayloadType interface {
+	// Name identifies the type in the JSON API and the /generate_<name> endpoint.
+	Name() string
+	// Fields lists the input fields the type reads.
+	Fields() []PayloadField
+	// Validate checks the input fields.
+	Validate(get fieldGetter) error
+	// Build validates the input fields and returns the text to encode.
+	Build(get fieldGetter) (string, error)
+	// DefaultLogo is the path of the logo overlaid on the code, or "" for none.
+	DefaultLogo() string
+}
+
+// payloadVariant is the same data encoded in one of the formats a payload type offers.
+type payloadVariant struct {
+	Format  string
+	Payload string
+}
+
+// payloadVariants is implemented by payload types that can encode their data in several
+// formats, such as vCard and MeCard contacts, so the resulting codes can be compared.
+type payloadVariants interface {
+	// Variants returns the validated data encoded in each format, or nil for a single format.
+	Variants(get fieldGetter) []payloadVariant
+}
+
+// payloadECC is implemented by payload types whose format requires an error correction
+// level, such as EPC payment codes.
+type payloadECC interface {
+	// RequiredECC returns the required level (L, M, Q or H), or "" for any.
+	RequiredECC() string
+}
+
+// qrEmblem is a mark that a payload format prescribes in the centre of the code.
+type qrEmblem struct {
+	Image image.Image
+	Width float64 // Fraction of the symbol width, without the quiet zone
+}
+
+// payloadEmblem is implemented by payload types whose format prescribes a mark in the
+// centre of the code, such as the Swiss cross of QR-bills, which replaces any logo.
+type payloadEmblem interface {
+	// Emblem returns the mark, or nil for none.
+	Emblem() *qrEmblem
+}
+
+// payloadTypes holds the registered payload types by name.
+var payloadTypes = map[string]PayloadType{}
+
+// registerPayloadType adds a payload type to the registry, panicking on duplicate names.
+func registerPayloadType(t PayloadType) {
+	if _, ok := payloadTypes[t.Name()]; ok {
+		panic(fmt.Sprintf("payload type %q registered twice", t.Name()))
+	}
+	payloadTypes[t.Name()] = t
+}
+
+// lookupPayloadType returns the registered payload type with the given name.
+func lookupPayloadType(name string) (PayloadType, bool) {
+	t, ok := payloadTypes[name]
+	return t, ok
+}
+
+// payloadTypeNames returns the names of the registered payload types in alphabetical order.
+func payloadTypeNames() []string {
+	names := make([]string, 0, len(payloadTypes))
+	for name := range payloadTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// payloadSpec is a PayloadType assembled from a field list and functions, which covers
+// every built-in type. Required fields are checked before check and format are called.
+type payloadSpec struct {
+	name     string
+	fields   []PayloadField
+	logo     string
+	check    func(get fieldGetter) error // Extra validation, may be nil
+	format   func(get fieldGetter) string
+	variants func(get fieldGetter) []payloadVariant // Alternative formats, may be nil
+	ecc      string                                 // Error correction level the format requires, or ""
+	emblem   *qrEmblem                              // Mark drawn instead of a logo, may be nil
+}
+
+func (s payloadSpec) Name() string           { return s.name }
+func (s payloadSpec) Fields() []PayloadField { return s.fields }
+func (s payloadSpec) DefaultLogo() string    { return s.logo }
+func (s payloadSpec) RequiredECC() string    { return s.ecc }
+func (s payloadSpec) Emblem() *qrEmblem      { return s.emblem }
+
+func (s payloadSpec) Validate(get fieldGetter) error {
+	// Validate the presence of the required fields
+	for _, field := range s.fields {
+		if field.Required && get(field.Name) == "" {
+			return fmt.Errorf("Missing %s", field.Label)
+		}
+	}
+	if s.check != nil {
+		return s.check(get)
+	}
+	return nil
+}
+
+func (s payloadSpec) Variants(get fieldGetter) []payloadVariant {
+	if s.variants == nil {
+		return nil
+	}
+	return s.variants(get)
+}
+
+func (s payloadSpec) Build(get fieldGetter) (string, error) {
+	if err := s.Validate(get); err != nil {
+		return "", err
+	}
+	return s.format(get), nil
+}
+
+// required and optional declare payload fields.
+func required(name, label string) PayloadField {
+	return PayloadField{Name: name, Label: label, Required: true}
+}
+
+func optional(name, label string) PayloadField {
+	return PayloadField{Name: name, Label: label}
+}
+
+// profilePayload builds a social network profile URL from a username-like field.
+func profilePayload(name, logo, field, label, prefix string) payloadSpec {
+	return payloadSpec{
+		name:   name,
+		fields: []PayloadField{required(field, label)},
+		logo:   logo,
+		format: func(get fieldGetter) string { return prefix + get(field) },
+	}
+}
+
+func init() {
+	// Custom link, with an optional uploaded logo
+	registerPayloadType(payloadSpec{
+		name:   "url",
+		fields: []PayloadField{required("url", "URL")},
+		format: func(get fieldGetter) string { return get("url") },
+	})
+
+	// Social network profiles
+	registerPayloadType(profilePayload("instagram", InstagramLogoPath, "username", "username", "https://www.instagram.com/"))
+	registerPayloadType(profilePayload("facebook", FacebookLogoPath, "username", "username", "https://www.facebook.com/"))
+	registerPayloadType(profilePayload("tiktok", TikTokLogoPath, "username", "username", "https://www.tiktok.com/@"))
+	registerPayloadType(profilePayload("linkedin", LinkedInLogoPath, "username", "username", "https://www.linkedin.com/in/"))
+	registerPayloadType(profilePayload("youtube", YouTubeLogoPath, "channel", "channel", "https://www.youtube.com/channel/"))
+	registerPayloadType(profilePayload("x", XLogoPath, "username", "username", "https://www.twitter.com/"))
+	registerPayloadType(profilePayload("telegram", TelegramLogoPath, "telegramName", "Telegram username or group name", "https://t.me/"))
+
+	// Contact card, with an optional uploaded logo
+	registerPayloadType(payloadSpec{
+		name:     "vcard",
+		fields:   vCardFields,
+		check:    checkVCardFields,
+		format:   vCardPayload,
+		variants: vCardVariants,
+	})
+
+	// Wi-Fi network
+	registerPayloadType(payloadSpec{
+		name:   "wifi",
+		fields: wifiFields,
+		logo:   WiFiLogoPath,
+		check:  checkWiFiFields,
+		format: wifiPayload,
+	})
+
+	// Map location
+	registerPayloadType(payloadSpec{
+		name:   "map",
+		fields: []PayloadField{required("latitude", "latitude"), required("longitude", "longitude")},
+		logo:   MapLogoPath,
+		check:  checkMapFields,
+		format: func(get fieldGetter) string {
+			lat, _ := strconv.ParseFloat(get("latitude"), 64)
+			lon, _ := strconv.ParseFloat(get("longitude"), 64)
+			return fmt.Sprintf("geo:%f,%f", lat, lon)
+		},
+	})
+
+	// Calendar event
+	registerPayloadType(payloadSpec{
+		name:   "event",
+		fields: eventFields,
+		logo:   EventLogoPath,
+		check:  checkEventFields,
+		format: eventPayload,
+	})
+
+	// PayPal payment
+	registerPayloadType(payloadSpec{
+		name: "paypal",
+		fields: []PayloadField{
+			required("email", "recipient email"), required("amount", "amount"), required("currency", "currency"),
+			optional("description", "description"),
+		},
+		logo: PayPalLogoPath,
+		format: func(get fieldGetter) string {
+			return fmt.Sprintf("https://www.paypal.com/cgi-bin/webscr?cmd=_xclick&business=%s&amount=%s&currency_code=%s&item_name=%s",
+				get("email"), get("amount"), get("currency"), get("description"))
+		},
+	})
+
+	// SEPA credit transfer (EPC069-12 "GiroCode")
+	registerPayloadType(payloadSpec{
+		name:   "sepa",
+		fields: epcFields,
+		check:  checkEPCFields,
+		format: epcPayload,
+		ecc:    EPCECC,
+	})
+
+	// Swiss QR-bill, with the Swiss cross in the centre
+	registerPayloadType(payloadSpec{
+		name:   "swissqr",
+		fields: swissQRFields,
+		check:  checkSwissQRFields,
+		format: swissQRPayload,
+		ecc:    SwissQRECC,
+		emblem: swissCross,
+	})
+
+	// EMVCo merchant-presented codes: generic, Brazil PIX and Singapore PayNow
+	registerPayloadType(payloadSpec{
+		name:   "emvco",
+		fields: emvcoFields,
+		check:  checkEMVCoFields,
+		format: func(get fieldGetter) string { return emvcoMerchant(get).String() },
+	})
+	registerPayloadType(payloadSpec{
+		name:   "pix",
+		fields: pixFields,
+		check:  checkPIXFields,
+		format: func(get fieldGetter) string { return pixMerchant(get).String() },
+	})
+	registerPayloadType(payloadSpec{
+		name:   "paynow",
+		fields: payNowFields,
+		check:  checkPayNowFields,
+		format: func(get fieldGetter) string { return payNowMerchant(get).String() },
+	})
+
+	// Indian UPI payment link
+	registerPayloadType(payloadSpec{
+		name:   "upi",
+		fields: upiFields,
+		check:  checkUPIFields,
+		format: upiPayload,
+	})
+
+	// Messaging and calls
+	registerPayloadType(payloadSpec{
+		name:   "whatsapp",
+		fields: []PayloadField{required("phone", "phone number"), optional("message", "message")},
+		logo:   WhatsAppLogoPath,
+		format: func(get fieldGetter) string {
+			return fmt.Sprintf("https://wa.me/%s?text=%s", get("phone"), get("message"))
+		},
+	})
+	registerPayloadType(payloadSpec{
+		name:   "email",
+		fields: []PayloadField{required("email", "email"), optional("subject", "subject"), optional("body", "body")},
+		logo:   EmailLogoPath,
+		format: func(get fieldGetter) string {
+			return fmt.Sprintf("mailto:%s?subject=%s&body=%s", get("email"), url.QueryEscape(get("subject")), url.QueryEscape(get("body")))
+		},
+	})
+	registerPayloadType(payloadSpec{
+		name:   "sms",
+		fields: []PayloadField{required("phoneNumber", "phone number"), optional("message", "message")},
+		logo:   SMSLogoPath,
+		format: func(get fieldGetter) string { return fmt.Sprintf("sms:%s?body=%s", get("phoneNumber"), get("message")) },
+	})
+	registerPayloadType(payloadSpec{
+		name:   "phone",
+		fields: []PayloadField{required("phoneNumber", "phone number")},
+		logo:   PhoneLogoPath,
+		format: func(get fieldGetter) string { return "tel:" + get("phoneNumber") },
+	})
+
+	// Media and meetings
+	registerPayloadType(payloadSpec{
+		name:   "spotify",
+		fields: []PayloadField{required("spotifyURL", "Spotify URL")},
+		logo:   SpotifyLogoPath,
+		format: func(get fieldGetter) string { return get("spotifyURL") },
+	})
+	registerPayloadType(payloadSpec{
+		name:   "zoom",
+		fields: []PayloadField{required("meetingID", "meeting ID"), optional("password", "password")},
+		logo:   ZoomLogoPath,
+		format: func(get fieldGetter) string {
+			return fmt.Sprintf("https://zoom.us/j/%s?pwd=%s", get("meetingID"), get("password"))
+		},
+	})
+}
+
+// checkMapFields validates the format and range of the coordinates.
+func checkMapFields(get fieldGetter) error {
+	lat, err := strconv.ParseFloat(get("latitude"), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return errors.New("Invalid latitude")
+	}
+	lon, err := strconv.ParseFloat(get("longitude"), 64)
+	if err != nil || lon < -180 || lon > 180 {
+		return errors.New("Invalid longitude")
+	}
+	return nil
+}
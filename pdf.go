@@ -0,0 +1,408 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strconv"
+
+	"github.com/nfnt/resize"
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	// Physical size limits for PDF output
+	MinPrintSizeMM  = 10   // Smallest printable code in millimetres
+	MaxPrintSizeMM  = 1000 // Largest printable code in millimetres
+	MaxBleedMM      = 20   // Largest bleed in millimetres
+	DefaultPrintDPI = 300  // Logo resolution used when no DPI is given
+	MinPrintDPI     = 72   // Lowest accepted logo resolution
+	MaxPrintDPI     = 2400 // Highest accepted logo resolution
+
+	// Crop mark geometry
+	CropMarkGapMM    = 2    // Distance between the bleed edge and a crop mark in millimetres
+	CropMarkLengthMM = 5    // Length of a crop mark in millimetres
+	CropMarkWidthPt  = 0.25 // Stroke width of a crop mark in points
+
+	// ptPerMM converts millimetres to PDF points (1/72 inch)
+	ptPerMM = 72 / 25.4
+)
+
+// printOptions describes the physical page layout of PDF output.
+type printOptions struct {
+	SizeMM    float64 // Width and height of the code, quiet zone included, at the trim edge
+	DPI       int     // Resolution the logo is rasterized at
+	BleedMM   float64 // Extension of the background beyond the trim edge on every side
+	CropMarks bool    // Whether to draw crop marks outside the bleed
+}
+
+// parsePrintOptions extracts and validates the PDF page settings from the request fields.
+func parsePrintOptions(get fieldGetter) (printOptions, error) {
+	opts := printOptions{DPI: DefaultPrintDPI}
+
+	// Validate the physical size, which replaces the pixel size for PDF output
+	sizeStr := get("sizeMM")
+	if sizeStr == "" {
+		return opts, fmt.Errorf("Missing sizeMM")
+	}
+	sizeMM, err := strconv.ParseFloat(sizeStr, 64)
+	if err != nil || sizeMM < MinPrintSizeMM || sizeMM > MaxPrintSizeMM {
+		return opts, fmt.Errorf("Invalid sizeMM: must be between %d and %d", MinPrintSizeMM, MaxPrintSizeMM)
+	}
+	opts.SizeMM = sizeMM
+
+	// Validate the optional logo resolution
+	if dpiStr := get("dpi"); dpiStr != "" {
+		dpi, err := strconv.Atoi(dpiStr)
+		if err != nil || dpi < MinPrintDPI || dpi > MaxPrintDPI {
+			return opts, fmt.Errorf("Invalid dpi: must be between %d and %d", MinPrintDPI, MaxPrintDPI)
+		}
+		opts.DPI = dpi
+	}
+
+	// Validate the optional bleed
+	if bleedStr := get("bleedMM"); bleedStr != "" {
+		bleed, err := strconv.ParseFloat(bleedStr, 64)
+		if err != nil || bleed < 0 || bleed > MaxBleedMM {
+			return opts, fmt.Errorf("Invalid bleedMM: must be between 0 and %d", MaxBleedMM)
+		}
+		opts.BleedMM = bleed
+	}
+
+	// Parse the optional crop marks flag
+	cropMarks, err := parseFormBool(get("cropMarks"))
+	if err != nil {
+		return opts, fmt.Errorf("Invalid cropMarks")
+	}
+	opts.CropMarks = cropMarks
+
+	return opts, nil
+}
+
+// renderPDF lays out a QR code on a single PDF page. The code fills the trim box, the
+// background extends into the bleed, and crop marks are drawn beyond the bleed.
+// Modules are drawn as vector outlines; only the logo is rasterized, at opts.Print.DPI.
+// A frame and caption widen the trim box around the code, which keeps its size.
+func renderPDF(qr *qrcode.QRCode, qrOpts qrOptions, logo *qrLogo) ([]byte, error) {
+	opts := qrOpts.Print
+
+	// Outline the modules in module units, including the quiet zone.
+	layers, modules := qrLayers(qr, qrOpts)
+
+	// Lay out the frame, with the caption size converted from points to modules.
+	size := opts.SizeMM * ptPerMM
+	module := size / float64(modules)
+	frame := layoutFrame(qrOpts.Frame, modules, qrOpts.Frame.FontSize/module)
+
+	// Page geometry in points, with the trim box centred on the page.
+	trimW := frame.Width * module
+	trimH := frame.Height * module
+	bleed := opts.BleedMM * ptPerMM
+	margin := bleed
+	if opts.CropMarks {
+		margin += (CropMarkGapMM + CropMarkLengthMM) * ptPerMM
+	}
+	pageW := trimW + 2*margin
+	pageH := trimH + 2*margin
+
+	doc := &pdfDocument{}
+	resources := &pdfResources{}
+	var content bytes.Buffer
+
+	// Paint the background over the trim and bleed area unless it is fully transparent.
+	if qrOpts.Background.A != 0 {
+		content.WriteString("q\n")
+		writePDFFill(doc, resources, &content, qrOpts.Background)
+		fmt.Fprintf(&content, "%s re f\nQ\n", pdfRect(margin-bleed, margin-bleed, trimW+2*bleed, trimH+2*bleed))
+	}
+
+	// Fill each layer of styled modules in its place in the frame, then the frame and caption.
+	codeX := margin + frame.CodeX*module
+	codeTop := margin + trimH - frame.CodeY*module
+	writePDFLayers(doc, resources, &content, layers, codeX, codeTop, module)
+	writePDFLayers(doc, resources, &content, frame.Layers, margin, margin+trimH, module)
+
+	// Place the logo, if any, centred on the code.
+	if logo != nil {
+		if err := writePDFLogo(doc, resources, &content, logo, opts.DPI, codeX, codeTop-size, size); err != nil {
+			return nil, err
+		}
+	}
+
+	// Draw the crop marks in registration colour so they print on every separation.
+	if opts.CropMarks {
+		writeCropMarks(&content, margin, trimW, trimH, bleed)
+	}
+
+	// Assemble the page with its trim and bleed boxes.
+	contentID, err := doc.addStream("", content.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	pagesID := doc.reserve()
+	pageID := doc.add(fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %s %s] /BleedBox [%s] /TrimBox [%s] /Resources %s /Contents %d 0 R >>",
+		pagesID, pdfNumber(pageW), pdfNumber(pageH),
+		pdfBox(margin-bleed, margin-bleed, margin+trimW+bleed, margin+trimH+bleed),
+		pdfBox(margin, margin, margin+trimW, margin+trimH),
+		resources, contentID))
+	doc.set(pagesID, fmt.Sprintf("<< /Type /Pages /Kids [%d 0 R] /Count 1 >>", pageID))
+	catalogID := doc.add(fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pagesID))
+
+	return doc.bytes(catalogID), nil
+}
+
+// writePDFLayers fills outlines in module units, placing their top-left corner at (x, top).
+// PDF coordinates start at the bottom left, so the outlines are flipped vertically.
+func writePDFLayers(doc *pdfDocument, resources *pdfResources, content *bytes.Buffer, layers []qrLayer, x, top, module float64) {
+	pt := func(p [2]float64) string {
+		return pdfNumber(x+p[0]*module) + " " + pdfNumber(top-p[1]*module)
+	}
+	for _, layer := range layers {
+		content.WriteString("q\n")
+		writePDFFill(doc, resources, content, layer.Color)
+		for _, op := range layer.Path.Ops {
+			switch op.Op {
+			case 'M':
+				fmt.Fprintf(content, "%s m\n", pt(op.Pts[0]))
+			case 'L':
+				fmt.Fprintf(content, "%s l\n", pt(op.Pts[0]))
+			case 'C':
+				fmt.Fprintf(content, "%s %s %s c\n", pt(op.Pts[0]), pt(op.Pts[1]), pt(op.Pts[2]))
+			case 'Z':
+				content.WriteString("h\n")
+			}
+		}
+		content.WriteString("f\nQ\n")
+	}
+}
+
+// writePDFFill sets the fill colour, with a graphics state for its opacity when it is translucent.
+func writePDFFill(doc *pdfDocument, resources *pdfResources, content *bytes.Buffer, c color.NRGBA) {
+	if c.A != 0xff {
+		writePDFAlpha(doc, resources, content, colorAlpha(c))
+	}
+	fmt.Fprintf(content, "%s %s %s rg\n", pdfNumber(float64(c.R)/255), pdfNumber(float64(c.G)/255), pdfNumber(float64(c.B)/255))
+}
+
+// writePDFAlpha sets the fill opacity through a new graphics state.
+func writePDFAlpha(doc *pdfDocument, resources *pdfResources, content *bytes.Buffer, alpha float64) {
+	gsID := doc.add(fmt.Sprintf("<< /Type /ExtGState /ca %s >>", pdfNumber(math.Max(0, alpha))))
+	fmt.Fprintf(content, "/%s gs\n", resources.addExtGState(gsID))
+}
+
+// writePDFLogo embeds the logo as an image XObject fitted within logo.Percent of the code and
+// draws it centred on the code, whose bottom-left corner is at (x, y).
+func writePDFLogo(doc *pdfDocument, resources *pdfResources, content *bytes.Buffer, logo *qrLogo, dpi int, x, y, size float64) error {
+	bounds := logo.Image.Bounds()
+	if bounds.Dx() == 0 || bounds.Dy() == 0 {
+		return nil
+	}
+
+	// Fit the logo within the reserved square, keeping its aspect ratio.
+	box := size * logo.Percent
+	scale := math.Min(box/float64(bounds.Dx()), box/float64(bounds.Dy()))
+	w := float64(bounds.Dx()) * scale
+	h := float64(bounds.Dy()) * scale
+
+	// Downsample the logo to the print resolution; larger images only add file size.
+	pixelsW := uint(math.Ceil(w / 72 * float64(dpi)))
+	pixelsH := uint(math.Ceil(h / 72 * float64(dpi)))
+	img := resize.Thumbnail(pixelsW, pixelsH, logo.Image, resize.Lanczos3)
+
+	imageID, err := addPDFImage(doc, img)
+	if err != nil {
+		return err
+	}
+	name := resources.addXObject(imageID)
+
+	content.WriteString("q\n")
+	if logo.Opacity < 1 {
+		writePDFAlpha(doc, resources, content, logo.Opacity)
+	}
+	fmt.Fprintf(content, "%s 0 0 %s %s %s cm\n/%s Do\nQ\n",
+		pdfNumber(w), pdfNumber(h), pdfNumber(x+(size-w)/2), pdfNumber(y+(size-h)/2), name)
+	return nil
+}
+
+// writeCropMarks draws a pair of crop marks at each corner of the trim box,
+// starting just outside the bleed.
+func writeCropMarks(content *bytes.Buffer, margin, width, height, bleed float64) {
+	gap := bleed + CropMarkGapMM*ptPerMM
+	length := CropMarkLengthMM * ptPerMM
+
+	fmt.Fprintf(content, "q\n1 1 1 1 K\n%s w\n", pdfNumber(CropMarkWidthPt))
+	for _, x := range []float64{margin, margin + width} {
+		for _, y := range []float64{margin, margin + height} {
+			// Marks point away from the trim box on the side of the corner they belong to.
+			dx, dy := -1.0, -1.0
+			if x > margin {
+				dx = 1
+			}
+			if y > margin {
+				dy = 1
+			}
+			fmt.Fprintf(content, "%s %s m %s %s l S\n", pdfNumber(x+dx*gap), pdfNumber(y), pdfNumber(x+dx*(gap+length)), pdfNumber(y))
+			fmt.Fprintf(content, "%s %s m %s %s l S\n", pdfNumber(x), pdfNumber(y+dy*gap), pdfNumber(x), pdfNumber(y+dy*(gap+length)))
+		}
+	}
+	content.WriteString("Q\n")
+}
+
+// addPDFImage embeds an image as a compressed RGB XObject, with a soft mask when it has transparency.
+func addPDFImage(doc *pdfDocument, img image.Image) (int, error) {
+	bounds := img.Bounds()
+	rgb := make([]byte, 0, bounds.Dx()*bounds.Dy()*3)
+	alpha := make([]byte, 0, bounds.Dx()*bounds.Dy())
+	opaque := true
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			// PDF expects colours that are not premultiplied by alpha.
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			rgb = append(rgb, c.R, c.G, c.B)
+			alpha = append(alpha, c.A)
+			if c.A != 0xff {
+				opaque = false
+			}
+		}
+	}
+
+	dict := fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8",
+		bounds.Dx(), bounds.Dy())
+	if !opaque {
+		maskID, err := doc.addStream(fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceGray /BitsPerComponent 8",
+			bounds.Dx(), bounds.Dy()), alpha)
+		if err != nil {
+			return 0, err
+		}
+		dict += fmt.Sprintf(" /SMask %d 0 R", maskID)
+	}
+	return doc.addStream(dict, rgb)
+}
+
+// pdfResources collects the named resources referenced by a page's content stream.
+type pdfResources struct {
+	xobjects   []int
+	extGStates []int
+}
+
+// addXObject registers an image XObject and returns its resource name.
+func (r *pdfResources) addXObject(id int) string {
+	r.xobjects = append(r.xobjects, id)
+	return fmt.Sprintf("Im%d", len(r.xobjects))
+}
+
+// addExtGState registers a graphics state and returns its resource name.
+func (r *pdfResources) addExtGState(id int) string {
+	r.extGStates = append(r.extGStates, id)
+	return fmt.Sprintf("GS%d", len(r.extGStates))
+}
+
+// String formats the resources as a PDF dictionary.
+func (r *pdfResources) String() string {
+	var buf bytes.Buffer
+	buf.WriteString("<<")
+	if len(r.xobjects) > 0 {
+		buf.WriteString(" /XObject <<")
+		for i, id := range r.xobjects {
+			fmt.Fprintf(&buf, " /Im%d %d 0 R", i+1, id)
+		}
+		buf.WriteString(" >>")
+	}
+	if len(r.extGStates) > 0 {
+		buf.WriteString(" /ExtGState <<")
+		for i, id := range r.extGStates {
+			fmt.Fprintf(&buf, " /GS%d %d 0 R", i+1, id)
+		}
+		buf.WriteString(" >>")
+	}
+	buf.WriteString(" >>")
+	return buf.String()
+}
+
+// pdfDocument assembles a PDF file from numbered indirect objects.
+type pdfDocument struct {
+	objects [][]byte
+}
+
+// reserve allocates an object number to be filled in later with set.
+func (d *pdfDocument) reserve() int {
+	d.objects = append(d.objects, nil)
+	return len(d.objects)
+}
+
+// set stores the body of a previously reserved object.
+func (d *pdfDocument) set(id int, object string) {
+	d.objects[id-1] = []byte(object)
+}
+
+// add appends an object and returns its number.
+func (d *pdfDocument) add(object string) int {
+	id := d.reserve()
+	d.set(id, object)
+	return id
+}
+
+// addStream appends a Flate-compressed stream object with the given extra dictionary entries.
+func (d *pdfDocument) addStream(dict string, data []byte) (int, error) {
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	if _, err := zw.Write(data); err != nil {
+		return 0, fmt.Errorf("failed to compress PDF stream: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return 0, fmt.Errorf("failed to compress PDF stream: %w", err)
+	}
+
+	if dict != "" {
+		dict += " "
+	}
+	var obj bytes.Buffer
+	fmt.Fprintf(&obj, "<< %s/Filter /FlateDecode /Length %d >>\nstream\n", dict, compressed.Len())
+	obj.Write(compressed.Bytes())
+	obj.WriteString("\nendstream")
+
+	id := d.reserve()
+	d.objects[id-1] = obj.Bytes()
+	return id, nil
+}
+
+// bytes serializes the document with its cross-reference table, using root as the catalog.
+func (d *pdfDocument) bytes(root int) []byte {
+	var buf bytes.Buffer
+	// The binary comment marks the file as containing 8-bit data.
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	offsets := make([]int, len(d.objects))
+	for i, obj := range d.objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n", i+1)
+		buf.Write(obj)
+		buf.WriteString("\nendobj\n")
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(d.objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(d.objects)+1, root, xref)
+	return buf.Bytes()
+}
+
+// pdfNumber formats a length in points with at most three decimal places.
+func pdfNumber(v float64) string {
+	return strconv.FormatFloat(math.Round(v*1000)/1000, 'f', -1, 64)
+}
+
+// pdfRect formats the operands of a PDF "re" operator.
+func pdfRect(x, y, w, h float64) string {
+	return fmt.Sprintf("%s %s %s %s", pdfNumber(x), pdfNumber(y), pdfNumber(w), pdfNumber(h))
+}
+
+// pdfBox formats a PDF rectangle array from its lower-left and upper-right corners.
+func pdfBox(x1, y1, x2, y2 float64) string {
+	return fmt.Sprintf("%s %s %s %s", pdfNumber(x1), pdfNumber(y1), pdfNumber(x2), pdfNumber(y2))
+}
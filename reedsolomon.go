@@ -0,0 +1,172 @@
+package main
+
+import "errors"
+
+// gfPrimitive is the primitive polynomial of the QR code Galois field GF(256).
+const gfPrimitive = 0x11d
+
+var (
+	// Exponent and logarithm tables of GF(256) with generator 2. gfExp is doubled in
+	// length so products can be looked up without reducing the exponent sum.
+	gfExp [512]byte
+	gfLog [256]int
+
+	errTooManyErrors = errors.New("too many errors to correct")
+)
+
+func init() {
+	x := 1
+	for i := 0; i < 255; i++ {
+		gfExp[i] = byte(x)
+		gfLog[x] = i
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= gfPrimitive
+		}
+	}
+	for i := 255; i < len(gfExp); i++ {
+		gfExp[i] = gfExp[i-255]
+	}
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[gfLog[a]+gfLog[b]]
+}
+
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gfExp[gfLog[a]+255-gfLog[b]]
+}
+
+// gfPow returns 2 raised to the power n, for any integer n.
+func gfPow(n int) byte {
+	n %= 255
+	if n < 0 {
+		n += 255
+	}
+	return gfExp[n]
+}
+
+// gfPolyEval evaluates a polynomial whose coefficients are in increasing order of power.
+func gfPolyEval(poly []byte, x byte) byte {
+	var y byte
+	for i := len(poly) - 1; i >= 0; i-- {
+		y = gfMul(y, x) ^ poly[i]
+	}
+	return y
+}
+
+// rsCorrect corrects a Reed-Solomon block in place: data codewords followed by numEC
+// error correction codewords, as in a QR code, with the first codeword holding the
+// highest power. It returns the number of corrected codewords.
+func rsCorrect(block []byte, numEC int) (int, error) {
+	n := len(block)
+
+	// Compute the syndromes S_j = R(2^j); the block is error free if they are all zero.
+	syndromes := make([]byte, numEC)
+	clean := true
+	for j := range syndromes {
+		var s byte
+		x := gfPow(j)
+		for _, c := range block {
+			s = gfMul(s, x) ^ c
+		}
+		syndromes[j] = s
+		if s != 0 {
+			clean = false
+		}
+	}
+	if clean {
+		return 0, nil
+	}
+
+	// Find the error locator polynomial with the Berlekamp-Massey algorithm.
+	locator := []byte{1}
+	prev := []byte{1}
+	length, shift := 0, 1
+	lastDiscrepancy := byte(1)
+	for i := 0; i < numEC; i++ {
+		discrepancy := syndromes[i]
+		for k := 1; k <= length && k < len(locator); k++ {
+			discrepancy ^= gfMul(locator[k], syndromes[i-k])
+		}
+		if discrepancy == 0 {
+			shift++
+			continue
+		}
+		scale := gfDiv(discrepancy, lastDiscrepancy)
+		size := len(locator)
+		if len(prev)+shift > size {
+			size = len(prev) + shift
+		}
+		next := make([]byte, size)
+		copy(next, locator)
+		for k, c := range prev {
+			next[k+shift] ^= gfMul(scale, c)
+		}
+		if 2*length <= i {
+			prev = locator
+			length = i + 1 - length
+			lastDiscrepancy = discrepancy
+			shift = 1
+		} else {
+			shift++
+		}
+		locator = next
+	}
+	if 2*length > numEC {
+		return 0, errTooManyErrors
+	}
+
+	// Find the error positions with a Chien search: an error at power p of the block
+	// polynomial makes 2^-p a root of the locator.
+	var positions []int
+	for p := 0; p < n; p++ {
+		if gfPolyEval(locator, gfPow(-p)) == 0 {
+			positions = append(positions, p)
+		}
+	}
+	if len(positions) != length {
+		return 0, errTooManyErrors
+	}
+
+	// Compute the error magnitudes with the Forney algorithm, using the error evaluator
+	// Omega(x) = S(x) * Lambda(x) mod x^numEC and the formal derivative of the locator.
+	evaluator := make([]byte, numEC)
+	for i, s := range syndromes {
+		for k := 0; k < len(locator) && i+k < numEC; k++ {
+			evaluator[i+k] ^= gfMul(s, locator[k])
+		}
+	}
+	derivative := make([]byte, len(locator))
+	for k := 1; k < len(locator); k += 2 {
+		derivative[k-1] = locator[k]
+	}
+	for _, p := range positions {
+		xInv := gfPow(-p)
+		denominator := gfPolyEval(derivative, xInv)
+		if denominator == 0 {
+			return 0, errTooManyErrors
+		}
+		magnitude := gfMul(gfPow(p), gfDiv(gfPolyEval(evaluator, xInv), denominator))
+		block[n-1-p] ^= magnitude
+	}
+
+	// Confirm the correction produced a valid codeword.
+	for j := 0; j < numEC; j++ {
+		var s byte
+		x := gfPow(j)
+		for _, c := range block {
+			s = gfMul(s, x) ^ c
+		}
+		if s != 0 {
+			return 0, errTooManyErrors
+		}
+	}
+	return len(positions), nil
+}
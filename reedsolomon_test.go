@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// specBlock is the version 1-M symbol for "01234567" from the worked example of
+// ISO/IEC 18004: 16 data codewords followed by 10 error correction codewords.
+var specBlock = []byte{
+	32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17,
+	196, 35, 39, 119, 235, 215, 231, 226, 93, 23,
+}
+
+// rsEncode appends numEC error correction codewords to data: the remainder of the data
+// polynomial times x^numEC divided by the generator (x - 2^0)...(x - 2^(numEC-1)).
+func rsEncode(data []byte, numEC int) []byte {
+	// Generator coefficients, highest power first
+	generator := []byte{1}
+	for i := 0; i < numEC; i++ {
+		next := make([]byte, len(generator)+1)
+		for k, c := range generator {
+			next[k] ^= c
+			next[k+1] ^= gfMul(c, gfPow(i))
+		}
+		generator = next
+	}
+	remainder := make([]byte, len(data)+numEC)
+	copy(remainder, data)
+	for i := range data {
+		if factor := remainder[i]; factor != 0 {
+			for k, c := range generator {
+				remainder[i+k] ^= gfMul(c, factor)
+			}
+		}
+	}
+	return append(append([]byte(nil), data...), remainder[len(data):]...)
+}
+
+// syndromes evaluates a block at 2^0 to 2^(numEC-1), as rsCorrect does.
+func syndromes(block []byte, numEC int) []byte {
+	s := make([]byte, numEC)
+	for j := range s {
+		for _, c := range block {
+			s[j] = gfMul(s[j], gfPow(j)) ^ c
+		}
+	}
+	return s
+}
+
+// corrupt XORs count distinct codewords of block with non-zero values.
+func corrupt(block []byte, count int, rng *rand.Rand) []byte {
+	damaged := append([]byte(nil), block...)
+	for _, i := range rng.Perm(len(block))[:count] {
+		damaged[i] ^= byte(1 + rng.Intn(255))
+	}
+	return damaged
+}
+
+func TestGaloisField(t *testing.T) {
+	if gfPow(8) != 0x1d || gfPow(255) != 1 || gfPow(-1) != gfPow(254) {
+		t.Fatalf("gfPow: got 2^8 = %#x, 2^255 = %#x, 2^-1 = %#x", gfPow(8), gfPow(255), gfPow(-1))
+	}
+	for a := 1; a < 256; a++ {
+		for b := 1; b < 256; b++ {
+			if got := gfMul(gfDiv(byte(a), byte(b)), byte(b)); got != byte(a) {
+				t.Fatalf("(%d / %d) * %d = %d", a, b, b, got)
+			}
+		}
+	}
+	// x^2 + 3x + 5 at x = 2: 4 ^ 6 ^ 5
+	if got := gfPolyEval([]byte{5, 3, 1}, 2); got != 7 {
+		t.Errorf("gfPolyEval: got %d, want 7", got)
+	}
+}
+
+func TestRSEncodeSpecExample(t *testing.T) {
+	if got := rsEncode(specBlock[:16], 10); !bytes.Equal(got, specBlock) {
+		t.Fatalf("rsEncode: got %v, want %v", got[16:], specBlock[16:])
+	}
+	if s := syndromes(specBlock, 10); !bytes.Equal(s, make([]byte, 10)) {
+		t.Errorf("syndromes of a valid block: got %v, want all zero", s)
+	}
+}
+
+func TestRSCorrectKnownSyndromes(t *testing.T) {
+	// An error e at power p of the block polynomial gives the syndromes S_j = e * 2^(j*p).
+	tests := []struct {
+		index     int
+		magnitude byte
+	}{
+		{25, 0x01}, {25, 0xff}, {24, 0x01}, {0, 0x80}, {13, 0x5a},
+	}
+	for _, tt := range tests {
+		block := append([]byte(nil), specBlock...)
+		block[tt.index] ^= tt.magnitude
+		p := len(block) - 1 - tt.index
+		for j, s := range syndromes(block, 10) {
+			if want := gfMul(tt.magnitude, gfPow(j*p)); s != want {
+				t.Errorf("error %#x at %d: S_%d = %#x, want %#x", tt.magnitude, tt.index, j, s, want)
+			}
+		}
+		n, err := rsCorrect(block, 10)
+		if err != nil || n != 1 {
+			t.Errorf("error %#x at %d: rsCorrect = %d, %v; want 1, nil", tt.magnitude, tt.index, n, err)
+		}
+		if !bytes.Equal(block, specBlock) {
+			t.Errorf("error %#x at %d: block not restored", tt.magnitude, tt.index)
+		}
+	}
+}
+
+func TestRSCorrect(t *testing.T) {
+	// Block sizes of QR codes: 1-L, 1-H, 5-Q, 10-M and 40-L
+	tests := []struct {
+		data, numEC int
+	}{
+		{19, 7}, {9, 17}, {15, 18}, {43, 26}, {118, 30},
+	}
+	rng := rand.New(rand.NewSource(1))
+	for _, tt := range tests {
+		data := make([]byte, tt.data)
+		rng.Read(data)
+		block := rsEncode(data, tt.numEC)
+		for count := 0; count <= tt.numEC/2; count++ {
+			damaged := corrupt(block, count, rng)
+			n, err := rsCorrect(damaged, tt.numEC)
+			if err != nil || n != count {
+				t.Errorf("%d+%d with %d errors: rsCorrect = %d, %v; want %d, nil", tt.data, tt.numEC, count, n, err, count)
+				continue
+			}
+			if !bytes.Equal(damaged, block) {
+				t.Errorf("%d+%d with %d errors: block not restored", tt.data, tt.numEC, count)
+			}
+		}
+	}
+}
+
+func TestRSCorrectTooManyErrors(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, numEC := range []int{10, 17, 30} {
+		block := rsEncode(specBlock[:16], numEC)
+		for count := numEC/2 + 1; count <= numEC; count++ {
+			damaged := corrupt(block, count, rng)
+			if n, err := rsCorrect(damaged, numEC); err != errTooManyErrors {
+				t.Errorf("%d EC codewords with %d errors: rsCorrect = %d, %v; want %v", numEC, count, n, err, errTooManyErrors)
+			}
+		}
+	}
+}
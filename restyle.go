@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"net/http"
+)
+
+// restyledPayload encodes a payload decoded from an existing code unchanged, so no
+// detail is lost by interpreting and rebuilding it. It has no default logo.
+var restyledPayload = payloadSpec{
+	name:   "restyle",
+	fields: []PayloadField{required("payload", "payload")},
+	format: func(get fieldGetter) string { return get("payload") },
+}
+
+// restyleQRCode decodes the single QR code in an image and generates it again with the
+// given options and optional logo. Without an ecc option or a logo, the error correction
+// level of the original code is kept.
+func restyleQRCode(img image.Image, options fieldGetter, customLogo image.Image) (*qrResult, *decodedCode, error) {
+	// Decode the existing code
+	response, err := decodeQRImage(img)
+	if err != nil {
+		return nil, nil, &generateError{Status: http.StatusUnprocessableEntity, Code: ErrCodeUnreadable, Message: err.Error()}
+	}
+	if len(response.Codes) > 1 {
+		err := fmt.Errorf("Image contains %d QR codes; upload one code at a time", len(response.Codes))
+		return nil, nil, &generateError{Status: http.StatusUnprocessableEntity, Code: ErrCodeInvalidRequest, Message: err.Error()}
+	}
+	original := response.Codes[0]
+
+	// Re-encode the payload, keeping the original error correction level by default
+	data := func(name string) string {
+		if name == "payload" {
+			return original.Payload
+		}
+		return ""
+	}
+	restyleOptions := func(name string) string {
+		if name == "ecc" && options(name) == "" && customLogo == nil {
+			return original.ECC
+		}
+		return options(name)
+	}
+	result, err := generatePayloadQRCode(restyledPayload, data, restyleOptions, customLogo)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result, &original, nil
+}
+
+func restyleHandler(w http.ResponseWriter, r *http.Request) {
+	// Check if the request method is POST, otherwise return an error
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		log.Printf("restyleHandler: Method not allowed")
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, MaxDecodeUploadBytes)
+
+	// Read and decode the existing QR code image
+	codeFile, _, err := r.FormFile("code")
+	if err != nil {
+		http.Error(w, "Missing code image", http.StatusBadRequest)
+		log.Printf("restyleHandler: Missing code image - %v", err)
+		return
+	}
+	defer codeFile.Close()
+	codeImage, err := decodeImage(codeFile)
+	if err != nil {
+		http.Error(w, "Failed to decode code image", http.StatusBadRequest)
+		log.Printf("restyleHandler: Failed to decode code image - %v", err)
+		return
+	}
+
+	// Decode the uploaded logo, if any
+	var customLogo image.Image
+	file, _, err := r.FormFile("image")
+	if err != nil && err != http.ErrMissingFile {
+		http.Error(w, "Error reading image", http.StatusBadRequest)
+		log.Printf("restyleHandler: Error reading image - %v", err)
+		return
+	}
+	if file != nil {
+		defer file.Close()
+		customLogo, err = decodeImage(file)
+		if err != nil {
+			http.Error(w, "Failed to decode image", http.StatusBadRequest)
+			log.Printf("restyleHandler: Failed to decode image - %v", err)
+			return
+		}
+	}
+
+	// Decode the existing code and generate it again with the form's options
+	result, original, err := restyleQRCode(codeImage, r.FormValue, customLogo)
+	if err != nil {
+		var genErr *generateError
+		if errors.As(err, &genErr) {
+			http.Error(w, genErr.Message, genErr.Status)
+		} else {
+			http.Error(w, "Failed to generate QR code", http.StatusInternalServerError)
+		}
+		log.Printf("restyleHandler: %v", err)
+		return
+	}
+
+	// Set the content type header and write the new QR code to the HTTP response writer
+	w.Header().Set("Content-Type", result.ContentType)
+	setResultHeaders(w, result)
+	if original.Type != "" {
+		w.Header().Set("X-QR-Type", original.Type)
+	}
+	if _, err := w.Write(result.Data); err != nil {
+		log.Printf("restyleHandler: Failed to write QR code - %v", err)
+	}
+}
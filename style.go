@@ -0,0 +1,321 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+	"golang.org/x/image/vector"
+)
+
+const (
+	// Module shapes
+	ModuleSquare  = "square"  // Plain square modules
+	ModuleDot     = "dot"     // Separate circular dots
+	ModuleRounded = "rounded" // Separate squares with rounded corners
+	ModuleLiquid  = "liquid"  // Neighbouring modules merged into blobs with rounded outer corners
+
+	// Finder pattern ("eye") shapes
+	EyeSquare  = "square"  // Plain square eye
+	EyeRounded = "rounded" // Square eye with rounded corners
+	EyeCircle  = "circle"  // Circular eye
+
+	// FinderSize is the width and height of a finder pattern in modules
+	FinderSize = 7
+
+	// bezierCircle is the control point distance used to approximate a quarter circle with a cubic curve
+	bezierCircle = 0.5523
+)
+
+var (
+	// Valid values for the module and eye shape options
+	moduleShapes = map[string]bool{ModuleSquare: true, ModuleDot: true, ModuleRounded: true, ModuleLiquid: true}
+	eyeShapes    = map[string]bool{EyeSquare: true, EyeRounded: true, EyeCircle: true}
+)
+
+// styleOptions controls how modules and finder patterns are drawn.
+type styleOptions struct {
+	Module        string      // Shape of the data modules
+	EyeOuter      string      // Shape of the outer ring of the finder patterns
+	EyeInner      string      // Shape of the centre of the finder patterns
+	EyeOuterColor color.NRGBA // Colour of the outer ring of the finder patterns
+	EyeInnerColor color.NRGBA // Colour of the centre of the finder patterns
+}
+
+// parseStyleOptions extracts and validates the module and eye styling from the request fields.
+// Eye colours default to the foreground colour.
+func parseStyleOptions(get fieldGetter, fg color.NRGBA) (styleOptions, error) {
+	style := styleOptions{
+		Module:        ModuleSquare,
+		EyeOuter:      EyeSquare,
+		EyeInner:      EyeSquare,
+		EyeOuterColor: fg,
+		EyeInnerColor: fg,
+	}
+
+	// Validate the optional shapes
+	if value := strings.ToLower(get("moduleShape")); value != "" {
+		if !moduleShapes[value] {
+			return style, fmt.Errorf("Invalid moduleShape %q: must be square, dot, rounded or liquid", value)
+		}
+		style.Module = value
+	}
+	if value := strings.ToLower(get("eyeOuterShape")); value != "" {
+		if !eyeShapes[value] {
+			return style, fmt.Errorf("Invalid eyeOuterShape %q: must be square, rounded or circle", value)
+		}
+		style.EyeOuter = value
+	}
+	if value := strings.ToLower(get("eyeInnerShape")); value != "" {
+		if !eyeShapes[value] {
+			return style, fmt.Errorf("Invalid eyeInnerShape %q: must be square, rounded or circle", value)
+		}
+		style.EyeInner = value
+	}
+
+	// Validate the optional eye colours
+	if value := get("eyeOuterColor"); value != "" {
+		c, err := parseColor(value)
+		if err != nil {
+			return style, fmt.Errorf("Invalid eyeOuterColor: %v", err)
+		}
+		style.EyeOuterColor = c
+	}
+	if value := get("eyeInnerColor"); value != "" {
+		c, err := parseColor(value)
+		if err != nil {
+			return style, fmt.Errorf("Invalid eyeInnerColor: %v", err)
+		}
+		style.EyeInnerColor = c
+	}
+
+	return style, nil
+}
+
+// isPlain reports whether the style draws ordinary square modules in a single colour.
+func (s styleOptions) isPlain(fg color.NRGBA) bool {
+	return s.Module == ModuleSquare && s.EyeOuter == EyeSquare && s.EyeInner == EyeSquare &&
+		s.EyeOuterColor == fg && s.EyeInnerColor == fg
+}
+
+// pathOp is a single outline command: 'M' move, 'L' line, 'C' cubic curve or 'Z' close.
+type pathOp struct {
+	Op  byte
+	Pts [3][2]float64
+}
+
+// qrPath is an outline in module units, with y pointing down. Holes are drawn in the
+// opposite direction to their enclosing shape so they render with the non-zero fill rule.
+type qrPath struct {
+	Ops    []pathOp
+	Curved bool // Whether the path contains curves, which should be anti-aliased
+}
+
+func (p *qrPath) moveTo(x, y float64) {
+	p.Ops = append(p.Ops, pathOp{Op: 'M', Pts: [3][2]float64{{x, y}}})
+}
+
+func (p *qrPath) lineTo(x, y float64) {
+	p.Ops = append(p.Ops, pathOp{Op: 'L', Pts: [3][2]float64{{x, y}}})
+}
+
+func (p *qrPath) cubeTo(x1, y1, x2, y2, x, y float64) {
+	p.Ops = append(p.Ops, pathOp{Op: 'C', Pts: [3][2]float64{{x1, y1}, {x2, y2}, {x, y}}})
+	p.Curved = true
+}
+
+func (p *qrPath) close() {
+	p.Ops = append(p.Ops, pathOp{Op: 'Z'})
+}
+
+// roundedRect adds a rectangle whose corners (top-left, top-right, bottom-right,
+// bottom-left) have the given radii, drawn clockwise or counterclockwise.
+func (p *qrPath) roundedRect(x, y, w, h float64, radii [4]float64, clockwise bool) {
+	tl, tr, br, bl := radii[0], radii[1], radii[2], radii[3]
+	k := 1 - bezierCircle
+	if clockwise {
+		p.moveTo(x+tl, y)
+		p.lineTo(x+w-tr, y)
+		if tr > 0 {
+			p.cubeTo(x+w-tr*k, y, x+w, y+tr*k, x+w, y+tr)
+		}
+		p.lineTo(x+w, y+h-br)
+		if br > 0 {
+			p.cubeTo(x+w, y+h-br*k, x+w-br*k, y+h, x+w-br, y+h)
+		}
+		p.lineTo(x+bl, y+h)
+		if bl > 0 {
+			p.cubeTo(x+bl*k, y+h, x, y+h-bl*k, x, y+h-bl)
+		}
+		p.lineTo(x, y+tl)
+		if tl > 0 {
+			p.cubeTo(x, y+tl*k, x+tl*k, y, x+tl, y)
+		}
+	} else {
+		p.moveTo(x+tl, y)
+		if tl > 0 {
+			p.cubeTo(x+tl*k, y, x, y+tl*k, x, y+tl)
+		}
+		p.lineTo(x, y+h-bl)
+		if bl > 0 {
+			p.cubeTo(x, y+h-bl*k, x+bl*k, y+h, x+bl, y+h)
+		}
+		p.lineTo(x+w-br, y+h)
+		if br > 0 {
+			p.cubeTo(x+w-br*k, y+h, x+w, y+h-br*k, x+w, y+h-br)
+		}
+		p.lineTo(x+w, y+tr)
+		if tr > 0 {
+			p.cubeTo(x+w, y+tr*k, x+w-tr*k, y, x+w-tr, y)
+		}
+		p.lineTo(x+tl, y)
+	}
+	p.close()
+}
+
+// rect adds a square-cornered rectangle.
+func (p *qrPath) rect(x, y, w, h float64, clockwise bool) {
+	p.roundedRect(x, y, w, h, [4]float64{}, clockwise)
+}
+
+// circle adds a circle centred on (cx, cy).
+func (p *qrPath) circle(cx, cy, r float64, clockwise bool) {
+	p.roundedRect(cx-r, cy-r, 2*r, 2*r, [4]float64{r, r, r, r}, clockwise)
+}
+
+// qrLayer is a set of outlines filled with a single colour.
+type qrLayer struct {
+	Color color.NRGBA
+	Path  qrPath
+}
+
+// qrLayers converts a QR code bitmap into filled outlines in module units according to the
+// style options, returning the layers in drawing order and the bitmap width in modules.
+func qrLayers(qr *qrcode.QRCode, opts qrOptions) ([]qrLayer, int) {
+	// QR code bitmap, including the quiet zone.
+	bitmap := qrBitmap(qr, opts.Margin)
+	modules := len(bitmap)
+	border := opts.Margin
+	symbol := modules - 2*border
+	style := opts.Style
+
+	// Top-left corners of the three finder patterns.
+	finders := [][2]int{{border, border}, {border + symbol - FinderSize, border}, {border, border + symbol - FinderSize}}
+	inFinder := func(x, y int) bool {
+		for _, f := range finders {
+			if x >= f[0] && x < f[0]+FinderSize && y >= f[1] && y < f[1]+FinderSize {
+				return true
+			}
+		}
+		return false
+	}
+	dark := func(x, y int) bool {
+		return y >= 0 && y < modules && x >= 0 && x < modules && bitmap[y][x]
+	}
+
+	// Plain styling keeps the finder patterns in the module layer so the output is a
+	// single path of merged runs.
+	plain := style.isPlain(opts.Foreground)
+
+	data := qrLayer{Color: opts.Foreground}
+	for y := 0; y < modules; y++ {
+		for x := 0; x < modules; x++ {
+			if !dark(x, y) || (!plain && inFinder(x, y)) {
+				continue
+			}
+			fx, fy := float64(x), float64(y)
+			switch style.Module {
+			case ModuleDot:
+				data.Path.circle(fx+0.5, fy+0.5, 0.45, true)
+			case ModuleRounded:
+				data.Path.roundedRect(fx+0.05, fy+0.05, 0.9, 0.9, [4]float64{0.3, 0.3, 0.3, 0.3}, true)
+			case ModuleLiquid:
+				// Round each corner that has no neighbour on either side, so adjacent
+				// modules flow into one another.
+				var radii [4]float64
+				corners := [4][2]int{{-1, -1}, {1, -1}, {1, 1}, {-1, 1}}
+				for i, c := range corners {
+					if !dark(x+c[0], y) && !dark(x, y+c[1]) {
+						radii[i] = 0.5
+					}
+				}
+				data.Path.roundedRect(fx, fy, 1, 1, radii, true)
+			default:
+				// Merge square modules into horizontal runs to keep the path short.
+				run := 1
+				for x+run < modules && dark(x+run, y) && (plain || !inFinder(x+run, y)) {
+					run++
+				}
+				data.Path.rect(fx, fy, float64(run), 1, true)
+				x += run - 1
+			}
+		}
+	}
+	if plain {
+		return []qrLayer{data}, modules
+	}
+
+	// Draw the finder patterns with their own shapes and colours.
+	outer := qrLayer{Color: style.EyeOuterColor}
+	inner := qrLayer{Color: style.EyeInnerColor}
+	for _, f := range finders {
+		x, y := float64(f[0]), float64(f[1])
+		switch style.EyeOuter {
+		case EyeRounded:
+			outer.Path.roundedRect(x, y, 7, 7, [4]float64{2, 2, 2, 2}, true)
+			outer.Path.roundedRect(x+1, y+1, 5, 5, [4]float64{1, 1, 1, 1}, false)
+		case EyeCircle:
+			outer.Path.circle(x+3.5, y+3.5, 3.5, true)
+			outer.Path.circle(x+3.5, y+3.5, 2.5, false)
+		default:
+			outer.Path.rect(x, y, 7, 7, true)
+			outer.Path.rect(x+1, y+1, 5, 5, false)
+		}
+		switch style.EyeInner {
+		case EyeRounded:
+			inner.Path.roundedRect(x+2, y+2, 3, 3, [4]float64{0.9, 0.9, 0.9, 0.9}, true)
+		case EyeCircle:
+			inner.Path.circle(x+3.5, y+3.5, 1.5, true)
+		default:
+			inner.Path.rect(x+2, y+2, 3, 3, true)
+		}
+	}
+
+	return []qrLayer{data, outer, inner}, modules
+}
+
+// rasterizeQRCode draws styled QR code layers into a size x size image.
+func rasterizeQRCode(layers []qrLayer, modules, size int, background color.NRGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(img, img.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+	drawLayers(img, layers, float64(size)/float64(modules))
+	return img
+}
+
+// drawLayers fills layers in module units over an image, scaled to pixels.
+func drawLayers(img *image.RGBA, layers []qrLayer, moduleScale float64) {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	scale := float32(moduleScale)
+	for _, layer := range layers {
+		z := vector.NewRasterizer(width, height)
+		for _, op := range layer.Path.Ops {
+			p := op.Pts
+			switch op.Op {
+			case 'M':
+				z.MoveTo(float32(p[0][0])*scale, float32(p[0][1])*scale)
+			case 'L':
+				z.LineTo(float32(p[0][0])*scale, float32(p[0][1])*scale)
+			case 'C':
+				z.CubeTo(float32(p[0][0])*scale, float32(p[0][1])*scale,
+					float32(p[1][0])*scale, float32(p[1][1])*scale,
+					float32(p[2][0])*scale, float32(p[2][1])*scale)
+			case 'Z':
+				z.ClosePath()
+			}
+		}
+		z.Draw(img, img.Bounds(), image.NewUniform(layer.Color), image.Point{})
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image/color"
+	"image/png"
+	"math"
+	"strconv"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// renderSVG draws a QR code as an SVG document as wide as the raster image.
+// The symbol is laid out in module units through the viewBox so it scales without
+// blurring, modules and eyes are drawn with the requested style, and the logo is embedded as a base64 PNG using the same geometry as the
+// raster overlay. The frame and caption, if any, are drawn as paths around the code.
+func renderSVG(qr *qrcode.QRCode, opts qrOptions, logo *qrLogo) ([]byte, error) {
+	// Outline the modules in module units, including the quiet zone.
+	layers, modules := qrLayers(qr, opts)
+
+	// Match the raster image, which never draws fewer than one pixel per module.
+	size := opts.pixelSize(modules)
+	_, frame := frameScale(opts, modules)
+	width, height := framedSize(opts, modules)
+
+	var buf bytes.Buffer
+	buf.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" version="1.1" width="%d" height="%d" viewBox="0 0 %s %s">`+"\n",
+		width, height, svgNumber(frame.Width), svgNumber(frame.Height))
+
+	// Paint the background unless it is fully transparent.
+	if opts.Background.A != 0 {
+		fmt.Fprintf(&buf, `<rect width="%s" height="%s"%s/>`+"\n", svgNumber(frame.Width), svgNumber(frame.Height), svgFill(opts.Background))
+	}
+
+	// Draw each layer as a single path, keeping straight edges crisp, with the code
+	// moved into its place in the frame.
+	framed := frame.CodeX != 0 || frame.CodeY != 0
+	if framed {
+		fmt.Fprintf(&buf, `<g transform="translate(%s %s)">`+"\n", svgNumber(frame.CodeX), svgNumber(frame.CodeY))
+	}
+	writeSVGLayers(&buf, layers)
+
+	// Embed the logo, if any, centred on the symbol.
+	if logo != nil {
+		if err := writeSVGLogo(&buf, logo, size, modules); err != nil {
+			return nil, err
+		}
+	}
+	if framed {
+		buf.WriteString("</g>\n")
+	}
+
+	// Draw the frame and caption over the background around the code.
+	writeSVGLayers(&buf, frame.Layers)
+
+	buf.WriteString("</svg>\n")
+	return buf.Bytes(), nil
+}
+
+// writeSVGLayers writes each layer as a path element.
+func writeSVGLayers(buf *bytes.Buffer, layers []qrLayer) {
+	for _, layer := range layers {
+		buf.WriteString("<path" + svgFill(layer.Color))
+		if !layer.Path.Curved {
+			buf.WriteString(` shape-rendering="crispEdges"`)
+		}
+		fmt.Fprintf(buf, ` d="%s"/>`+"\n", svgPathData(layer.Path))
+	}
+}
+
+// svgPathData formats an outline as SVG path data, using the short horizontal and
+// vertical line commands where possible.
+func svgPathData(path qrPath) string {
+	var d bytes.Buffer
+	var x, y float64
+	for _, op := range path.Ops {
+		p := op.Pts
+		switch op.Op {
+		case 'M':
+			fmt.Fprintf(&d, "M%s %s", svgNumber(p[0][0]), svgNumber(p[0][1]))
+		case 'L':
+			switch {
+			case p[0][1] == y:
+				fmt.Fprintf(&d, "H%s", svgNumber(p[0][0]))
+			case p[0][0] == x:
+				fmt.Fprintf(&d, "V%s", svgNumber(p[0][1]))
+			default:
+				fmt.Fprintf(&d, "L%s %s", svgNumber(p[0][0]), svgNumber(p[0][1]))
+			}
+		case 'C':
+			fmt.Fprintf(&d, "C%s %s %s %s %s %s", svgNumber(p[0][0]), svgNumber(p[0][1]),
+				svgNumber(p[1][0]), svgNumber(p[1][1]), svgNumber(p[2][0]), svgNumber(p[2][1]))
+			p[0] = p[2]
+		case 'Z':
+			d.WriteString("Z")
+			continue
+		}
+		x, y = p[0][0], p[0][1]
+	}
+	return d.String()
+}
+
+// writeSVGLogo writes the logo as an <image> element sized like the raster overlay:
+// scaled down to fit within logo.Percent of the image, never scaled up, keeping its aspect ratio.
+func writeSVGLogo(buf *bytes.Buffer, logo *qrLogo, size, modules int) error {
+	bounds := logo.Image.Bounds()
+	width := float64(bounds.Dx())
+	height := float64(bounds.Dy())
+	if width == 0 || height == 0 {
+		return nil
+	}
+
+	// Fit the logo in pixels exactly as resize.Thumbnail does for the PNG output.
+	maxSize := math.Floor(float64(size) * logo.Percent)
+	scale := math.Min(1, math.Min(maxSize/width, maxSize/height))
+
+	// Convert the logo dimensions from pixels to module units.
+	unit := float64(modules) / float64(size)
+	w := width * scale * unit
+	h := height * scale * unit
+	x := (float64(modules) - w) / 2
+	y := (float64(modules) - h) / 2
+
+	// Embed the full resolution logo so it stays sharp when the SVG is enlarged.
+	var logoPNG bytes.Buffer
+	if err := png.Encode(&logoPNG, logo.Image); err != nil {
+		return fmt.Errorf("failed to encode logo as PNG: %w", err)
+	}
+
+	fmt.Fprintf(buf, `<image x="%s" y="%s" width="%s" height="%s" preserveAspectRatio="none"`,
+		svgNumber(x), svgNumber(y), svgNumber(w), svgNumber(h))
+	if logo.Opacity < 1 {
+		fmt.Fprintf(buf, ` opacity="%s"`, svgNumber(math.Max(0, logo.Opacity)))
+	}
+	fmt.Fprintf(buf, ` xlink:href="data:image/png;base64,%s"/>`+"\n", base64.StdEncoding.EncodeToString(logoPNG.Bytes()))
+	return nil
+}
+
+// svgFill formats the fill attributes for a colour, adding fill-opacity when it is translucent.
+func svgFill(c color.NRGBA) string {
+	if c.A == 0xff {
+		return fmt.Sprintf(` fill="%s"`, hexColor(c))
+	}
+	return fmt.Sprintf(` fill="%s" fill-opacity="%s"`, hexColor(c), svgNumber(colorAlpha(c)))
+}
+
+// svgNumber formats a coordinate with at most four decimal places.
+func svgNumber(v float64) string {
+	return strconv.FormatFloat(math.Round(v*1e4)/1e4, 'f', -1, 64)
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// MaxSwissQRPayloadChars is the largest payload the Swiss QR-bill implementation
+	// guidelines allow
+	MaxSwissQRPayloadChars = 997
+
+	// SwissQRECC is the error correction level the guidelines require
+	SwissQRECC = "M"
+
+	// SwissCrossWidth is the width of the Swiss cross relative to the symbol, 7 mm on a
+	// 46 mm code
+	SwissCrossWidth = 7.0 / 46.0
+
+	// Side in pixels of the drawn Swiss cross, sharp at the largest image size
+	swissCrossPixels = 700
+)
+
+var (
+	countryPattern   = regexp.MustCompile(`^[A-Z]{2}$`)
+	qrrPattern       = regexp.MustCompile(`^[0-9]{27}$`)
+	swissCurrencies  = map[string]bool{"CHF": true, "EUR": true}
+	swissCheckDigits = [10]int{0, 9, 4, 6, 8, 2, 7, 1, 3, 5}
+)
+
+// swissQRFields lists the fields of the Swiss QR-bill payload type. Addresses are
+// structured, and the debtor is optional as a whole.
+var swissQRFields = []PayloadField{
+	required("iban", "IBAN or QR-IBAN"), required("creditorName", "creditor name"),
+	optional("creditorStreet", "creditor street"), optional("creditorBuildingNumber", "creditor building number"),
+	required("creditorPostalCode", "creditor postal code"), required("creditorTown", "creditor town"),
+	required("creditorCountry", "creditor country"),
+	optional("amount", "amount"), optional("currency", "currency"),
+	optional("debtorName", "debtor name"), optional("debtorStreet", "debtor street"),
+	optional("debtorBuildingNumber", "debtor building number"), optional("debtorPostalCode", "debtor postal code"),
+	optional("debtorTown", "debtor town"), optional("debtorCountry", "debtor country"),
+	optional("reference", "reference"), optional("message", "message"), optional("billingInfo", "billing information"),
+}
+
+// swissQRFieldLengths holds the maximum length in characters of the text fields.
+var swissQRFieldLengths = map[string]int{
+	"creditorName": 70, "creditorStreet": 70, "creditorBuildingNumber": 16, "creditorPostalCode": 16, "creditorTown": 35,
+	"debtorName": 70, "debtorStreet": 70, "debtorBuildingNumber": 16, "debtorPostalCode": 16, "debtorTown": 35,
+	"message": 140, "billingInfo": 140,
+}
+
+// swissCross is the mark at the centre of every QR-bill code.
+var swissCross = &qrEmblem{Image: swissCrossImage(swissCrossPixels), Width: SwissCrossWidth}
+
+// checkSwissQRFields validates the payment fields against the Swiss QR-bill
+// implementation guidelines.
+func checkSwissQRFields(get fieldGetter) error {
+	for _, field := range swissQRFields {
+		value := get(field.Name)
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("Invalid %s: must be a single line", field.Name)
+		}
+		if max, ok := swissQRFieldLengths[field.Name]; ok && utf8.RuneCountInString(value) > max {
+			return fmt.Errorf("Invalid %s: must be at most %d characters", field.Name, max)
+		}
+		if r, ok := swissQRInvalidRune(value); ok {
+			return fmt.Errorf("Invalid %s: character %q is not allowed in QR-bills", field.Name, r)
+		}
+	}
+
+	// Accounts must be Swiss or from Liechtenstein
+	iban := compactCode(get("iban"))
+	if err := checkIBAN(iban); err != nil {
+		return err
+	}
+	if country := iban[:2]; country != "CH" && country != "LI" {
+		return fmt.Errorf("Invalid IBAN: QR-bills need a CH or LI account, not %s", country)
+	}
+
+	// Both addresses are structured; the debtor is either complete or absent
+	if country := strings.ToUpper(get("creditorCountry")); !countryPattern.MatchString(country) {
+		return fmt.Errorf("Invalid creditorCountry %q: must be a 2-letter ISO 3166 country code", get("creditorCountry"))
+	}
+	if hasSwissDebtor(get) {
+		for _, name := range []string{"debtorName", "debtorPostalCode", "debtorTown", "debtorCountry"} {
+			if get(name) == "" {
+				return fmt.Errorf("Missing %s: required when a debtor is given", name)
+			}
+		}
+		if country := strings.ToUpper(get("debtorCountry")); !countryPattern.MatchString(country) {
+			return fmt.Errorf("Invalid debtorCountry %q: must be a 2-letter ISO 3166 country code", get("debtorCountry"))
+		}
+	}
+
+	if amount := get("amount"); amount != "" {
+		if _, err := parseAmount(amount); err != nil {
+			return err
+		}
+	}
+	if currency := get("currency"); currency != "" && !swissCurrencies[strings.ToUpper(currency)] {
+		return fmt.Errorf("Invalid currency %q: must be CHF or EUR", currency)
+	}
+
+	// QR-IBANs take a QR reference, other IBANs a creditor reference or none
+	reference := compactCode(get("reference"))
+	switch {
+	case isQRIBAN(iban):
+		if reference == "" {
+			return errors.New("Missing reference: a QR-IBAN requires a 27-digit QR reference")
+		}
+		if !qrrPattern.MatchString(reference) {
+			return fmt.Errorf("Invalid reference %q: a QR-IBAN requires a 27-digit QR reference", get("reference"))
+		}
+		if swissCheckDigit(reference[:26]) != int(reference[26]-'0') {
+			return fmt.Errorf("Invalid reference %q: wrong QR reference check digit", get("reference"))
+		}
+	case reference != "":
+		if qrrPattern.MatchString(reference) {
+			return fmt.Errorf("Invalid reference %q: QR references require a QR-IBAN", get("reference"))
+		}
+		if !rfPattern.MatchString(reference) {
+			return fmt.Errorf("Invalid reference %q: must be an ISO 11649 creditor reference starting with RF", get("reference"))
+		}
+		if mod97(reference[4:]+reference[:4]) != 1 {
+			return fmt.Errorf("Invalid reference %q: wrong ISO 11649 creditor reference check digits", get("reference"))
+		}
+	}
+
+	// The message and billing information share their space
+	if n := utf8.RuneCountInString(get("message")) + utf8.RuneCountInString(get("billingInfo")); n > 140 {
+		return fmt.Errorf("Invalid message: message and billingInfo together must be at most 140 characters, not %d", n)
+	}
+
+	if n := utf8.RuneCountInString(swissQRPayload(get)); n > MaxSwissQRPayloadChars {
+		return fmt.Errorf("Payment payload is %d characters, more than the %d allowed; shorten the text fields", n, MaxSwissQRPayloadChars)
+	}
+	return nil
+}
+
+// swissQRInvalidRune returns the first character outside the Latin character set the
+// Swiss Payment Standards allow, if any.
+func swissQRInvalidRune(s string) (rune, bool) {
+	for _, r := range s {
+		switch {
+		case r >= 0x20 && r <= 0x7e, r >= 0xa0 && r <= 0x17f:
+		case r == 'Ș', r == 'ș', r == 'Ț', r == 'ț', r == '€':
+		default:
+			return r, true
+		}
+	}
+	return 0, false
+}
+
+// isQRIBAN reports whether a compact Swiss or Liechtenstein IBAN is a QR-IBAN, whose
+// institution identification lies between 30000 and 31999.
+func isQRIBAN(iban string) bool {
+	if len(iban) < 9 {
+		return false
+	}
+	iid := iban[4:9]
+	return iid >= "30000" && iid <= "31999"
+}
+
+// hasSwissDebtor reports whether any debtor field is set.
+func hasSwissDebtor(get fieldGetter) bool {
+	for _, name := range []string{"debtorName", "debtorStreet", "debtorBuildingNumber", "debtorPostalCode", "debtorTown", "debtorCountry"} {
+		if get(name) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// swissCheckDigit computes the modulo 10 recursive check digit of the digits of a QR
+// reference.
+func swissCheckDigit(digits string) int {
+	carry := 0
+	for _, r := range digits {
+		carry = swissCheckDigits[(carry+int(r-'0'))%10]
+	}
+	return (10 - carry) % 10
+}
+
+// swissQRPayload builds the version 0200 payload of a Swiss QR-bill, with structured
+// addresses and no ultimate creditor, which is reserved for future use.
+func swissQRPayload(get fieldGetter) string {
+	iban := compactCode(get("iban"))
+	amount := ""
+	if cents, err := parseAmount(get("amount")); err == nil {
+		amount = fmt.Sprintf("%d.%02d", cents/100, cents%100)
+	}
+	currency := strings.ToUpper(get("currency"))
+	if currency == "" {
+		currency = "CHF"
+	}
+
+	reference := compactCode(get("reference"))
+	referenceType := "NON"
+	switch {
+	case isQRIBAN(iban):
+		referenceType = "QRR"
+	case reference != "":
+		referenceType = "SCOR"
+	}
+
+	lines := []string{"SPC", "0200", "1", iban}
+	lines = append(lines, swissQRAddress(get, "creditor")...)
+	lines = append(lines, "", "", "", "", "", "", "")
+	lines = append(lines, amount, currency)
+	if hasSwissDebtor(get) {
+		lines = append(lines, swissQRAddress(get, "debtor")...)
+	} else {
+		lines = append(lines, "", "", "", "", "", "", "")
+	}
+	lines = append(lines, referenceType, reference, get("message"), "EPD")
+	if info := get("billingInfo"); info != "" {
+		lines = append(lines, info)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// swissQRAddress returns the seven lines of a structured address of the creditor or
+// debtor.
+func swissQRAddress(get fieldGetter, party string) []string {
+	return []string{
+		"S", get(party + "Name"), get(party + "Street"), get(party + "BuildingNumber"),
+		get(party + "PostalCode"), get(party + "Town"), strings.ToUpper(get(party + "Country")),
+	}
+}
+
+// swissCrossImage draws the Swiss cross of QR-bills: a white cross on a black square,
+// in the proportions of the Swiss flag, with a white border keeping it apart from the
+// modules.
+func swissCrossImage(side int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, side, side))
+	fill := func(x0, y0, x1, y1 int, c color.Color) {
+		draw.Draw(img, image.Rect(x0, y0, x1, y1), image.NewUniform(c), image.Point{}, draw.Src)
+	}
+	fill(0, 0, side, side, color.White)
+
+	// Black square inset by 1/14 of the side, 0.5 mm of the 7 mm cross
+	border := side / 14
+	square := side - 2*border
+	fill(border, border, side-border, side-border, color.Black)
+
+	// Arms 6/32 wide and 20/32 long across the square
+	centre := side / 2
+	arm := square * 6 / 32 / 2
+	length := square * 20 / 32 / 2
+	fill(centre-arm, centre-length, centre+arm, centre+length, color.White)
+	fill(centre-length, centre-arm, centre+length, centre+arm, color.White)
+	return img
+}
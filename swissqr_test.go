@@ -0,0 +1,121 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// swissSample is the QR-bill with a QR reference of the examples of the SIX implementation
+// guidelines.
+var swissSample = map[string]string{
+	"iban": "CH44 3199 9123 0008 8901 2", "creditorName": "Robert Schneider AG",
+	"creditorStreet": "Rue du Lac", "creditorBuildingNumber": "1268", "creditorPostalCode": "2501",
+	"creditorTown": "Biel", "creditorCountry": "CH", "amount": "1949.75", "currency": "CHF",
+	"debtorName": "Pia-Maria Rutschmann-Schnyder", "debtorStreet": "Grosse Marktgasse",
+	"debtorBuildingNumber": "28", "debtorPostalCode": "9400", "debtorTown": "Rorschach", "debtorCountry": "CH",
+	"reference": "21 00000 00003 13947 14300 09017", "message": "Order of 15 June 2020",
+	"billingInfo": "//S1/10/10201409/11/200701/20/140.000-53/30/102673831/31/200615/32/7.7/33/7.7:11.05/40/0:30",
+}
+
+func TestSwissCheckDigit(t *testing.T) {
+	tests := []struct {
+		digits string
+		want   int
+	}{
+		{"21000000000313947143000901", 7},
+		{"00000000000000000000000000", 0},
+		{"1", 1},
+	}
+	for _, tt := range tests {
+		if got := swissCheckDigit(tt.digits); got != tt.want {
+			t.Errorf("swissCheckDigit(%q) = %d, want %d", tt.digits, got, tt.want)
+		}
+	}
+}
+
+func TestIsQRIBAN(t *testing.T) {
+	tests := []struct {
+		iban string
+		want bool
+	}{
+		{"CH4431999123000889012", true},
+		{"CH0030000000000000000", true},
+		{"CH0029999000000000000", false},
+		{"CH0032000000000000000", false},
+		{"CH9300762011623852957", false},
+		{"CH44", false},
+	}
+	for _, tt := range tests {
+		if got := isQRIBAN(tt.iban); got != tt.want {
+			t.Errorf("isQRIBAN(%q) = %t, want %t", tt.iban, got, tt.want)
+		}
+	}
+}
+
+func TestSwissQRPayload(t *testing.T) {
+	want := strings.Join([]string{
+		"SPC", "0200", "1", "CH4431999123000889012",
+		"S", "Robert Schneider AG", "Rue du Lac", "1268", "2501", "Biel", "CH",
+		"", "", "", "", "", "", "",
+		"1949.75", "CHF",
+		"S", "Pia-Maria Rutschmann-Schnyder", "Grosse Marktgasse", "28", "9400", "Rorschach", "CH",
+		"QRR", "210000000003139471430009017", "Order of 15 June 2020", "EPD",
+		"//S1/10/10201409/11/200701/20/140.000-53/30/102673831/31/200615/32/7.7/33/7.7:11.05/40/0:30",
+	}, "\n")
+	if err := checkSwissQRFields(fields(swissSample)); err != nil {
+		t.Fatalf("checkSwissQRFields: %v", err)
+	}
+	if got := swissQRPayload(fields(swissSample)); got != want {
+		t.Errorf("swissQRPayload:\n%q\nwant\n%q", got, want)
+	}
+
+	// Without a debtor, amount or reference on a regular IBAN
+	minimal := map[string]string{
+		"iban": "CH9300762011623852957", "creditorName": "Example", "creditorPostalCode": "8000",
+		"creditorTown": "Zürich", "creditorCountry": "ch",
+	}
+	want = "SPC\n0200\n1\nCH9300762011623852957\nS\nExample\n\n\n8000\nZürich\nCH\n\n\n\n\n\n\n\n\nCHF\n\n\n\n\n\n\n\nNON\n\n\nEPD"
+	if got := swissQRPayload(fields(minimal)); got != want {
+		t.Errorf("swissQRPayload:\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestCheckSwissQRFields(t *testing.T) {
+	regular := map[string]string{"iban": "CH9300762011623852957", "reference": ""}
+	tests := []struct {
+		name    string
+		values  map[string]string
+		wantErr string
+	}{
+		{"SIX sample", nil, ""},
+		{"wrong QR reference check digit", map[string]string{"reference": "210000000003139471430009018"}, "wrong QR reference check digit"},
+		{"short QR reference", map[string]string{"reference": "21000000000313947143000901"}, "27-digit QR reference"},
+		{"QR-IBAN without reference", map[string]string{"reference": ""}, "Missing reference"},
+		{"QR-IBAN with creditor reference", map[string]string{"reference": "RF18539007547034"}, "27-digit QR reference"},
+		{"IBAN without reference", regular, ""},
+		{"IBAN with creditor reference", merge(regular, map[string]string{"reference": "RF18 5390 0754 7034"}), ""},
+		{"IBAN with wrong creditor reference", merge(regular, map[string]string{"reference": "RF19539007547034"}), "creditor reference check digits"},
+		{"IBAN with QR reference", merge(regular, map[string]string{"reference": "210000000003139471430009017"}), "QR references require a QR-IBAN"},
+		{"IBAN with other reference", merge(regular, map[string]string{"reference": "Invoice 42"}), "must be an ISO 11649 creditor reference"},
+		{"wrong IBAN check digits", map[string]string{"iban": "CH4531999123000889012"}, "wrong check digits"},
+		{"foreign IBAN", map[string]string{"iban": "DE89370400440532013000"}, "need a CH or LI account, not DE"},
+		{"incomplete debtor", map[string]string{"debtorTown": ""}, "Missing debtorTown"},
+		{"no debtor", map[string]string{
+			"debtorName": "", "debtorStreet": "", "debtorBuildingNumber": "", "debtorPostalCode": "", "debtorTown": "", "debtorCountry": "",
+		}, ""},
+		{"creditor country", map[string]string{"creditorCountry": "Switzerland"}, "Invalid creditorCountry"},
+		{"currency", map[string]string{"currency": "eur"}, ""},
+		{"wrong currency", map[string]string{"currency": "USD"}, "must be CHF or EUR"},
+		{"amount", map[string]string{"amount": "1949.755"}, "Invalid amount"},
+		{"line break", map[string]string{"message": "a\r\nb"}, "single line"},
+		{"allowed character", map[string]string{"creditorTown": "Bucureș"}, ""},
+		{"invalid character", map[string]string{"message": "Order → shipped"}, "not allowed in QR-bills"},
+		{"long name", map[string]string{"creditorName": strings.Repeat("n", 71)}, "at most 70 characters"},
+		{"message and billing information", map[string]string{"message": strings.Repeat("m", 60)}, "together must be at most 140 characters"},
+	}
+	for _, tt := range tests {
+		if err := checkSwissQRFields(fields(merge(swissSample, tt.values))); !checkError(err, tt.wantErr) {
+			t.Errorf("%s: checkSwissQRFields = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
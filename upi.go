@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	upiAddressPattern = regexp.MustCompile(`^[A-Za-z0-9.\-_]{2,256}@[A-Za-z][A-Za-z0-9.\-]{1,64}$`)
+	upiMerchantCode   = regexp.MustCompile(`^[0-9]{4}$`)
+)
+
+// upiFields lists the fields of the Indian UPI payload type.
+var upiFields = []PayloadField{
+	required("payeeAddress", "UPI ID"), required("payeeName", "payee name"), optional("amount", "amount"),
+	optional("note", "transaction note"), optional("reference", "transaction reference"),
+	optional("merchantCode", "merchant category code"),
+}
+
+// upiFieldLengths holds the maximum length in characters of the text fields.
+var upiFieldLengths = map[string]int{"payeeName": 99, "note": 80, "reference": 35}
+
+// checkUPIFields validates the UPI ID, amount and merchant code.
+func checkUPIFields(get fieldGetter) error {
+	for name, max := range upiFieldLengths {
+		if utf8.RuneCountInString(get(name)) > max {
+			return fmt.Errorf("Invalid %s: must be at most %d characters", name, max)
+		}
+	}
+	if address := get("payeeAddress"); !upiAddressPattern.MatchString(address) {
+		return fmt.Errorf("Invalid payeeAddress %q: must be a UPI ID such as name@bank", address)
+	}
+	if amount := get("amount"); amount != "" {
+		if _, err := parseAmount(amount); err != nil {
+			return err
+		}
+	}
+	if code := get("merchantCode"); code != "" && !upiMerchantCode.MatchString(code) {
+		return fmt.Errorf("Invalid merchantCode %q: must be a 4-digit merchant category code", code)
+	}
+	return nil
+}
+
+// upiPayload builds a upi://pay link in rupees, which UPI apps open to prefill a payment.
+// UPI codes are links rather than EMVCo payloads.
+func upiPayload(get fieldGetter) string {
+	params := []struct{ key, value string }{
+		{"pa", get("payeeAddress")}, {"pn", get("payeeName")}, {"mc", get("merchantCode")},
+		{"tr", get("reference")}, {"tn", get("note")}, {"am", emvAmountValue(get("amount"))},
+		{"cu", "INR"},
+	}
+	var query []string
+	for _, p := range params {
+		if p.value != "" {
+			query = append(query, p.key+"="+upiEscape(p.value))
+		}
+	}
+	return "upi://pay?" + strings.Join(query, "&")
+}
+
+// upiEscape escapes a query value, keeping the @ of UPI IDs and writing spaces as %20,
+// which every UPI app reads.
+func upiEscape(value string) string {
+	return strings.NewReplacer("+", "%20", "%40", "@").Replace(url.QueryEscape(value))
+}
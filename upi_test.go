@@ -0,0 +1,39 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUPIPayload(t *testing.T) {
+	values := map[string]string{
+		"payeeAddress": "shop.example@okbank", "payeeName": "Example Shop & Co", "amount": "250",
+		"note": "Order 42", "reference": "TR-42", "merchantCode": "5411",
+	}
+	if err := checkUPIFields(fields(values)); err != nil {
+		t.Fatalf("checkUPIFields: %v", err)
+	}
+	want := "upi://pay?pa=shop.example@okbank&pn=Example%20Shop%20%26%20Co&mc=5411&tr=TR-42&tn=Order%2042&am=250.00&cu=INR"
+	if got := upiPayload(fields(values)); got != want {
+		t.Errorf("upiPayload:\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestCheckUPIFields(t *testing.T) {
+	tests := []struct {
+		values  map[string]string
+		wantErr string
+	}{
+		{nil, ""},
+		{map[string]string{"payeeAddress": "shop"}, "must be a UPI ID"},
+		{map[string]string{"amount": "1.001"}, "Invalid amount"},
+		{map[string]string{"merchantCode": "54111"}, "4-digit merchant category code"},
+		{map[string]string{"note": strings.Repeat("n", 81)}, "at most 80 characters"},
+	}
+	for _, tt := range tests {
+		values := merge(map[string]string{"payeeAddress": "shop@upi", "payeeName": "Shop"}, tt.values)
+		if err := checkUPIFields(fields(values)); !checkError(err, tt.wantErr) {
+			t.Errorf("checkUPIFields(%v) = %v, want %q", tt.values, err, tt.wantErr)
+		}
+	}
+}
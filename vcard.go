@@ -0,0 +1,402 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// vCard versions
+	VCard3 = "3.0" // RFC 2426, the most widely supported
+	VCard4 = "4.0" // RFC 6350
+
+	// vCardLineLength is the longest content line in octets before it is folded
+	vCardLineLength = 75
+
+	// Contact formats
+	ContactVCard  = "vcard"
+	ContactMeCard = "mecard" // NTT Docomo MeCard, much shorter but with fewer properties
+)
+
+var (
+	// Types accepted for phone numbers and email addresses
+	vCardPhoneTypes = map[string]bool{"work": true, "home": true, "cell": true, "voice": true, "fax": true, "text": true, "pager": true, "video": true}
+	vCardEmailTypes = map[string]bool{"work": true, "home": true}
+
+	// vCardEscaper escapes text values as required by RFC 6350 section 3.4.
+	vCardEscaper = strings.NewReplacer(`\`, `\\`, `,`, `\,`, `;`, `\;`, "\r\n", `\n`, "\n", `\n`)
+
+	// meCardEscaper escapes MeCard values. Commas only separate the parts of N and ADR.
+	// MeCard has no line break escape and many readers end the record at one, so line
+	// breaks become spaces.
+	meCardEscaper = strings.NewReplacer(`\`, `\\`, `;`, `\;`, `:`, `\:`, `,`, `\,`, "\r\n", " ", "\r", " ", "\n", " ")
+)
+
+// vCardFields lists the fields of the vCard payload type. phone, mobile, email and
+// address predate the multi-valued and structured fields and are still accepted.
+var vCardFields = []PayloadField{
+	optional("firstName", "first name"), optional("lastName", "last name"), optional("title", "title"),
+	optional("phone", "phone"), optional("mobile", "mobile"), optional("email", "email"),
+	optional("address", "address"), optional("company", "company"), optional("url", "URL"),
+	optional("role", "role"), optional("lang", "language"), optional("geo", "geo"),
+	optional("phones", "phone numbers"), optional("emails", "email addresses"),
+	optional("street", "street"), optional("city", "city"), optional("region", "region"),
+	optional("postalCode", "postal code"), optional("country", "country"),
+	optional("birthday", "birthday"), optional("note", "note"), optional("vcardVersion", "vCard version"),
+	optional("contactFormat", "contact format"),
+}
+
+// vCardValue is a phone number or email address with its types, such as work or cell.
+type vCardValue struct {
+	Value string
+	Types []string
+}
+
+// vCardAddress is a structured postal address.
+type vCardAddress struct {
+	Street, City, Region, PostalCode, Country string
+}
+
+// empty reports whether the address has no components.
+func (a vCardAddress) empty() bool {
+	return a == vCardAddress{}
+}
+
+// vCard is a contact card that can be written as vCard 3.0 or 4.0.
+type vCard struct {
+	FirstName, LastName string
+	Org, Title, Role    string
+	Phones              []vCardValue
+	Emails              []vCardValue
+	Address             vCardAddress
+	URL                 string
+	Lang                string
+	Latitude, Longitude string // Empty when the card has no position
+	Birthday            string // YYYY-MM-DD, or --MM-DD without a year
+	Note                string
+}
+
+// vCardFromFields builds and validates a contact card from the request fields.
+func vCardFromFields(get fieldGetter) (*vCard, error) {
+	card := &vCard{
+		FirstName: get("firstName"), LastName: get("lastName"),
+		Org: get("company"), Title: get("title"), Role: get("role"),
+		URL: get("url"), Lang: get("lang"), Note: get("note"),
+		Address: vCardAddress{
+			Street: get("street"), City: get("city"), Region: get("region"),
+			PostalCode: get("postalCode"), Country: get("country"),
+		},
+	}
+
+	// RFC 6350 requires a formatted name, made from the name or the company
+	if strings.TrimSpace(card.FirstName+card.LastName+card.Org) == "" {
+		return nil, errors.New("Missing name or company")
+	}
+
+	// The single-valued phone, mobile and email fields come first
+	if phone := get("phone"); phone != "" {
+		card.Phones = append(card.Phones, vCardValue{Value: phone, Types: []string{"work", "voice"}})
+	}
+	if mobile := get("mobile"); mobile != "" {
+		card.Phones = append(card.Phones, vCardValue{Value: mobile, Types: []string{"cell", "voice"}})
+	}
+	phones, err := parseVCardValues(get("phones"), "phone", vCardPhoneTypes)
+	if err != nil {
+		return nil, err
+	}
+	card.Phones = append(card.Phones, phones...)
+	if email := get("email"); email != "" {
+		card.Emails = append(card.Emails, vCardValue{Value: email})
+	}
+	emails, err := parseVCardValues(get("emails"), "email", vCardEmailTypes)
+	if err != nil {
+		return nil, err
+	}
+	card.Emails = append(card.Emails, emails...)
+
+	// The unstructured address is used as the street
+	if card.Address.Street == "" {
+		card.Address.Street = get("address")
+	}
+
+	// Validate the optional position as latitude,longitude
+	if geo := strings.TrimPrefix(get("geo"), "geo:"); geo != "" {
+		lat, lon, ok := strings.Cut(geo, ",")
+		coords := map[string]string{"latitude": strings.TrimSpace(lat), "longitude": strings.TrimSpace(lon)}
+		if !ok || checkMapFields(func(name string) string { return coords[name] }) != nil {
+			return nil, fmt.Errorf("Invalid geo %q: must be latitude,longitude", get("geo"))
+		}
+		card.Latitude, card.Longitude = coords["latitude"], coords["longitude"]
+	}
+
+	// Validate the optional birthday, with or without a year
+	if birthday := get("birthday"); birthday != "" {
+		layout := "2006-01-02"
+		if strings.HasPrefix(birthday, "--") {
+			layout = "--01-02"
+		}
+		if _, err := time.Parse(layout, birthday); err != nil {
+			return nil, fmt.Errorf("Invalid birthday %q: must be YYYY-MM-DD or --MM-DD", birthday)
+		}
+		card.Birthday = birthday
+	}
+	return card, nil
+}
+
+// parseVCardValues reads a comma separated list of values, each optionally prefixed with
+// its type, such as "cell:+41 79 123 45 67, home:+41 44 123 45 67".
+func parseVCardValues(list, kind string, types map[string]bool) ([]vCardValue, error) {
+	var values []vCardValue
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		value := vCardValue{Value: entry}
+		if typ, rest, ok := strings.Cut(entry, ":"); ok {
+			typ = strings.ToLower(strings.TrimSpace(typ))
+			if !types[typ] {
+				return nil, fmt.Errorf("Invalid %s type %q: must be one of %s", kind, typ, strings.Join(sortedKeys(types), ", "))
+			}
+			value = vCardValue{Value: strings.TrimSpace(rest), Types: []string{typ}}
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// sortedKeys returns the keys of a set in alphabetical order.
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// checkVCardFields validates the contact fields, the contact format and the requested
+// vCard version.
+func checkVCardFields(get fieldGetter) error {
+	if format := get("contactFormat"); format != "" && format != ContactVCard && format != ContactMeCard {
+		return fmt.Errorf("Invalid contactFormat %q: must be vcard or mecard", format)
+	}
+	if version := get("vcardVersion"); version != "" && version != VCard3 && version != VCard4 {
+		return fmt.Errorf("Invalid vcardVersion %q: must be 3.0 or 4.0", version)
+	}
+	_, err := vCardFromFields(get)
+	return err
+}
+
+// vCardPayload builds the contact in the requested format from validated fields: a vCard
+// in the requested version, 3.0 by default, or a MeCard.
+func vCardPayload(get fieldGetter) string {
+	card, _ := vCardFromFields(get)
+	if get("contactFormat") == ContactMeCard {
+		return card.MeCard()
+	}
+	return card.String(vCardVersion(get))
+}
+
+// vCardVariants encodes validated contact fields in both formats, so the versions of
+// their codes can be compared.
+func vCardVariants(get fieldGetter) []payloadVariant {
+	card, _ := vCardFromFields(get)
+	return []payloadVariant{
+		{Format: ContactVCard, Payload: card.String(vCardVersion(get))},
+		{Format: ContactMeCard, Payload: card.MeCard()},
+	}
+}
+
+// vCardVersion returns the requested vCard version, 3.0 by default.
+func vCardVersion(get fieldGetter) string {
+	if version := get("vcardVersion"); version != "" {
+		return version
+	}
+	return VCard3
+}
+
+// formattedName returns the display name of the card: the full name, or the company.
+func (c *vCard) formattedName() string {
+	if name := strings.TrimSpace(c.FirstName + " " + c.LastName); name != "" {
+		return name
+	}
+	return c.Org
+}
+
+// String writes the card in the given version with CRLF line endings, escaping text values
+// and folding long lines. Empty properties are left out.
+func (c *vCard) String(version string) string {
+	v4 := version == VCard4
+	var lines []string
+	add := func(property, value string) {
+		lines = append(lines, property+":"+value)
+	}
+
+	add("BEGIN", "VCARD")
+	add("VERSION", version)
+	add("FN", vCardEscaper.Replace(c.formattedName()))
+
+	// N is required in 3.0, and identifies individuals in 4.0
+	if c.FirstName != "" || c.LastName != "" || !v4 {
+		add("N", vCardEscaper.Replace(c.LastName)+";"+vCardEscaper.Replace(c.FirstName)+";;;")
+	}
+	if v4 && c.FirstName == "" && c.LastName == "" {
+		add("KIND", "org")
+	}
+
+	if c.Org != "" {
+		add("ORG", vCardEscaper.Replace(c.Org))
+	}
+	if c.Title != "" {
+		add("TITLE", vCardEscaper.Replace(c.Title))
+	}
+	if c.Role != "" {
+		add("ROLE", vCardEscaper.Replace(c.Role))
+	}
+
+	for _, phone := range c.Phones {
+		add("TEL"+vCardTypeParam(phone.Types, v4), vCardEscaper.Replace(phone.Value))
+	}
+	for _, email := range c.Emails {
+		types := email.Types
+		if !v4 {
+			// 3.0 marks Internet addresses, as opposed to X.400 ones
+			types = append([]string{"internet"}, types...)
+		}
+		add("EMAIL"+vCardTypeParam(types, v4), vCardEscaper.Replace(email.Value))
+	}
+
+	if !c.Address.empty() {
+		a := c.Address
+		components := []string{"", "", a.Street, a.City, a.Region, a.PostalCode, a.Country}
+		for i, component := range components {
+			components[i] = vCardEscaper.Replace(component)
+		}
+		add("ADR", strings.Join(components, ";"))
+	}
+	if c.URL != "" {
+		add("URL", c.URL)
+	}
+	if c.Birthday != "" {
+		birthday := c.Birthday
+		if v4 {
+			// 4.0 uses the basic ISO 8601 format, YYYYMMDD or --MMDD
+			year, date, _ := strings.Cut(birthday, "-")
+			if year == "" {
+				year, date = "--", date[1:]
+			}
+			birthday = year + strings.ReplaceAll(date, "-", "")
+		}
+		add("BDAY", birthday)
+	}
+	if c.Lang != "" {
+		add("LANG", c.Lang)
+	}
+	if c.Latitude != "" {
+		if v4 {
+			add("GEO", "geo:"+c.Latitude+","+c.Longitude)
+		} else {
+			add("GEO", c.Latitude+";"+c.Longitude)
+		}
+	}
+	if c.Note != "" {
+		add("NOTE", vCardEscaper.Replace(c.Note))
+	}
+	add("END", "VCARD")
+
+	for i, line := range lines {
+		lines[i] = foldVCardLine(line)
+	}
+	return strings.Join(lines, "\r\n")
+}
+
+// MeCard writes the card as a MeCard. The format has no types, title, role, language or
+// position, so those are left out, as is a birthday without a year.
+func (c *vCard) MeCard() string {
+	var sb strings.Builder
+	sb.WriteString("MECARD:")
+	add := func(property, value string) {
+		sb.WriteString(property + ":" + value + ";")
+	}
+
+	// N is "last,first", or the company for organisations
+	var names []string
+	for _, name := range []string{c.LastName, c.FirstName} {
+		if name != "" {
+			names = append(names, meCardEscaper.Replace(name))
+		}
+	}
+	if len(names) > 0 {
+		add("N", strings.Join(names, ","))
+		if c.Org != "" {
+			add("ORG", meCardEscaper.Replace(c.Org))
+		}
+	} else {
+		add("N", meCardEscaper.Replace(c.Org))
+	}
+
+	for _, phone := range c.Phones {
+		add("TEL", meCardEscaper.Replace(phone.Value))
+	}
+	for _, email := range c.Emails {
+		add("EMAIL", meCardEscaper.Replace(email.Value))
+	}
+	if !c.Address.empty() {
+		a := c.Address
+		components := []string{"", "", a.Street, a.City, a.Region, a.PostalCode, a.Country}
+		for i, component := range components {
+			components[i] = meCardEscaper.Replace(component)
+		}
+		add("ADR", strings.Join(components, ","))
+	}
+	if c.URL != "" {
+		add("URL", meCardEscaper.Replace(c.URL))
+	}
+	if c.Birthday != "" && !strings.HasPrefix(c.Birthday, "--") {
+		add("BDAY", strings.ReplaceAll(c.Birthday, "-", ""))
+	}
+	if c.Note != "" {
+		add("NOTE", meCardEscaper.Replace(c.Note))
+	}
+	sb.WriteString(";")
+	return sb.String()
+}
+
+// vCardTypeParam formats the TYPE parameter, upper case in 3.0 and lower case in 4.0.
+func vCardTypeParam(types []string, v4 bool) string {
+	if len(types) == 0 {
+		return ""
+	}
+	param := strings.Join(types, ",")
+	if !v4 {
+		param = strings.ToUpper(param)
+	}
+	return ";TYPE=" + param
+}
+
+// foldVCardLine splits a content line into lines of at most vCardLineLength octets,
+// continuing each with a space and never splitting a UTF-8 character.
+func foldVCardLine(line string) string {
+	if len(line) <= vCardLineLength {
+		return line
+	}
+	var sb strings.Builder
+	limit := vCardLineLength
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		sb.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		// Continuation lines start with a space, which counts towards their length
+		limit = vCardLineLength - 1
+	}
+	sb.WriteString(line)
+	return sb.String()
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// vCardSample is a contact using every field of the vCard type.
+var vCardSample = map[string]string{
+	"firstName": "Jane", "lastName": "Doe", "company": "Acme, Inc.", "title": "Engineer", "role": "Lead",
+	"mobile": "+41 79 123 45 67", "phones": "home:+41 44 123 45 67", "email": "jane@example.com",
+	"emails": "work:jane@acme.example", "street": "Main St 1", "city": "Zürich", "postalCode": "8001",
+	"country": "Switzerland", "url": "https://example.com", "birthday": "1990-04-01", "lang": "de",
+	"geo": "47.37,8.54", "note": "Line one\nLine two; with \\ backslash",
+}
+
+func TestVCardString(t *testing.T) {
+	tests := []struct {
+		name    string
+		fields  map[string]string
+		version string
+		want    []string
+	}{
+		{"3.0", vCardSample, VCard3, []string{
+			"BEGIN:VCARD",
+			"VERSION:3.0",
+			"FN:Jane Doe",
+			"N:Doe;Jane;;;",
+			`ORG:Acme\, Inc.`,
+			"TITLE:Engineer",
+			"ROLE:Lead",
+			"TEL;TYPE=CELL,VOICE:+41 79 123 45 67",
+			"TEL;TYPE=HOME:+41 44 123 45 67",
+			"EMAIL;TYPE=INTERNET:jane@example.com",
+			"EMAIL;TYPE=INTERNET,WORK:jane@acme.example",
+			"ADR:;;Main St 1;Zürich;;8001;Switzerland",
+			"URL:https://example.com",
+			"BDAY:1990-04-01",
+			"LANG:de",
+			"GEO:47.37;8.54",
+			`NOTE:Line one\nLine two\; with \\ backslash`,
+			"END:VCARD",
+		}},
+		{"4.0", vCardSample, VCard4, []string{
+			"BEGIN:VCARD",
+			"VERSION:4.0",
+			"FN:Jane Doe",
+			"N:Doe;Jane;;;",
+			`ORG:Acme\, Inc.`,
+			"TITLE:Engineer",
+			"ROLE:Lead",
+			"TEL;TYPE=cell,voice:+41 79 123 45 67",
+			"TEL;TYPE=home:+41 44 123 45 67",
+			"EMAIL:jane@example.com",
+			"EMAIL;TYPE=work:jane@acme.example",
+			"ADR:;;Main St 1;Zürich;;8001;Switzerland",
+			"URL:https://example.com",
+			"BDAY:19900401",
+			"LANG:de",
+			"GEO:geo:47.37,8.54",
+			`NOTE:Line one\nLine two\; with \\ backslash`,
+			"END:VCARD",
+		}},
+		{"3.0 organisation", map[string]string{"company": "Acme"}, VCard3, []string{
+			"BEGIN:VCARD", "VERSION:3.0", "FN:Acme", "N:;;;;", "ORG:Acme", "END:VCARD",
+		}},
+		{"4.0 organisation", map[string]string{"company": "Acme", "birthday": "--04-01"}, VCard4, []string{
+			"BEGIN:VCARD", "VERSION:4.0", "FN:Acme", "KIND:org", "ORG:Acme", "BDAY:--0401", "END:VCARD",
+		}},
+		{"legacy address", map[string]string{"lastName": "Doe", "address": "Main St 1, Zürich"}, VCard3, []string{
+			"BEGIN:VCARD", "VERSION:3.0", "FN:Doe", "N:Doe;;;;", `ADR:;;Main St 1\, Zürich;;;;`, "END:VCARD",
+		}},
+	}
+	for _, tt := range tests {
+		card, err := vCardFromFields(fields(tt.fields))
+		if err != nil {
+			t.Fatalf("%s: vCardFromFields: %v", tt.name, err)
+		}
+		if got, want := card.String(tt.version), strings.Join(tt.want, "\r\n"); got != want {
+			t.Errorf("%s: String =\n%s\nwant\n%s", tt.name, got, want)
+		}
+	}
+}
+
+func TestVCardFromFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		fields  map[string]string
+		wantErr string
+	}{
+		{"name", map[string]string{"firstName": "Jane"}, ""},
+		{"company", map[string]string{"company": "Acme"}, ""},
+		{"no name", map[string]string{"firstName": " ", "email": "jane@example.com"}, "Missing name or company"},
+		{"typed phones", map[string]string{"firstName": "Jane", "phones": "cell:1, work:2,3"}, ""},
+		{"unknown phone type", map[string]string{"firstName": "Jane", "phones": "mobile:1"}, `Invalid phone type "mobile"`},
+		{"unknown email type", map[string]string{"firstName": "Jane", "emails": "cell:jane@example.com"}, `Invalid email type "cell"`},
+		{"geo URI", map[string]string{"firstName": "Jane", "geo": "geo:47.37, 8.54"}, ""},
+		{"geo out of range", map[string]string{"firstName": "Jane", "geo": "91,8"}, "Invalid geo"},
+		{"geo without longitude", map[string]string{"firstName": "Jane", "geo": "47.37"}, "Invalid geo"},
+		{"birthday without year", map[string]string{"firstName": "Jane", "birthday": "--12-31"}, ""},
+		{"invalid birthday", map[string]string{"firstName": "Jane", "birthday": "1990-02-30"}, "Invalid birthday"},
+	}
+	for _, tt := range tests {
+		if _, err := vCardFromFields(fields(tt.fields)); !checkError(err, tt.wantErr) {
+			t.Errorf("%s: vCardFromFields = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+
+	if err := checkVCardFields(fields(map[string]string{"firstName": "Jane", "vcardVersion": "2.1"})); !checkError(err, "Invalid vcardVersion") {
+		t.Errorf("checkVCardFields with version 2.1 = %v", err)
+	}
+}
+
+func TestFoldVCardLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want []string
+	}{
+		{"short", "NOTE:short", []string{"NOTE:short"}},
+		{"exactly 75", "NOTE:" + strings.Repeat("a", 70), []string{"NOTE:" + strings.Repeat("a", 70)}},
+		{"76", "NOTE:" + strings.Repeat("a", 71), []string{"NOTE:" + strings.Repeat("a", 70), " a"}},
+		{"several lines", "NOTE:" + strings.Repeat("b", 200), []string{
+			"NOTE:" + strings.Repeat("b", 70), " " + strings.Repeat("b", 74), " " + strings.Repeat("b", 56),
+		}},
+		{"multi-byte character at the limit", "NOTE:" + strings.Repeat("a", 69) + "ü", []string{
+			"NOTE:" + strings.Repeat("a", 69), " ü",
+		}},
+	}
+	for _, tt := range tests {
+		got := foldVCardLine(tt.line)
+		if want := strings.Join(tt.want, "\r\n"); got != want {
+			t.Errorf("%s: foldVCardLine = %q, want %q", tt.name, got, want)
+		}
+		for _, line := range strings.Split(got, "\r\n") {
+			if len(line) > vCardLineLength || !utf8.ValidString(line) {
+				t.Errorf("%s: invalid folded line %q", tt.name, line)
+			}
+		}
+	}
+}
+
+func TestMeCard(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields map[string]string
+		want   string
+	}{
+		{"person", map[string]string{
+			"firstName": "Jane", "lastName": "Doe", "company": "Acme, Inc.", "title": "Engineer",
+			"mobile": "+41 79 123 45 67", "emails": "work:jane@acme.example", "street": "Main St 1", "city": "Zürich",
+			"url": "https://example.com", "birthday": "1990-04-01", "note": `a;b:c\d`,
+		}, `MECARD:N:Doe,Jane;ORG:Acme\, Inc.;TEL:+41 79 123 45 67;EMAIL:jane@acme.example;` +
+			`ADR:,,Main St 1,Zürich,,,;URL:https\://example.com;BDAY:19900401;NOTE:a\;b\:c\\d;;`},
+		{"first name only", map[string]string{"firstName": "Jane"}, "MECARD:N:Jane;;"},
+		{"organisation", map[string]string{"company": "Acme"}, "MECARD:N:Acme;;"},
+		{"birthday without year", map[string]string{"lastName": "Doe", "birthday": "--04-01"}, "MECARD:N:Doe;;"},
+		{"line breaks", map[string]string{"lastName": "Doe", "street": "Main St 1\r\nBuilding 2", "note": "one\ntwo\rthree"},
+			"MECARD:N:Doe;ADR:,,Main St 1 Building 2,,,,;NOTE:one two three;;"},
+	}
+	for _, tt := range tests {
+		card, err := vCardFromFields(fields(tt.fields))
+		if err != nil {
+			t.Fatalf("%s: vCardFromFields: %v", tt.name, err)
+		}
+		if got := card.MeCard(); got != tt.want {
+			t.Errorf("%s: MeCard = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMeCardRoundTrip(t *testing.T) {
+	card, err := vCardFromFields(fields(vCardSample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	meCard := card.MeCard()
+	parsed := parseMeCardPayload(strings.TrimPrefix(meCard, "MECARD:"))
+	again, err := vCardFromFields(fields(parsed))
+	if err != nil {
+		t.Fatalf("vCardFromFields(%v): %v", parsed, err)
+	}
+	if got := again.MeCard(); got != meCard {
+		t.Errorf("round trip = %q, want %q", got, meCard)
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// DefaultVCFStrip lists the properties removed by default from imported contacts too large
+// for a QR code. They hold embedded images, sounds and keys, the largest part of most contacts.
+const DefaultVCFStrip = "PHOTO,LOGO,SOUND,KEY"
+
+// importedVCardPayload encodes a contact read from a .vcf file as it was written, apart
+// from the properties stripped to fit the code. It has no default logo.
+var importedVCardPayload = payloadSpec{
+	name:   "vcf",
+	fields: []PayloadField{required("payload", "contact")},
+	format: func(get fieldGetter) string { return get("payload") },
+}
+
+// vcfContact is one contact read from a .vcf file.
+type vcfContact struct {
+	Name     string   // Formatted name, used to name its file
+	Lines    []string // Unfolded content lines, BEGIN and END included
+	Stripped []string // Names of the properties removed from the contact
+	Warnings []string // Content removed from the contact, reported with its code
+}
+
+// String writes the contact with CRLF line endings, folding long lines again.
+func (c *vcfContact) String() string {
+	lines := make([]string, len(c.Lines))
+	for i, line := range c.Lines {
+		lines[i] = foldVCardLine(line)
+	}
+	return strings.Join(lines, "\r\n")
+}
+
+// fit removes the properties in strip when the contact does not fit in a QR code, with a
+// warning naming them.
+func (c *vcfContact) fit(fits func(payload string) bool, strip map[string]bool) {
+	if len(strip) == 0 || fits(c.String()) {
+		return
+	}
+	removed := map[string]bool{}
+	lines := make([]string, 0, len(c.Lines))
+	for _, line := range c.Lines {
+		if name, _ := contentLineName(line); strip[name] {
+			if !removed[name] {
+				c.Stripped = append(c.Stripped, name)
+			}
+			removed[name] = true
+			continue
+		}
+		lines = append(lines, line)
+	}
+	c.Lines = lines
+	if len(c.Stripped) > 0 {
+		c.Warnings = append(c.Warnings, fmt.Sprintf("Removed %s to fit the code", strings.Join(c.Stripped, ", ")))
+	}
+}
+
+// parseStripOption reads the strip option of an import: a comma separated list of property
+// names, "none" to keep every property, or empty for the given defaults.
+func parseStripOption(value, defaults string) map[string]bool {
+	if value == "" {
+		value = defaults
+	}
+	strip := map[string]bool{}
+	if strings.EqualFold(value, "none") {
+		return strip
+	}
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.ToUpper(strings.TrimSpace(name)); name != "" {
+			strip[name] = true
+		}
+	}
+	return strip
+}
+
+// readContentLines reads the content lines of a vCard or iCalendar file, unfolding
+// continuation lines and skipping blank ones. With quotedPrintable set, the soft line
+// breaks of vCard 2.1 quoted-printable values are joined too.
+func readContentLines(r io.Reader, quotedPrintable bool) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), MaxBatchUploadBytes)
+
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		last := len(lines) - 1
+		switch {
+		case last >= 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")):
+			lines[last] += line[1:]
+		case quotedPrintable && last >= 0 && strings.HasSuffix(lines[last], "=") && isQuotedPrintable(lines[last]):
+			lines[last] = lines[last][:len(lines[last])-1] + line
+		case strings.TrimSpace(line) != "":
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// readVCF splits a .vcf file into its contacts.
+func readVCF(r io.Reader) ([]*vcfContact, error) {
+	lines, err := readContentLines(r, true)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid .vcf file: %v", err)
+	}
+
+	// Group the content lines into contacts
+	var contacts []*vcfContact
+	var contact *vcfContact
+	for _, line := range lines {
+		name, _ := contentLineName(line)
+		switch {
+		case name == "BEGIN" && strings.EqualFold(contentLineValue(line), "VCARD"):
+			if contact != nil {
+				return nil, fmt.Errorf("Invalid .vcf file: contact %d has no END:VCARD", len(contacts)+1)
+			}
+			contact = &vcfContact{}
+		case contact == nil:
+			return nil, errors.New("Invalid .vcf file: content outside BEGIN:VCARD and END:VCARD")
+		case name == "FN":
+			contact.Name = unescapeBackslashes(contentLineValue(line), true)
+		case name == "N" && contact.Name == "":
+			// Used when the contact has no formatted name, as in vCard 2.1
+			parts := splitEscaped(contentLineValue(line), ';')
+			if len(parts) > 1 {
+				contact.Name = strings.TrimSpace(unescapeBackslashes(parts[1], true) + " " + unescapeBackslashes(parts[0], true))
+			} else {
+				contact.Name = unescapeBackslashes(parts[0], true)
+			}
+		}
+		contact.Lines = append(contact.Lines, line)
+		if name == "END" && strings.EqualFold(contentLineValue(line), "VCARD") {
+			contacts = append(contacts, contact)
+			contact = nil
+			if len(contacts) > MaxBatchRows {
+				return nil, fmt.Errorf("Too many contacts: maximum is %d", MaxBatchRows)
+			}
+		}
+	}
+	if contact != nil {
+		return nil, fmt.Errorf("Invalid .vcf file: contact %d has no END:VCARD", len(contacts)+1)
+	}
+	if len(contacts) == 0 {
+		return nil, errors.New("No contacts found in .vcf file")
+	}
+	return contacts, nil
+}
+
+// splitContentLine splits a content line at the colon ending its name and parameters,
+// skipping colons in quoted parameter values such as ALTREP="http://...".
+func splitContentLine(line string) (string, string) {
+	quoted := false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '"':
+			quoted = !quoted
+		case ':':
+			if !quoted {
+				return line[:i], line[i+1:]
+			}
+		}
+	}
+	return line, ""
+}
+
+// contentLineName returns the upper case name of a content line's property without its
+// group, such as TEL for "item1.TEL;TYPE=CELL:...", and its parameters as written.
+func contentLineName(line string) (string, []string) {
+	head, _ := splitContentLine(line)
+	params := strings.Split(head, ";")
+	name := strings.ToUpper(params[0])
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		name = name[i+1:]
+	}
+	return name, params[1:]
+}
+
+// contentLineValue returns the value of a content line.
+func contentLineValue(line string) string {
+	_, value := splitContentLine(line)
+	return value
+}
+
+// isQuotedPrintable reports whether a content line has a quoted-printable value.
+func isQuotedPrintable(line string) bool {
+	_, params := contentLineName(line)
+	for _, param := range params {
+		if param = strings.ToUpper(param); param == "ENCODING=QUOTED-PRINTABLE" || param == "QUOTED-PRINTABLE" {
+			return true
+		}
+	}
+	return false
+}
+
+// vcfBatchSource lists the contacts as batch rows, with their warnings, so a multi-contact
+// file is written as a ZIP archive with a manifest like a CSV batch.
+func vcfBatchSource(contacts []*vcfContact) *batchSource {
+	source := &batchSource{Columns: map[string]int{"payload": 0, BatchFilenameColumn: 1}}
+	for _, contact := range contacts {
+		source.Rows = append(source.Rows, []string{contact.String(), contact.Name})
+		source.Warnings = append(source.Warnings, contact.Warnings)
+	}
+	return source
+}
+
+func importVCFHandler(w http.ResponseWriter, r *http.Request) {
+	// Check if the request method is POST, otherwise return an error
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		log.Printf("importVCFHandler: Method not allowed")
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, MaxBatchUploadBytes)
+
+	// Read the uploaded .vcf file
+	vcfFile, _, err := r.FormFile("vcf")
+	if err != nil {
+		http.Error(w, "Missing .vcf file", http.StatusBadRequest)
+		log.Printf("importVCFHandler: Missing .vcf file - %v", err)
+		return
+	}
+	defer vcfFile.Close()
+	contacts, err := readVCF(vcfFile)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		log.Printf("importVCFHandler: %v", err)
+		return
+	}
+
+	// Decode the uploaded logo, if any
+	var customLogo image.Image
+	file, _, err := r.FormFile("image")
+	if err != nil && err != http.ErrMissingFile {
+		http.Error(w, "Error reading image", http.StatusBadRequest)
+		log.Printf("importVCFHandler: Error reading image - %v", err)
+		return
+	}
+	if file != nil {
+		defer file.Close()
+		customLogo, err = decodeImage(file)
+		if err != nil {
+			http.Error(w, "Failed to decode image", http.StatusBadRequest)
+			log.Printf("importVCFHandler: Failed to decode image - %v", err)
+			return
+		}
+	}
+
+	// Validate the shared options, then strip the contacts that do not fit
+	if err := validateBatchOptions(importedVCardPayload, r.FormValue, customLogo); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		log.Printf("importVCFHandler: %v", err)
+		return
+	}
+	fits, err := payloadFits(importedVCardPayload, r.FormValue, customLogo)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		log.Printf("importVCFHandler: %v", err)
+		return
+	}
+	strip := parseStripOption(r.FormValue("strip"), DefaultVCFStrip)
+	for _, contact := range contacts {
+		contact.fit(fits, strip)
+	}
+	source := vcfBatchSource(contacts)
+
+	// Several contacts are returned as a ZIP archive with one code each
+	if len(contacts) > 1 {
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="contacts-qr-codes.zip"`)
+		failed, err := writeBatchZip(w, importedVCardPayload, source, r.FormValue, customLogo)
+		if err != nil {
+			log.Printf("importVCFHandler: Failed to write ZIP archive - %v", err)
+			return
+		}
+		log.Printf("importVCFHandler: Generated %d of %d contact codes", len(source.Rows)-failed, len(source.Rows))
+		return
+	}
+
+	// Generate the code of a single contact
+	result, err := generatePayloadQRCode(importedVCardPayload, source.get(source.Rows[0]), r.FormValue, customLogo)
+	if err != nil {
+		var genErr *generateError
+		if errors.As(err, &genErr) {
+			http.Error(w, genErr.Message, genErr.Status)
+		} else {
+			http.Error(w, "Failed to generate QR code", http.StatusInternalServerError)
+		}
+		log.Printf("importVCFHandler: %v", err)
+		return
+	}
+
+	// Set the content type header and write the QR code to the HTTP response writer,
+	// reporting the properties removed from the contact with the warnings
+	result.Warnings = append(result.Warnings, contacts[0].Warnings...)
+	w.Header().Set("Content-Type", result.ContentType)
+	setResultHeaders(w, result)
+	for _, name := range contacts[0].Stripped {
+		w.Header().Add("X-QR-Stripped", name)
+	}
+	if _, err := w.Write(result.Data); err != nil {
+		log.Printf("importVCFHandler: Failed to write QR code - %v", err)
+	}
+}
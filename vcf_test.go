@@ -0,0 +1,195 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadVCF(t *testing.T) {
+	tests := []struct {
+		name    string
+		vcf     string
+		names   []string
+		lines   [][]string
+		wantErr string
+	}{
+		{
+			name:  "two contacts",
+			vcf:   "BEGIN:VCARD\r\nVERSION:3.0\r\nFN:Jane Doe\r\nEND:VCARD\r\nBEGIN:VCARD\r\nVERSION:3.0\r\nFN:John\\, Jr.\r\nEND:VCARD\r\n",
+			names: []string{"Jane Doe", "John, Jr."},
+			lines: [][]string{
+				{"BEGIN:VCARD", "VERSION:3.0", "FN:Jane Doe", "END:VCARD"},
+				{"BEGIN:VCARD", "VERSION:3.0", `FN:John\, Jr.`, "END:VCARD"},
+			},
+		},
+		{
+			name:  "folded lines and blank lines",
+			vcf:   "BEGIN:VCARD\nFN:Jane\n  Doe\n\nNOTE:a\n\tb\nEND:VCARD\n",
+			names: []string{"Jane Doe"},
+			lines: [][]string{{"BEGIN:VCARD", "FN:Jane Doe", "NOTE:ab", "END:VCARD"}},
+		},
+		{
+			name:  "quoted-printable soft line breaks",
+			vcf:   "BEGIN:VCARD\r\nVERSION:2.1\r\nN:Doe;Jane\r\nNOTE;ENCODING=QUOTED-PRINTABLE:first=\r\nsecond\r\nEND:VCARD\r\n",
+			names: []string{"Jane Doe"},
+			lines: [][]string{{"BEGIN:VCARD", "VERSION:2.1", "N:Doe;Jane", "NOTE;ENCODING=QUOTED-PRINTABLE:firstsecond", "END:VCARD"}},
+		},
+		{
+			name:  "embedded photo kept",
+			vcf:   "BEGIN:VCARD\nFN:Jane\nPHOTO;ENCODING=b:AAAA\nitem1.KEY:abc\nEND:VCARD\n",
+			names: []string{"Jane"},
+			lines: [][]string{{"BEGIN:VCARD", "FN:Jane", "PHOTO;ENCODING=b:AAAA", "item1.KEY:abc", "END:VCARD"}},
+		},
+		{name: "empty", vcf: "", wantErr: "No contacts found"},
+		{name: "content outside a contact", vcf: "FN:Jane\n", wantErr: "content outside BEGIN:VCARD"},
+		{name: "missing END", vcf: "BEGIN:VCARD\nFN:Jane\n", wantErr: "contact 1 has no END:VCARD"},
+		{name: "nested BEGIN", vcf: "BEGIN:VCARD\nBEGIN:VCARD\nEND:VCARD\n", wantErr: "contact 1 has no END:VCARD"},
+		{name: "too many contacts", vcf: strings.Repeat("BEGIN:VCARD\nFN:x\nEND:VCARD\n", MaxBatchRows+1), wantErr: "Too many contacts"},
+	}
+	for _, tt := range tests {
+		contacts, err := readVCF(strings.NewReader(tt.vcf))
+		if !checkError(err, tt.wantErr) {
+			t.Errorf("%s: readVCF error = %v, want %q", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if len(contacts) != len(tt.names) {
+			t.Errorf("%s: got %d contacts, want %d", tt.name, len(contacts), len(tt.names))
+			continue
+		}
+		for i, contact := range contacts {
+			if contact.Name != tt.names[i] {
+				t.Errorf("%s: contact %d name = %q, want %q", tt.name, i+1, contact.Name, tt.names[i])
+			}
+			if !reflect.DeepEqual(contact.Lines, tt.lines[i]) {
+				t.Errorf("%s: contact %d lines = %q, want %q", tt.name, i+1, contact.Lines, tt.lines[i])
+			}
+		}
+	}
+}
+
+func TestVCFContactFit(t *testing.T) {
+	lines := []string{"BEGIN:VCARD", "FN:Jane", "PHOTO;ENCODING=b:AAAA", "TEL:1", "item1.KEY:abc", "PHOTO:BBBB", "END:VCARD"}
+	tests := []struct {
+		name     string
+		strip    string
+		fits     bool
+		lines    []string
+		stripped []string
+		warnings []string
+	}{
+		{"fits", "", true, lines, nil, nil},
+		{"default strip", "", false, []string{"BEGIN:VCARD", "FN:Jane", "TEL:1", "END:VCARD"},
+			[]string{"PHOTO", "KEY"}, []string{"Removed PHOTO, KEY to fit the code"}},
+		{"custom strip", "tel", false, []string{"BEGIN:VCARD", "FN:Jane", "PHOTO;ENCODING=b:AAAA", "item1.KEY:abc", "PHOTO:BBBB", "END:VCARD"},
+			[]string{"TEL"}, []string{"Removed TEL to fit the code"}},
+		{"strip none", "none", false, lines, nil, nil},
+		{"nothing to strip", "NOTE", false, lines, nil, nil},
+	}
+	for _, tt := range tests {
+		contact := &vcfContact{Name: "Jane", Lines: append([]string(nil), lines...)}
+		contact.fit(func(string) bool { return tt.fits }, parseStripOption(tt.strip, DefaultVCFStrip))
+		if !reflect.DeepEqual(contact.Lines, tt.lines) {
+			t.Errorf("%s: lines = %q, want %q", tt.name, contact.Lines, tt.lines)
+		}
+		if !reflect.DeepEqual(contact.Stripped, tt.stripped) {
+			t.Errorf("%s: stripped = %q, want %q", tt.name, contact.Stripped, tt.stripped)
+		}
+		if !reflect.DeepEqual(contact.Warnings, tt.warnings) {
+			t.Errorf("%s: warnings = %q, want %q", tt.name, contact.Warnings, tt.warnings)
+		}
+	}
+}
+
+func TestVCFBatchSource(t *testing.T) {
+	contacts := []*vcfContact{
+		{Name: "Jane", Lines: []string{"BEGIN:VCARD", "FN:Jane", "END:VCARD"}, Warnings: []string{"Removed PHOTO to fit the code"}},
+		{Name: "John", Lines: []string{"BEGIN:VCARD", "FN:John", "END:VCARD"}},
+	}
+	source := vcfBatchSource(contacts)
+	if got := source.get(source.Rows[1])(BatchFilenameColumn); got != "John" {
+		t.Errorf("filename = %q, want John", got)
+	}
+	if want := [][]string{{"Removed PHOTO to fit the code"}, nil}; !reflect.DeepEqual(source.Warnings, want) {
+		t.Errorf("warnings = %q, want %q", source.Warnings, want)
+	}
+}
+
+func TestParseStripOption(t *testing.T) {
+	tests := []struct {
+		value string
+		want  map[string]bool
+	}{
+		{"", map[string]bool{"PHOTO": true, "LOGO": true, "SOUND": true, "KEY": true}},
+		{"none", map[string]bool{}},
+		{"NONE", map[string]bool{}},
+		{" photo , note,,", map[string]bool{"PHOTO": true, "NOTE": true}},
+	}
+	for _, tt := range tests {
+		if got := parseStripOption(tt.value, DefaultVCFStrip); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseStripOption(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestReadContentLines(t *testing.T) {
+	tests := []struct {
+		name            string
+		input           string
+		quotedPrintable bool
+		want            []string
+	}{
+		{"CRLF and LF", "A:1\r\nB:2\nC:3", false, []string{"A:1", "B:2", "C:3"}},
+		{"folded with space and tab", "NOTE:a\r\n b\r\n\tc\r\n", false, []string{"NOTE:abc"}},
+		{"blank lines", "A:1\n\n\r\nB:2\n", false, []string{"A:1", "B:2"}},
+		{"soft line break", "NOTE;QUOTED-PRINTABLE:a=\nb=3D\n", true, []string{"NOTE;QUOTED-PRINTABLE:ab=3D"}},
+		{"soft line break ignored", "NOTE;QUOTED-PRINTABLE:a=\nb:c\n", false, []string{"NOTE;QUOTED-PRINTABLE:a=", "b:c"}},
+		{"equals without quoted-printable", "NOTE:a=\nB:c\n", true, []string{"NOTE:a=", "B:c"}},
+		{"empty", "", false, nil},
+	}
+	for _, tt := range tests {
+		got, err := readContentLines(strings.NewReader(tt.input), tt.quotedPrintable)
+		if err != nil {
+			t.Errorf("%s: readContentLines: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: readContentLines = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestContentLineName(t *testing.T) {
+	tests := []struct {
+		line   string
+		name   string
+		params []string
+		value  string
+	}{
+		{"FN:Jane", "FN", []string{}, "Jane"},
+		{"item1.tel;type=cell:+41 79", "TEL", []string{"type=cell"}, "+41 79"},
+		{"NOTE;ENCODING=QUOTED-PRINTABLE;CHARSET=UTF-8:a=3Db", "NOTE", []string{"ENCODING=QUOTED-PRINTABLE", "CHARSET=UTF-8"}, "a=3Db"},
+		{`DESCRIPTION;ALTREP="http://example.com/a:b":Text: more`, "DESCRIPTION", []string{`ALTREP="http://example.com/a:b"`}, "Text: more"},
+		{"END", "END", []string{}, ""},
+	}
+	for _, tt := range tests {
+		name, params := contentLineName(tt.line)
+		if name != tt.name || !reflect.DeepEqual(params, tt.params) {
+			t.Errorf("contentLineName(%q) = %q, %q, want %q, %q", tt.line, name, params, tt.name, tt.params)
+		}
+		if value := contentLineValue(tt.line); value != tt.value {
+			t.Errorf("contentLineValue(%q) = %q, want %q", tt.line, value, tt.value)
+		}
+	}
+}
+
+func TestVCFContactString(t *testing.T) {
+	contact := &vcfContact{Lines: []string{"BEGIN:VCARD", "NOTE:" + strings.Repeat("a", 80), "END:VCARD"}}
+	want := "BEGIN:VCARD\r\nNOTE:" + strings.Repeat("a", 70) + "\r\n " + strings.Repeat("a", 10) + "\r\nEND:VCARD"
+	if got := contact.String(); got != want {
+		t.Errorf("String = %q, want %q", got, want)
+	}
+}
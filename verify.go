@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image/png"
+
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	// MinLogoPercent is the smallest logo size tried when shrinking a logo automatically
+	MinLogoPercent = 0.05
+
+	// LogoShrinkFactor scales the logo on each automatic shrinking attempt
+	LogoShrinkFactor = 0.85
+)
+
+// errUnreadable reports a rendered code that the decoder could not read back.
+var errUnreadable = errors.New("Generated QR code could not be decoded")
+
+// verifyOptions controls the round-trip decoding of generated codes.
+type verifyOptions struct {
+	Verify         bool // Decode the rendered image and fail if it does not match the payload
+	AutoShrinkLogo bool // Shrink the logo until the code decodes instead of failing
+}
+
+// parseVerifyOptions reads the verify option, which defaults to true, and autoShrinkLogo.
+func parseVerifyOptions(get fieldGetter) (verifyOptions, error) {
+	opts := verifyOptions{Verify: true}
+	if value := get("verify"); value != "" {
+		verify, err := parseFormBool(value)
+		if err != nil {
+			return opts, fmt.Errorf("Invalid verify")
+		}
+		opts.Verify = verify
+	}
+	autoShrink, err := parseFormBool(get("autoShrinkLogo"))
+	if err != nil {
+		return opts, fmt.Errorf("Invalid autoShrinkLogo")
+	}
+	opts.AutoShrinkLogo = autoShrink
+	return opts, nil
+}
+
+// verifyQRCode decodes the rendered image and checks that it holds the payload. Vector
+// output is checked through a PNG rendering with the same style and logo geometry.
+func verifyQRCode(data []byte, qr *qrcode.QRCode, opts qrOptions, logo *qrLogo, payload string) error {
+	if opts.Format != FormatPNG {
+		opts.Format = FormatPNG
+		if opts.Size == 0 {
+			opts.Size = QRLarge
+		}
+		var err error
+		if data, _, err = renderQRCode(qr, opts, logo); err != nil {
+			return err
+		}
+	}
+
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	decoded, err := decodeQRCode(img)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errUnreadable, err)
+	}
+	if decoded.Payload != payload {
+		return fmt.Errorf("%w: decoded payload does not match", errUnreadable)
+	}
+	return nil
+}
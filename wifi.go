@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// Wi-Fi security types accepted in the security field
+	WiFiOpen       = "nopass"
+	WiFiWEP        = "WEP"
+	WiFiWPA        = "WPA"
+	WiFiWPA2       = "WPA2"
+	WiFiWPA3       = "WPA3"
+	WiFiEnterprise = "WPA2-EAP"
+
+	// MaxSSIDLength is the longest SSID in bytes
+	MaxSSIDLength = 32
+)
+
+var (
+	// wifiAuthTypes maps the security types to the T value of the WIFI: payload. WPA3 is
+	// written as WPA too: the T value only tells the scanner to use a passphrase, which
+	// WPA3 networks accept, while only recent Android versions understand T:SAE.
+	wifiAuthTypes = map[string]string{
+		WiFiOpen: "nopass", WiFiWEP: "WEP", WiFiWPA: "WPA", WiFiWPA2: "WPA", WiFiWPA3: "WPA", WiFiEnterprise: "WPA2-EAP",
+	}
+
+	// eapMethods lists the supported EAP methods and whether each takes a password and a
+	// phase 2 method. TLS authenticates with a certificate installed on the device.
+	eapMethods = map[string]struct{ Password, Phase2 bool }{
+		"PEAP": {true, true}, "TTLS": {true, true}, "PWD": {true, false}, "TLS": {false, false},
+	}
+
+	// eapPhase2Methods lists the inner authentication methods allowed by each EAP method.
+	eapPhase2Methods = map[string]map[string]bool{
+		"PEAP": {"MSCHAPV2": true, "GTC": true},
+		"TTLS": {"PAP": true, "MSCHAP": true, "MSCHAPV2": true, "GTC": true},
+	}
+
+	// wifiEscaper escapes the characters with a special meaning in WIFI: payload values.
+	wifiEscaper = strings.NewReplacer(`\`, `\\`, `;`, `\;`, `,`, `\,`, `:`, `\:`, `"`, `\"`)
+)
+
+// eapFields lists the Wi-Fi fields that only apply to enterprise networks.
+var eapFields = []PayloadField{
+	optional("eapMethod", "EAP method"), optional("identity", "identity"),
+	optional("anonymousIdentity", "anonymous identity"), optional("phase2", "phase 2 method"),
+}
+
+// wifiFields lists the fields of the Wi-Fi payload type.
+var wifiFields = append([]PayloadField{
+	required("ssid", "SSID"), optional("password", "password"), optional("security", "security type"),
+	optional("hidden", "hidden network flag"),
+}, eapFields...)
+
+// wifiSecurity returns the security type of the fields, WPA when it is not set.
+func wifiSecurity(get fieldGetter) string {
+	if security := get("security"); security != "" {
+		return security
+	}
+	return WiFiWPA
+}
+
+// checkWiFiFields validates the SSID and the password and EAP settings against the security type.
+func checkWiFiFields(get fieldGetter) error {
+	password := get("password")
+	security := wifiSecurity(get)
+
+	// Validate the provided security type and SSID
+	if _, ok := wifiAuthTypes[security]; !ok {
+		return errors.New("Invalid security type: must be nopass, WEP, WPA, WPA2, WPA3 or WPA2-EAP")
+	}
+	if len(get("ssid")) > MaxSSIDLength {
+		return fmt.Errorf("SSID is too long: maximum is %d bytes", MaxSSIDLength)
+	}
+	if _, err := parseFormBool(get("hidden")); err != nil {
+		return errors.New("Invalid hidden flag")
+	}
+
+	// The EAP settings only apply to enterprise networks
+	if security != WiFiEnterprise {
+		for _, field := range eapFields {
+			if get(field.Name) != "" {
+				return fmt.Errorf("The %s is only used with WPA2-EAP security", field.Label)
+			}
+		}
+	}
+
+	switch security {
+	case WiFiWPA, WiFiWPA2, WiFiWPA3:
+		// Validate password requirements for WPA/WPA2/WPA3 security, which also accepts a
+		// raw 256-bit key as 64 hex digits except on WPA3-only networks
+		if password == "" {
+			return errors.New("Password is required for WPA/WPA2/WPA3 security")
+		}
+		if (len(password) < 8 || len(password) > 63) && (security == WiFiWPA3 || !isHexKey(password, 64)) {
+			return errors.New("Password for WPA/WPA2/WPA3 must be between 8 and 63 characters")
+		}
+	case WiFiWEP:
+		// Validate password requirements for WEP security, as text or hex digits
+		if len(password) != 5 && len(password) != 13 && !isHexKey(password, 10) && !isHexKey(password, 26) {
+			return errors.New("Password for WEP must be exactly 5 or 13 characters, or 10 or 26 hex digits")
+		}
+	case WiFiEnterprise:
+		return checkEAPFields(get)
+	}
+	return nil
+}
+
+// checkEAPFields validates the EAP method, identity, password and phase 2 method of an
+// enterprise network.
+func checkEAPFields(get fieldGetter) error {
+	method := strings.ToUpper(get("eapMethod"))
+	if method == "" {
+		return errors.New("EAP method is required for WPA2-EAP security")
+	}
+	info, ok := eapMethods[method]
+	if !ok {
+		return errors.New("Invalid EAP method: must be PEAP, TTLS, PWD or TLS")
+	}
+	if get("identity") == "" {
+		return errors.New("Identity is required for WPA2-EAP security")
+	}
+	if info.Password && get("password") == "" {
+		return fmt.Errorf("Password is required for the %s EAP method", method)
+	}
+	if !info.Password && get("password") != "" {
+		return fmt.Errorf("The %s EAP method does not use a password", method)
+	}
+	if get("anonymousIdentity") != "" && !info.Phase2 {
+		return fmt.Errorf("The %s EAP method does not use an anonymous identity", method)
+	}
+	if phase2 := strings.ToUpper(get("phase2")); phase2 != "" {
+		if !info.Phase2 {
+			return fmt.Errorf("The %s EAP method does not use a phase 2 method", method)
+		}
+		if !eapPhase2Methods[method][phase2] {
+			return fmt.Errorf("Invalid phase 2 method %q for %s", get("phase2"), method)
+		}
+	}
+	return nil
+}
+
+// isHexKey reports whether s is a key of exactly n hex digits.
+func isHexKey(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// wifiPayload builds a WIFI: payload from validated fields, escaping the special
+// characters in every value. Open networks carry no password.
+func wifiPayload(get fieldGetter) string {
+	security := wifiSecurity(get)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "WIFI:T:%s;S:%s;", wifiAuthTypes[security], wifiEscaper.Replace(get("ssid")))
+	if security == WiFiEnterprise {
+		sb.WriteString("E:" + strings.ToUpper(get("eapMethod")) + ";")
+		if phase2 := get("phase2"); phase2 != "" {
+			sb.WriteString("PH2:" + strings.ToUpper(phase2) + ";")
+		}
+		if anonymous := get("anonymousIdentity"); anonymous != "" {
+			sb.WriteString("A:" + wifiEscaper.Replace(anonymous) + ";")
+		}
+		sb.WriteString("I:" + wifiEscaper.Replace(get("identity")) + ";")
+	}
+	if password := get("password"); password != "" && security != WiFiOpen {
+		sb.WriteString("P:" + wifiEscaper.Replace(password) + ";")
+	}
+	if hidden, _ := parseFormBool(get("hidden")); hidden {
+		sb.WriteString("H:true;")
+	}
+	sb.WriteString(";")
+	return sb.String()
+}
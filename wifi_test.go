@@ -0,0 +1,76 @@
+package main
+
+import "testing"
+
+func TestWiFiPayload(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields map[string]string
+		want   string
+	}{
+		{"WPA2", map[string]string{"ssid": "Home", "password": "secret123", "security": "WPA2"},
+			"WIFI:T:WPA;S:Home;P:secret123;;"},
+		{"WPA3", map[string]string{"ssid": "Home", "password": "secret123", "security": "WPA3"},
+			"WIFI:T:WPA;S:Home;P:secret123;;"},
+		{"default security", map[string]string{"ssid": "Home", "password": "secret123"},
+			"WIFI:T:WPA;S:Home;P:secret123;;"},
+		{"WEP", map[string]string{"ssid": "Old", "password": "abcde", "security": "WEP"},
+			"WIFI:T:WEP;S:Old;P:abcde;;"},
+		{"open drops password", map[string]string{"ssid": "Cafe", "password": "ignored", "security": "nopass"},
+			"WIFI:T:nopass;S:Cafe;;"},
+		{"escaping", map[string]string{"ssid": `a;b,c:d\e"f`, "password": `p;a:s,s\w"d`, "security": "WPA"},
+			`WIFI:T:WPA;S:a\;b\,c\:d\\e\"f;P:p\;a\:s\,s\\w\"d;;`},
+		{"hidden", map[string]string{"ssid": "Home", "password": "secret123", "security": "WPA", "hidden": "on"},
+			"WIFI:T:WPA;S:Home;P:secret123;H:true;;"},
+		{"not hidden", map[string]string{"ssid": "Home", "password": "secret123", "security": "WPA", "hidden": "false"},
+			"WIFI:T:WPA;S:Home;P:secret123;;"},
+		{"PEAP", map[string]string{"ssid": "Corp", "password": "pw", "security": "WPA2-EAP", "eapMethod": "peap",
+			"phase2": "mschapv2", "anonymousIdentity": "anon@corp", "identity": "jane;doe"},
+			`WIFI:T:WPA2-EAP;S:Corp;E:PEAP;PH2:MSCHAPV2;A:anon@corp;I:jane\;doe;P:pw;;`},
+		{"TLS", map[string]string{"ssid": "Corp", "security": "WPA2-EAP", "eapMethod": "TLS", "identity": "jane"},
+			"WIFI:T:WPA2-EAP;S:Corp;E:TLS;I:jane;;"},
+	}
+	for _, tt := range tests {
+		if got := wifiPayload(fields(tt.fields)); got != tt.want {
+			t.Errorf("%s: wifiPayload = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCheckWiFiFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		fields  map[string]string
+		wantErr string
+	}{
+		{"WPA", map[string]string{"ssid": "Home", "password": "secret123", "security": "WPA"}, ""},
+		{"WPA2 hex key", map[string]string{"ssid": "Home", "password": "0123456789abcdef0123456789abcdef0123456789abcdef0123456789ABCDEF", "security": "WPA2"}, ""},
+		{"WPA3 hex key", map[string]string{"ssid": "Home", "password": "0123456789abcdef0123456789abcdef0123456789abcdef0123456789ABCDEF", "security": "WPA3"}, "between 8 and 63"},
+		{"WPA short password", map[string]string{"ssid": "Home", "password": "short", "security": "WPA"}, "between 8 and 63"},
+		{"WPA missing password", map[string]string{"ssid": "Home", "security": "WPA"}, "Password is required"},
+		{"default security", map[string]string{"ssid": "Home", "password": "secret123"}, ""},
+		{"default security missing password", map[string]string{"ssid": "Home"}, "Password is required"},
+		{"WEP text", map[string]string{"ssid": "Old", "password": "abcdefghijklm", "security": "WEP"}, ""},
+		{"WEP hex", map[string]string{"ssid": "Old", "password": "0a1b2c3d4e", "security": "WEP"}, ""},
+		{"WEP wrong length", map[string]string{"ssid": "Old", "password": "abcdef", "security": "WEP"}, "Password for WEP"},
+		{"open", map[string]string{"ssid": "Cafe", "security": "nopass"}, ""},
+		{"unknown security", map[string]string{"ssid": "Home", "password": "secret123", "security": "WPA4"}, "Invalid security type"},
+		{"SSID too long", map[string]string{"ssid": "0123456789012345678901234567890123", "security": "nopass"}, "SSID is too long"},
+		{"invalid hidden", map[string]string{"ssid": "Cafe", "security": "nopass", "hidden": "maybe"}, "Invalid hidden flag"},
+		{"EAP field without EAP", map[string]string{"ssid": "Home", "password": "secret123", "security": "WPA", "identity": "jane"}, "only used with WPA2-EAP"},
+		{"PEAP", map[string]string{"ssid": "Corp", "password": "pw", "security": "WPA2-EAP", "eapMethod": "PEAP", "identity": "jane", "phase2": "GTC"}, ""},
+		{"EAP missing method", map[string]string{"ssid": "Corp", "password": "pw", "security": "WPA2-EAP", "identity": "jane"}, "EAP method is required"},
+		{"EAP unknown method", map[string]string{"ssid": "Corp", "password": "pw", "security": "WPA2-EAP", "eapMethod": "LEAP", "identity": "jane"}, "Invalid EAP method"},
+		{"EAP missing identity", map[string]string{"ssid": "Corp", "password": "pw", "security": "WPA2-EAP", "eapMethod": "TTLS"}, "Identity is required"},
+		{"EAP missing password", map[string]string{"ssid": "Corp", "security": "WPA2-EAP", "eapMethod": "PWD", "identity": "jane"}, "Password is required for the PWD"},
+		{"TLS with password", map[string]string{"ssid": "Corp", "password": "pw", "security": "WPA2-EAP", "eapMethod": "TLS", "identity": "jane"}, "does not use a password"},
+		{"PWD with anonymous identity", map[string]string{"ssid": "Corp", "password": "pw", "security": "WPA2-EAP", "eapMethod": "PWD", "identity": "jane", "anonymousIdentity": "anon"}, "does not use an anonymous identity"},
+		{"PWD with phase 2", map[string]string{"ssid": "Corp", "password": "pw", "security": "WPA2-EAP", "eapMethod": "PWD", "identity": "jane", "phase2": "PAP"}, "does not use a phase 2 method"},
+		{"PEAP with PAP", map[string]string{"ssid": "Corp", "password": "pw", "security": "WPA2-EAP", "eapMethod": "PEAP", "identity": "jane", "phase2": "PAP"}, `Invalid phase 2 method "PAP" for PEAP`},
+	}
+	for _, tt := range tests {
+		if err := checkWiFiFields(fields(tt.fields)); !checkError(err, tt.wantErr) {
+			t.Errorf("%s: checkWiFiFields = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
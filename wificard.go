@@ -0,0 +1,400 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// Card sizes
+	CardA6       = "a6"       // A6 portrait, 105 x 148 mm
+	CardA7       = "a7"       // A7 portrait, 74 x 105 mm
+	CardBusiness = "business" // Business card landscape, 85 x 55 mm
+
+	// DefaultCardTitle is printed at the top of cards without a title
+	DefaultCardTitle = "Guest WiFi"
+
+	// Card text sizes and spacing, relative to the short side of the card
+	cardPadding   = 0.07
+	cardTitleSize = 0.09
+	cardLabelSize = 0.04
+	cardValueSize = 0.065
+	cardLineGap   = 0.025
+)
+
+// cardSizes holds the width and height in millimetres of each card size.
+var cardSizes = map[string][2]float64{
+	CardA6:       {105, 148},
+	CardA7:       {74, 105},
+	CardBusiness: {85, 55},
+}
+
+// cardOptions describes the layout and output of a guest Wi-Fi card.
+type cardOptions struct {
+	WidthMM, HeightMM float64   // Card size
+	Title             string    // Heading printed above the network details
+	ValidUntil        time.Time // Last day the network details are valid, zero for none
+	Format            string    // Output format, png or pdf
+	DPI               int       // Resolution of PNG cards and of the logo in PDF cards
+}
+
+// parseCardOptions extracts and validates the card settings from the request fields.
+func parseCardOptions(get fieldGetter) (cardOptions, error) {
+	opts := cardOptions{Title: DefaultCardTitle, Format: FormatPNG, DPI: DefaultPrintDPI}
+
+	// Validate the optional card size, defaulting to A6
+	size := strings.ToLower(get("cardSize"))
+	if size == "" {
+		size = CardA6
+	}
+	dims, ok := cardSizes[size]
+	if !ok {
+		return opts, fmt.Errorf("Invalid cardSize %q: must be a6, a7 or business", get("cardSize"))
+	}
+	opts.WidthMM, opts.HeightMM = dims[0], dims[1]
+
+	// Validate the optional title
+	if title := strings.TrimSpace(get("title")); title != "" {
+		if utf8.RuneCountInString(title) > MaxCaptionLength {
+			return opts, fmt.Errorf("Title is too long: maximum is %d characters", MaxCaptionLength)
+		}
+		if strings.ContainsAny(title, "\r\n") {
+			return opts, errors.New("Title must be a single line")
+		}
+		opts.Title = title
+	}
+
+	// Validate the optional validity date
+	if value := get("validUntil"); value != "" {
+		date, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return opts, fmt.Errorf("Invalid validUntil %q: must be a date as YYYY-MM-DD", value)
+		}
+		opts.ValidUntil = date
+	}
+
+	// Validate the optional output format; cards are printed, so SVG is not offered
+	if value := strings.ToLower(get("format")); value != "" {
+		if value != FormatPNG && value != FormatPDF {
+			return opts, fmt.Errorf("Invalid format %q: cards must be png or pdf", get("format"))
+		}
+		opts.Format = value
+	}
+
+	// Validate the optional resolution, keeping PNG cards within the image size limit
+	if value := get("dpi"); value != "" {
+		dpi, err := strconv.Atoi(value)
+		if err != nil || dpi < MinPrintDPI || dpi > MaxPrintDPI {
+			return opts, fmt.Errorf("Invalid dpi: must be between %d and %d", MinPrintDPI, MaxPrintDPI)
+		}
+		opts.DPI = dpi
+	}
+	if opts.Format == FormatPNG {
+		if longest := opts.pixels(math.Max(opts.WidthMM, opts.HeightMM)); longest > MaxQRCodeSize {
+			return opts, fmt.Errorf("A %s card at %d dpi is %dpx, larger than the maximum of %dpx", size, opts.DPI, longest, MaxQRCodeSize)
+		}
+	}
+	return opts, nil
+}
+
+// pixels converts a length in millimetres to whole pixels at the card resolution.
+func (o cardOptions) pixels(mm float64) int {
+	return int(math.Round(mm / 25.4 * float64(o.DPI)))
+}
+
+// cardLine is a line of text on a card, laid out in millimetres.
+type cardLine struct {
+	Text string
+	Size float64 // Font size, shrunk to fit the column
+	Gap  float64 // Space above the line
+}
+
+// height returns the vertical space taken by the line, including room for descenders.
+func (l cardLine) height() float64 {
+	return l.Gap + captionCapHeight(l.Size) + 0.3*l.Size
+}
+
+// cardLayout places the code and text of a card, in millimetres with y pointing down.
+type cardLayout struct {
+	CodeX, CodeY, CodeSize float64   // Square of the code, quiet zone included
+	Layers                 []qrLayer // Text outlines
+}
+
+// layoutWiFiCard lays out a card for the given Wi-Fi fields. Portrait cards stack the
+// title, code and details; landscape cards put the code on the left and the text on the
+// right. The text layers have no colour yet.
+func layoutWiFiCard(get fieldGetter, opts cardOptions) *cardLayout {
+	w, h := opts.WidthMM, opts.HeightMM
+	short := math.Min(w, h)
+	pad := short * cardPadding
+	gap := short * cardLineGap
+
+	// Collect the network details; open networks and certificate logins print no password
+	title := []cardLine{{Text: opts.Title, Size: short * cardTitleSize}}
+	details := []cardLine{
+		{Text: "Network", Size: short * cardLabelSize, Gap: gap},
+		{Text: get("ssid"), Size: short * cardValueSize},
+	}
+	if identity := get("identity"); identity != "" {
+		details = append(details,
+			cardLine{Text: "Username", Size: short * cardLabelSize, Gap: gap},
+			cardLine{Text: identity, Size: short * cardValueSize})
+	}
+	if password := get("password"); password != "" && wifiSecurity(get) != WiFiOpen {
+		details = append(details,
+			cardLine{Text: "Password", Size: short * cardLabelSize, Gap: gap},
+			cardLine{Text: password, Size: short * cardValueSize})
+	}
+	var validity []cardLine
+	if !opts.ValidUntil.IsZero() {
+		validity = append(validity, cardLine{Text: "Valid until " + opts.ValidUntil.Format("2 January 2006"), Size: short * cardLabelSize})
+	}
+
+	layout := &cardLayout{}
+	var column float64
+	portrait := h >= w
+	if portrait {
+		column = w - 2*pad
+	} else {
+		layout.CodeSize = h - 2*pad
+		column = w - layout.CodeSize - 3*pad
+	}
+	fitCardLines(title, column)
+	fitCardLines(details, column)
+	fitCardLines(validity, column)
+
+	if portrait {
+		// Give the code whatever height is left between the title and the details
+		top := pad + cardLinesHeight(title)
+		bottom := h - pad - cardLinesHeight(validity)
+		layout.CodeSize = math.Min(column, bottom-top-2*gap-cardLinesHeight(details))
+		layout.CodeX = (w - layout.CodeSize) / 2
+		layout.CodeY = top + gap
+		layout.drawLines(title, pad, pad, column, true)
+		layout.drawLines(details, pad, layout.CodeY+layout.CodeSize, column, true)
+		layout.drawLines(validity, pad, bottom, column, true)
+	} else {
+		// Fill the height with the code and write the text in a column beside it
+		layout.CodeX, layout.CodeY = pad, pad
+		x := 2*pad + layout.CodeSize
+		y := layout.drawLines(title, x, pad, column, false)
+		layout.drawLines(details, x, y, column, false)
+		layout.drawLines(validity, x, h-pad-cardLinesHeight(validity), column, false)
+	}
+	return layout
+}
+
+// fitCardLines shrinks lines that are wider than the column.
+func fitCardLines(lines []cardLine, column float64) {
+	for i := range lines {
+		if width := captionWidth(lines[i].Text, lines[i].Size); width > column {
+			lines[i].Size *= column / width
+		}
+	}
+}
+
+// cardLinesHeight returns the height of a block of lines.
+func cardLinesHeight(lines []cardLine) float64 {
+	height := 0.0
+	for _, line := range lines {
+		height += line.height()
+	}
+	return height
+}
+
+// drawLines outlines a block of lines starting at the given top, centred in the column
+// or aligned to its left edge, and returns the bottom of the block.
+func (c *cardLayout) drawLines(lines []cardLine, x, top, column float64, centred bool) float64 {
+	for _, line := range lines {
+		baseline := top + line.Gap + captionCapHeight(line.Size)
+		left := x
+		if centred {
+			left += (column - captionWidth(line.Text, line.Size)) / 2
+		}
+		c.Layers = append(c.Layers, qrLayer{Path: captionPath(line.Text, left, baseline, line.Size)})
+		top += line.height()
+	}
+	return top
+}
+
+// generateWiFiCard generates a Wi-Fi code through the shared pipeline and lays it out on
+// a printable card with the network details in plain text. The result describes the card.
+func generateWiFiCard(data, options fieldGetter, customLogo image.Image) (*qrResult, error) {
+	wifi, ok := lookupPayloadType("wifi")
+	if !ok {
+		return nil, internalError("Failed to generate card", errors.New("wifi payload type is not registered"))
+	}
+	opts, err := parseCardOptions(options)
+	if err != nil {
+		return nil, badRequest(ErrCodeInvalidOptions, err)
+	}
+
+	// Validate the Wi-Fi fields before laying out the card with them
+	if err := wifi.Validate(data); err != nil {
+		return nil, badRequest(ErrCodeInvalidData, err)
+	}
+	layout := layoutWiFiCard(data, opts)
+
+	// Generate the code as a PNG sized for the card, which is also what gets verified.
+	// Frames and captions do not apply, as the card carries its own text.
+	codePixels := QRLarge
+	if opts.Format == FormatPNG {
+		codePixels = opts.pixels(layout.CodeSize)
+	}
+	codeOptions := func(name string) string {
+		switch name {
+		case "format":
+			return FormatPNG
+		case "size":
+			return strconv.Itoa(codePixels)
+		case "moduleSize", "frame", "caption":
+			return ""
+		}
+		return options(name)
+	}
+	result, err := generatePayloadQRCode(wifi, data, codeOptions, customLogo)
+	if err != nil {
+		return nil, err
+	}
+
+	// Print the text in the module colour now that it is known
+	for i := range layout.Layers {
+		layout.Layers[i].Color = result.Options.Foreground
+	}
+
+	card := *result
+	if opts.Format == FormatPDF {
+		card.Data, err = renderCardPDF(result, layout, opts)
+		card.ContentType = "application/pdf"
+		card.Width, card.Height = 0, 0
+	} else {
+		card.Data, err = renderCardPNG(result, layout, opts)
+		card.ContentType = "image/png"
+		card.Width, card.Height = opts.pixels(opts.WidthMM), opts.pixels(opts.HeightMM)
+	}
+	if err != nil {
+		return nil, internalError("Failed to render card", err)
+	}
+	return &card, nil
+}
+
+// renderCardPNG draws the card at its resolution around the rendered code image.
+func renderCardPNG(result *qrResult, layout *cardLayout, opts cardOptions) ([]byte, error) {
+	code, err := png.Decode(bytes.NewReader(result.Data))
+	if err != nil {
+		return nil, err
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, opts.pixels(opts.WidthMM), opts.pixels(opts.HeightMM)))
+	draw.Draw(img, img.Bounds(), image.NewUniform(result.Options.Background), image.Point{}, draw.Src)
+	offset := image.Pt(opts.pixels(layout.CodeX), opts.pixels(layout.CodeY))
+	draw.Draw(img, code.Bounds().Add(offset), code, code.Bounds().Min, draw.Src)
+	drawLayers(img, layout.Layers, float64(opts.DPI)/25.4)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode card as PNG: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// renderCardPDF draws the card as a single vector PDF page the size of the card.
+func renderCardPDF(result *qrResult, layout *cardLayout, opts cardOptions) ([]byte, error) {
+	width := opts.WidthMM * ptPerMM
+	height := opts.HeightMM * ptPerMM
+
+	doc := &pdfDocument{}
+	resources := &pdfResources{}
+	var content bytes.Buffer
+
+	// Paint the background unless it is fully transparent.
+	if bg := result.Options.Background; bg.A != 0 {
+		content.WriteString("q\n")
+		writePDFFill(doc, resources, &content, bg)
+		fmt.Fprintf(&content, "%s re f\nQ\n", pdfRect(0, 0, width, height))
+	}
+
+	// Draw the code, its logo and the text.
+	layers, modules := qrLayers(result.Code, result.Options)
+	size := layout.CodeSize * ptPerMM
+	x := layout.CodeX * ptPerMM
+	top := height - layout.CodeY*ptPerMM
+	writePDFLayers(doc, resources, &content, layers, x, top, size/float64(modules))
+	if result.Logo != nil {
+		if err := writePDFLogo(doc, resources, &content, result.Logo, opts.DPI, x, top-size, size); err != nil {
+			return nil, err
+		}
+	}
+	writePDFLayers(doc, resources, &content, layout.Layers, 0, height, ptPerMM)
+
+	// Assemble the page, trimmed to the card.
+	contentID, err := doc.addStream("", content.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	pagesID := doc.reserve()
+	pageID := doc.add(fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %s %s] /Resources %s /Contents %d 0 R >>",
+		pagesID, pdfNumber(width), pdfNumber(height), resources, contentID))
+	doc.set(pagesID, fmt.Sprintf("<< /Type /Pages /Kids [%d 0 R] /Count 1 >>", pageID))
+	catalogID := doc.add(fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pagesID))
+
+	return doc.bytes(catalogID), nil
+}
+
+func wifiCardHandler(w http.ResponseWriter, r *http.Request) {
+	// Check if the request method is POST, otherwise return an error
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		log.Printf("wifiCardHandler: Method not allowed")
+		return
+	}
+
+	// Decode the uploaded logo, if any
+	var customLogo image.Image
+	file, _, err := r.FormFile("image")
+	if err != nil && err != http.ErrMissingFile {
+		http.Error(w, "Error reading image", http.StatusBadRequest)
+		log.Printf("wifiCardHandler: Error reading image - %v", err)
+		return
+	}
+	if file != nil {
+		defer file.Close()
+		customLogo, err = decodeImage(file)
+		if err != nil {
+			http.Error(w, "Failed to decode image", http.StatusBadRequest)
+			log.Printf("wifiCardHandler: Failed to decode image - %v", err)
+			return
+		}
+	}
+
+	// Generate the card from the form fields
+	card, err := generateWiFiCard(r.FormValue, r.FormValue, customLogo)
+	if err != nil {
+		var genErr *generateError
+		if errors.As(err, &genErr) {
+			http.Error(w, genErr.Message, genErr.Status)
+		} else {
+			http.Error(w, "Failed to generate card", http.StatusInternalServerError)
+		}
+		log.Printf("wifiCardHandler: %v", err)
+		return
+	}
+
+	// Set the content type header and write the card to the HTTP response writer
+	w.Header().Set("Content-Type", card.ContentType)
+	setResultHeaders(w, card)
+	if _, err := w.Write(card.Data); err != nil {
+		log.Printf("wifiCardHandler: Failed to write card - %v", err)
+	}
+}